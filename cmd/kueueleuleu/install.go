@@ -0,0 +1,410 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/norbjd/kueueleuleu/webhook"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	installSubcommand       = "install"
+	defaultInstallNamespace = "kueueleuleu-system"
+	webhookSecretName       = "kueueleuleu-webhook-tls"
+	webhookContainerName    = "webhook"
+	webhookPort             = 8443
+	webhookServicePort      = 443
+	webhookTimeoutSeconds   = 10
+	// webhookImageCacheDir - where the webhook caches image configurations when commands are resolved.
+	webhookImageCacheDir = "/var/cache/kueueleuleu"
+	nameLabel            = "app.kubernetes.io/name"
+	// nonRootUser - the webhook runs as the nonroot user of distroless images.
+	nonRootUser = 65532
+)
+
+var errRenderRequired = errors.New("only rendering manifests is supported")
+
+type installFlags struct {
+	convertFlags
+	render          bool
+	namespace       string
+	image           string
+	replicas        int
+	policyConfigMap string
+	sendAllObjects  bool
+}
+
+func (f *installFlags) register(flagSet *flag.FlagSet) {
+	f.convertFlags.register(flagSet)
+	flagSet.BoolVar(&f.render, "render", false, "output manifests to stdout, to apply them with kubectl apply -f -")
+	flagSet.StringVar(&f.namespace, "namespace", defaultInstallNamespace, "namespace to deploy the webhook in")
+	flagSet.StringVar(&f.namespace, "n", defaultInstallNamespace, "shorthand for -namespace")
+	flagSet.StringVar(&f.image, "image", "", "image of the webhook, whose entrypoint is the kueueleuleu binary")
+	flagSet.IntVar(&f.replicas, "replicas", 2, "number of replicas of the webhook") //nolint:gomnd
+	flagSet.StringVar(&f.policyConfigMap, "policy-configmap", "",
+		"name of the ConfigMaps holding the policy of their namespace (the webhook is allowed to read ConfigMaps "+
+			"of all namespaces)")
+	flagSet.BoolVar(&f.sendAllObjects, "send-all-objects", false,
+		"send all Pods, Jobs and CronJobs to the webhook (except the ones labelled with "+webhook.OptInKey+
+			": \"false\", and the ones of kube-system and -namespace), not only labelled ones, for opt-out policies")
+}
+
+// webhookArgs - returns the arguments of the webhook container: the conversion flags set on the command line
+// are passed to the webhook.
+func (f *installFlags) webhookArgs(flagSet *flag.FlagSet) ([]string, error) {
+	args := []string{
+		webhookSubcommand,
+		"-namespace=" + f.namespace,
+		"-addr=:" + strconv.Itoa(webhookPort),
+		"-self-signed-secret=" + webhookSecretName,
+		"-service=" + defaultWebhookServiceName,
+		"-webhook-configuration=" + defaultWebhookConfigurationName,
+	}
+
+	if f.policyConfigMap != "" {
+		args = append(args, "-policy-configmap="+f.policyConfigMap)
+	}
+
+	convertFlagSet := flag.NewFlagSet("", flag.ContinueOnError)
+	(&convertFlags{}).register(convertFlagSet)
+
+	var err error
+
+	flagSet.Visit(func(setFlag *flag.Flag) {
+		if convertFlagSet.Lookup(setFlag.Name) == nil {
+			return
+		}
+
+		switch setFlag.Name {
+		case "image-commands-file", "image-cache-dir", "offline":
+			err = fmt.Errorf("%w: -%s refers to local files, and can't be passed to the webhook",
+				errInvalidFlag, setFlag.Name)
+		case "image-pull-secret":
+			for _, secretName := range f.imagePullSecrets.values {
+				args = append(args, "-image-pull-secret="+secretName)
+			}
+		default:
+			args = append(args, "-"+setFlag.Name+"="+setFlag.Value.String())
+		}
+	})
+
+	if f.resolveCommands {
+		args = append(args, "-image-cache-dir="+webhookImageCacheDir)
+	}
+
+	return args, err
+}
+
+func installMain(args []string) {
+	var flags installFlags
+
+	flagSet := flag.NewFlagSet(installSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %[1]s %[2]s -render -image IMAGE [OPTIONS]
+Output the manifests deploying the admission webhook (see "%[1]s %[3]s -help"): a Deployment, a Service,
+a MutatingWebhookConfiguration and RBAC. The webhook generates its own self-signed certificate, renews it, and
+patches the caBundle of the MutatingWebhookConfiguration, so cert-manager is not needed.
+Only objects labelled with %[4]s: "true" are sent to the webhook, unless -send-all-objects is set.
+Conversion options are passed to the webhook.
+
+Example: %[1]s %[2]s -render -image IMAGE | kubectl apply -f -
+
+`, commandName(os.Args[0]), installSubcommand, webhookSubcommand, webhook.OptInKey)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	if len(parseInterspersed(flagSet, args)) != 0 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	webhookArgs, err := flags.webhookArgs(flagSet)
+	if err == nil {
+		err = flags.validate()
+	}
+
+	if err != nil {
+		log.Println(err)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	err = renderInstall(os.Stdout, flags, webhookArgs)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (f *installFlags) validate() error {
+	switch {
+	case !f.render:
+		return fmt.Errorf("%w: use -render, and apply the output with kubectl", errRenderRequired)
+	case f.image == "":
+		return fmt.Errorf("%w: -image is required", errInvalidFlag)
+	case f.namespace == "":
+		return fmt.Errorf("%w: -namespace is required", errInvalidFlag)
+	case f.replicas < 1:
+		return fmt.Errorf("%w: -replicas must be at least 1", errInvalidFlag)
+	}
+
+	// fail now rather than in the webhook
+	_, err := f.options()
+
+	return err
+}
+
+// renderInstall - writes the manifests deploying the webhook to w, as YAML documents.
+func renderInstall(w io.Writer, flags installFlags, webhookArgs []string) error {
+	for _, object := range installObjects(flags, webhookArgs) {
+		objectYAML, err := kyaml.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("cannot marshal object: %w", err)
+		}
+
+		_, err = w.Write(append([]byte("---\n"), objectYAML...))
+		if err != nil {
+			return fmt.Errorf("cannot write object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+//nolint:funlen
+func installObjects(flags installFlags, webhookArgs []string) []any {
+	name := defaultWebhookServiceName
+	labels := map[string]string{nameLabel: name}
+	meta := metav1.ObjectMeta{Name: name, Namespace: flags.namespace, Labels: labels}
+	clusterMeta := metav1.ObjectMeta{Name: name, Labels: labels}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: flags.namespace}}
+	replicas := int32(flags.replicas)
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	timeoutSeconds := int32(webhookTimeoutSeconds)
+	path := webhookPath
+	servicePort := int32(webhookServicePort)
+	namespacedScope := admissionregistrationv1.NamespacedScope
+	objectSelector, namespaceSelector := webhookSelectors(flags)
+	runAsNonRoot := true
+	runAsUser := int64(nonRootUser)
+	readOnlyRootFilesystem := true
+	allowPrivilegeEscalation := false
+
+	return []any{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta,
+		},
+		// the webhook manages the secret holding its certificate; secrets can't be created by name
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: meta,
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"create"}},
+				{
+					APIGroups:     []string{""},
+					Resources:     []string{"secrets"},
+					ResourceNames: []string{webhookSecretName},
+					Verbs:         []string{"get", "update"},
+				},
+			},
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: meta,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   subjects,
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: clusterMeta,
+			Rules:      clusterRules(flags),
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: clusterMeta,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+			Subjects:   subjects,
+		},
+		&corev1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: meta,
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports: []corev1.ServicePort{{
+					Name:       "https",
+					Port:       webhookServicePort,
+					TargetPort: intstr.FromString("https"),
+				}},
+			},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: meta,
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						ServiceAccountName: name,
+						SecurityContext: &corev1.PodSecurityContext{
+							RunAsNonRoot: &runAsNonRoot,
+							RunAsUser:    &runAsUser,
+						},
+						Containers: []corev1.Container{{
+							Name:  webhookContainerName,
+							Image: flags.image,
+							Args:  webhookArgs,
+							Ports: []corev1.ContainerPort{{Name: "https", ContainerPort: webhookPort}},
+							ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+								HTTPGet: &corev1.HTTPGetAction{
+									Path:   healthzPath,
+									Port:   intstr.FromString("https"),
+									Scheme: corev1.URISchemeHTTPS,
+								},
+							}},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("32Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("128Mi"),
+								},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+								ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+								Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+							},
+							VolumeMounts: []corev1.VolumeMount{{Name: "cache", MountPath: webhookImageCacheDir}},
+						}},
+						Volumes: []corev1.Volume{{
+							Name:         "cache",
+							VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+						}},
+					},
+				},
+			},
+		},
+		// the caBundle is patched by the webhook once it has generated its certificate
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "admissionregistration.k8s.io/v1",
+				Kind:       "MutatingWebhookConfiguration",
+			},
+			ObjectMeta: metav1.ObjectMeta{Name: defaultWebhookConfigurationName, Labels: labels},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{{
+				Name: "kueueleuleu.norbjd.github.io",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Namespace: flags.namespace,
+						Name:      name,
+						Path:      &path,
+						Port:      &servicePort,
+					},
+				},
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{""},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"pods"},
+							Scope:       &namespacedScope,
+						},
+					},
+					{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{"batch"},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"jobs", "cronjobs"},
+							Scope:       &namespacedScope,
+						},
+					},
+				},
+				ObjectSelector:          objectSelector,
+				NamespaceSelector:       namespaceSelector,
+				FailurePolicy:           &failurePolicy,
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+				AdmissionReviewVersions: []string{"v1"},
+			}},
+		},
+	}
+}
+
+// clusterRules - the webhook patches the caBundle of its configuration, and reads policy ConfigMaps
+// (which can't be listed by name).
+func clusterRules(flags installFlags) []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{{
+		APIGroups:     []string{admissionregistrationv1.GroupName},
+		Resources:     []string{"mutatingwebhookconfigurations"},
+		ResourceNames: []string{defaultWebhookConfigurationName},
+		Verbs:         []string{"get", "update"},
+	}}
+
+	if flags.policyConfigMap != "" {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "list", "watch"},
+		})
+	}
+
+	return rules
+}
+
+// webhookSelectors - returns the object and namespace selectors of the webhook: only labelled objects are sent
+// to the webhook, unless -send-all-objects is set. Then, objects of kube-system and of the webhook namespace are
+// never sent, so the webhook can't prevent itself nor the cluster from working.
+func webhookSelectors(flags installFlags) (*metav1.LabelSelector, *metav1.LabelSelector) {
+	if !flags.sendAllObjects {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{webhook.OptInKey: "true"}}, nil
+	}
+
+	objectSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+		Key:      webhook.OptInKey,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{"false"},
+	}}}
+	namespaceSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+		Key:      corev1.LabelMetadataName,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{metav1.NamespaceSystem, flags.namespace},
+	}}}
+
+	return objectSelector, namespaceSelector
+}
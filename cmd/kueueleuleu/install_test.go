@@ -0,0 +1,156 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/install_output.yaml
+var installExpectedOutput string
+
+func parseInstallFlags(t *testing.T, args ...string) (installFlags, *flag.FlagSet) {
+	t.Helper()
+
+	var flags installFlags
+
+	flagSet := flag.NewFlagSet(installSubcommand, flag.ContinueOnError)
+	flags.register(flagSet)
+	require.NoError(t, flagSet.Parse(args))
+
+	return flags, flagSet
+}
+
+func Test_renderInstall(t *testing.T) {
+	t.Parallel()
+
+	flags, flagSet := parseInstallFlags(t, "-render", "-image", "registry.example.com/kueueleuleu:1.0.0",
+		"-n", "test-ns", "-step-timeout", "build=10m", "-image-pull-secret", "registry")
+	require.NoError(t, flags.validate())
+
+	webhookArgs, err := flags.webhookArgs(flagSet)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, renderInstall(&out, flags, webhookArgs))
+	assert.Equal(t, installExpectedOutput, out.String())
+}
+
+func Test_installFlags_webhookArgs(t *testing.T) {
+	t.Parallel()
+
+	flags, flagSet := parseInstallFlags(t, "-render", "-image", "image", "-image-pull-secret", "a",
+		"-image-pull-secret", "b", "-resolve-commands", "-prepare-limits", "", "-replicas", "3")
+
+	webhookArgs, err := flags.webhookArgs(flagSet)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"webhook",
+		"-namespace=kueueleuleu-system",
+		"-addr=:8443",
+		"-self-signed-secret=kueueleuleu-webhook-tls",
+		"-service=kueueleuleu-webhook",
+		"-webhook-configuration=kueueleuleu",
+		"-image-pull-secret=a",
+		"-image-pull-secret=b",
+		"-prepare-limits=",
+		"-resolve-commands=true",
+		"-image-cache-dir=/var/cache/kueueleuleu",
+	}, webhookArgs)
+
+	// the webhook must accept its arguments
+	var parsedWebhookFlags webhookFlags
+
+	webhookFlagSet := flag.NewFlagSet(webhookSubcommand, flag.ContinueOnError)
+	parsedWebhookFlags.register(webhookFlagSet)
+	require.NoError(t, webhookFlagSet.Parse(webhookArgs[1:]))
+	require.NoError(t, parsedWebhookFlags.validate())
+	assert.Equal(t, []string{"a", "b"}, parsedWebhookFlags.imagePullSecrets.values)
+	assert.Equal(t, "kueueleuleu-system", parsedWebhookFlags.namespace)
+
+	flags, flagSet = parseInstallFlags(t, "-render", "-image", "image", "-image-commands-file", "commands.yaml")
+	_, err = flags.webhookArgs(flagSet)
+	require.ErrorIs(t, err, errInvalidFlag)
+}
+
+func Test_installFlags_validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args     []string
+		expected error
+	}{
+		{args: []string{"-render", "-image", "image"}},
+		{args: []string{"-image", "image"}, expected: errRenderRequired},
+		{args: []string{"-render"}, expected: errInvalidFlag},
+		{args: []string{"-render", "-image", "image", "-n", ""}, expected: errInvalidFlag},
+		{args: []string{"-render", "-image", "image", "-replicas", "0"}, expected: errInvalidFlag},
+		{args: []string{"-render", "-image", "image", "-step-timeout", "build"}, expected: errInvalidFlag},
+	}
+
+	for _, testCase := range tests {
+		flags, _ := parseInstallFlags(t, testCase.args...)
+		assert.ErrorIs(t, flags.validate(), testCase.expected, testCase.args)
+	}
+}
+
+func Test_installObjects_policies(t *testing.T) {
+	t.Parallel()
+
+	flags, flagSet := parseInstallFlags(t, "-render", "-image", "image", "-policy-configmap", "kueueleuleu-policy",
+		"-send-all-objects")
+
+	webhookArgs, err := flags.webhookArgs(flagSet)
+	require.NoError(t, err)
+	assert.Contains(t, webhookArgs, "-policy-configmap=kueueleuleu-policy")
+
+	var out bytes.Buffer
+	require.NoError(t, renderInstall(&out, flags, webhookArgs))
+
+	// the webhook can read policies
+	assert.Contains(t, out.String(), `
+  resources:
+  - configmaps
+  verbs:
+  - get
+  - list
+  - watch
+`)
+
+	// all objects are sent to the webhook, except the ones opting out, and the ones of system namespaces
+	assert.Contains(t, out.String(), `
+  namespaceSelector:
+    matchExpressions:
+    - key: kubernetes.io/metadata.name
+      operator: NotIn
+      values:
+      - kube-system
+      - kueueleuleu-system
+  objectSelector:
+    matchExpressions:
+    - key: norbjd.github.io/kueueleuleu-inject
+      operator: NotIn
+      values:
+      - "false"
+`)
+}
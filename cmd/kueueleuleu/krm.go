@@ -0,0 +1,360 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	fnSubcommand = "fn"
+
+	resourceListKind = "ResourceList"
+
+	severityError = "error"
+
+	// annotations set by kustomize and kpt on items, to report the file of objects in results
+	pathAnnotation         = "config.kubernetes.io/path"
+	indexAnnotation        = "config.kubernetes.io/index"
+	internalPathAnnotation = "internal.config.kubernetes.io/path"
+	internalIdxAnnotation  = "internal.config.kubernetes.io/index"
+)
+
+var errInvalidResourceList = errors.New("invalid ResourceList")
+
+type fnFlags struct {
+	convertFlags
+	kinds         string
+	labelSelector string
+}
+
+func (f *fnFlags) register(flagSet *flag.FlagSet) {
+	f.convertFlags.register(flagSet)
+	flagSet.StringVar(&f.kinds, "kinds", "Pod,Job,CronJob", "comma-separated kinds of the objects to convert")
+	flagSet.StringVar(&f.labelSelector, "label-selector", "",
+		"only convert objects matching this label selector, e.g. app=batch")
+}
+
+// krmResult - a result of a KRM function, reported by kustomize and kpt.
+type krmResult struct {
+	Message     string          `yaml:"message"`
+	Severity    string          `yaml:"severity"`
+	ResourceRef *krmResourceRef `yaml:"resourceRef,omitempty"`
+	File        *krmFile        `yaml:"file,omitempty"`
+}
+
+type krmResourceRef struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace,omitempty"`
+}
+
+type krmFile struct {
+	Path  string `yaml:"path"`
+	Index int    `yaml:"index,omitempty"`
+}
+
+// krmItemMeta - the fields of items needed to decide whether to convert them.
+type krmItemMeta struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace"`
+		Labels      map[string]string `yaml:"labels"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+func (m krmItemMeta) resourceRef() *krmResourceRef {
+	return &krmResourceRef{
+		APIVersion: m.APIVersion,
+		Kind:       m.Kind,
+		Name:       m.Metadata.Name,
+		Namespace:  m.Metadata.Namespace,
+	}
+}
+
+func (m krmItemMeta) file() *krmFile {
+	path := m.Metadata.Annotations[internalPathAnnotation]
+	index := m.Metadata.Annotations[internalIdxAnnotation]
+
+	if path == "" {
+		path = m.Metadata.Annotations[pathAnnotation]
+		index = m.Metadata.Annotations[indexAnnotation]
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	file := &krmFile{Path: path}
+	file.Index, _ = strconv.Atoi(index)
+
+	return file
+}
+
+// krmFunctionConfig - the functionConfig of the ResourceList: a ConfigMap whose data keys are flags of fn.
+type krmFunctionConfig struct {
+	Kind string            `yaml:"kind"`
+	Data map[string]string `yaml:"data"`
+}
+
+func fnMain(args []string) {
+	var flags fnFlags
+
+	flagSet := flag.NewFlagSet(fnSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %[1]s %[2]s [OPTIONS]
+Run as a KRM function (e.g. with kustomize or kpt): read a ResourceList from stdin, convert its Pods, Jobs
+and CronJobs, and write the ResourceList to stdout. Other objects are passed through untouched. Objects that
+can't be converted are reported in results, and the exit code is 1.
+Options can also be set in the functionConfig, a ConfigMap whose data keys are options without the leading
+dash (e.g. label-selector: app=batch, image-pull-secret: a,b).
+
+`, commandName(os.Args[0]), fnSubcommand)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	if len(parseInterspersed(flagSet, args)) != 0 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	hasErrors, err := runKRMFunction(os.Stdin, os.Stdout, flagSet, &flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if hasErrors {
+		os.Exit(1)
+	}
+}
+
+// runKRMFunction - converts the items of the ResourceList read from r, and writes it to w with results.
+// It returns whether there are error results.
+func runKRMFunction(r io.Reader, w io.Writer, flagSet *flag.FlagSet, flags *fnFlags) (bool, error) {
+	var document yaml.Node
+
+	err := yaml.NewDecoder(r).Decode(&document)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errInvalidResourceList, err)
+	}
+
+	if document.Kind != yaml.DocumentNode || len(document.Content) != 1 ||
+		document.Content[0].Kind != yaml.MappingNode {
+		return false, fmt.Errorf("%w: not a YAML object", errInvalidResourceList)
+	}
+
+	resourceList := document.Content[0]
+
+	var meta krmItemMeta
+	if err = resourceList.Decode(&meta); err != nil || meta.Kind != resourceListKind {
+		return false, fmt.Errorf("%w: kind is not %s", errInvalidResourceList, resourceListKind)
+	}
+
+	var results []krmResult
+
+	err = applyFunctionConfig(mappingValue(resourceList, "functionConfig"), flagSet)
+	if err == nil {
+		results, err = convertKRMItems(mappingValue(resourceList, "items"), flags)
+	}
+
+	if err != nil {
+		results = append(results, krmResult{Message: err.Error(), Severity: severityError})
+	}
+
+	err = appendResults(resourceList, results)
+	if err != nil {
+		return false, err
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(yamlIndent)
+
+	err = encoder.Encode(&document)
+	if err != nil {
+		return false, fmt.Errorf("cannot write ResourceList: %w", err)
+	}
+
+	return len(results) > 0, encoder.Close() //nolint:wrapcheck
+}
+
+// mappingValue - returns the value of key in the mapping node, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// applyFunctionConfig - sets the flags listed in the data of the functionConfig, if any.
+func applyFunctionConfig(functionConfigNode *yaml.Node, flagSet *flag.FlagSet) error {
+	if functionConfigNode == nil || functionConfigNode.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var functionConfig krmFunctionConfig
+
+	err := functionConfigNode.Decode(&functionConfig)
+	if err != nil {
+		return fmt.Errorf("invalid functionConfig: %w", err)
+	}
+
+	if functionConfig.Kind != "ConfigMap" {
+		return fmt.Errorf("invalid functionConfig: kind must be ConfigMap, got %q", functionConfig.Kind)
+	}
+
+	for key, value := range functionConfig.Data {
+		if flagSet.Lookup(key) == nil {
+			return fmt.Errorf("invalid functionConfig: unknown option %q", key)
+		}
+
+		values := []string{value}
+		if key == "image-pull-secret" {
+			values = strings.Split(value, ",")
+		}
+
+		for _, value := range values {
+			err = flagSet.Set(key, value)
+			if err != nil {
+				return fmt.Errorf("invalid functionConfig: %s: %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// convertKRMItems - converts the selected items in place, and returns results for the ones that can't be converted.
+func convertKRMItems(items *yaml.Node, flags *fnFlags) ([]krmResult, error) {
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := labels.Parse(flags.labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: -label-selector: %w", errInvalidFlag, err)
+	}
+
+	kinds := map[string]bool{}
+	for _, kind := range strings.Split(flags.kinds, ",") {
+		kinds[strings.TrimSpace(kind)] = true
+	}
+
+	var results []krmResult
+
+	for _, item := range items.Content {
+		var meta krmItemMeta
+		if item.Decode(&meta) != nil || !kinds[meta.Kind] || !selector.Matches(labels.Set(meta.Metadata.Labels)) {
+			continue
+		}
+
+		var typedObject metav1.Common
+
+		switch [2]string{meta.APIVersion, meta.Kind} {
+		case [2]string{"v1", "Pod"}:
+			typedObject = &corev1.Pod{}
+		case [2]string{"batch/v1", "Job"}:
+			typedObject = &batchv1.Job{}
+		case [2]string{"batch/v1", "CronJob"}:
+			typedObject = &batchv1.CronJob{}
+		default:
+			continue
+		}
+
+		err = convertKRMItem(item, typedObject, func(t metav1.Common) (metav1.Common, error) {
+			return convertWithRightMethod(t, opts...)
+		})
+		if err != nil {
+			results = append(results, krmResult{
+				Message:     strings.ReplaceAll(err.Error(), "\n", "; "),
+				Severity:    severityError,
+				ResourceRef: meta.resourceRef(),
+				File:        meta.file(),
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// convertKRMItem - edits the item with the changes of the transformation (see transformNode).
+// Unchanged objects are left untouched.
+func convertKRMItem(item *yaml.Node, typedObject metav1.Common, transform transformFunc) error {
+	_, err := transformNode(item, typedObject, transform)
+
+	return err
+}
+
+// appendResults - appends results to the results of the ResourceList (e.g. of previous functions).
+func appendResults(resourceList *yaml.Node, results []krmResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	var resultsNode yaml.Node
+
+	err := resultsNode.Encode(results)
+	if err != nil {
+		return fmt.Errorf("cannot encode results: %w", err)
+	}
+
+	existing := mappingValue(resourceList, "results")
+	if existing != nil && existing.Kind == yaml.SequenceNode {
+		existing.Content = append(existing.Content, resultsNode.Content...)
+
+		return nil
+	}
+
+	// e.g. "results: null" or "results: {}": replaced, as a second results key would be rejected
+	if existing != nil {
+		resultsNode.HeadComment = existing.HeadComment
+		resultsNode.LineComment = existing.LineComment
+		*existing = resultsNode
+
+		return nil
+	}
+
+	resourceList.Content = append(resourceList.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "results"}, &resultsNode)
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed testdata/krm_output.yaml
+var krmExpectedOutput string
+
+func runKRMFunctionWithArgs(t *testing.T, input string, args ...string) (string, bool, error) {
+	t.Helper()
+
+	var flags fnFlags
+
+	flagSet := flag.NewFlagSet(fnSubcommand, flag.ContinueOnError)
+	flags.register(flagSet)
+	require.NoError(t, flagSet.Parse(args))
+
+	var out bytes.Buffer
+	hasErrors, err := runKRMFunction(strings.NewReader(input), &out, flagSet, &flags)
+
+	return out.String(), hasErrors, err
+}
+
+func Test_runKRMFunction(t *testing.T) {
+	t.Parallel()
+
+	input, err := os.ReadFile("testdata/krm_input.yaml")
+	require.NoError(t, err)
+
+	output, hasErrors, err := runKRMFunctionWithArgs(t, string(input))
+	require.NoError(t, err)
+	assert.True(t, hasErrors)
+	assert.Equal(t, krmExpectedOutput, output)
+}
+
+func Test_runKRMFunction_flags(t *testing.T) {
+	t.Parallel()
+
+	input := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: pod
+  spec:
+    containers:
+    - name: step1
+      image: busybox
+      command: [echo]
+- apiVersion: batch/v1
+  kind: Job
+  metadata:
+    name: job
+  spec:
+    template:
+      spec:
+        containers:
+        - name: step1
+          image: busybox
+          command: [echo]
+`
+
+	// only jobs are converted
+	output, hasErrors, err := runKRMFunctionWithArgs(t, input, "-kinds", "Job")
+	require.NoError(t, err)
+	assert.False(t, hasErrors)
+	assert.NotContains(t, output, "results:")
+	assert.Equal(t, 1, strings.Count(output, "kueueleuleu-prepare"))
+	assert.Contains(t, output, `    metadata:
+      name: pod
+`)
+
+	// the functionConfig takes precedence over flags
+	output, _, err = runKRMFunctionWithArgs(t, input+`functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  data:
+    kinds: Pod,Job
+`, "-kinds", "Job")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(output, "kueueleuleu-prepare"))
+}
+
+func Test_runKRMFunction_existingResults(t *testing.T) {
+	t.Parallel()
+
+	input := `apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: pod
+  spec:
+    containers:
+    - name: step1
+      image: busybox
+`
+
+	for name, testCase := range map[string]struct {
+		results          string
+		expectedMessages []string
+	}{
+		"null":  {results: "results: null", expectedMessages: []string{"container does not have a command"}},
+		"empty": {results: "results: {}", expectedMessages: []string{"container does not have a command"}},
+		"sequence": {
+			results:          "results:\n- message: from a previous function\n  severity: info",
+			expectedMessages: []string{"from a previous function", "container does not have a command"},
+		},
+	} {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			output, hasErrors, err := runKRMFunctionWithArgs(t, input+testCase.results+"\n")
+			require.NoError(t, err)
+			assert.True(t, hasErrors)
+
+			// duplicate keys are rejected
+			var resourceList struct {
+				Results []struct {
+					Message string `yaml:"message"`
+				} `yaml:"results"`
+			}
+			require.NoError(t, yaml.Unmarshal([]byte(output), &resourceList))
+
+			messages := make([]string, 0, len(resourceList.Results))
+			for _, result := range resourceList.Results {
+				messages = append(messages, result.Message)
+			}
+
+			require.Len(t, messages, len(testCase.expectedMessages))
+
+			for i, expectedMessage := range testCase.expectedMessages {
+				assert.Contains(t, messages[i], expectedMessage)
+			}
+		})
+	}
+}
+
+func Test_runKRMFunction_invalidFunctionConfig(t *testing.T) {
+	t.Parallel()
+
+	input, err := os.ReadFile("testdata/krm_input.yaml")
+	require.NoError(t, err)
+
+	for functionConfig, expectedMessage := range map[string]string{
+		"kind: ConfigMap\ndata:\n  unknown: value":        `invalid functionConfig: unknown option "unknown"`,
+		"kind: ConfigMap\ndata:\n  already-converted: no": `-already-converted: no`,
+		"kind: Kueueleuleu\nspec: {}":                     `kind must be ConfigMap, got "Kueueleuleu"`,
+	} {
+		withFunctionConfig, _, _ := strings.Cut(string(input), "functionConfig:")
+		withFunctionConfig += "functionConfig:\n  " + strings.ReplaceAll(functionConfig, "\n", "\n  ") + "\n"
+
+		output, hasErrors, err := runKRMFunctionWithArgs(t, withFunctionConfig)
+		require.NoError(t, err)
+		assert.True(t, hasErrors)
+		assert.Contains(t, output, expectedMessage)
+
+		// items are untouched
+		assert.NotContains(t, output, "kueueleuleu-prepare")
+	}
+}
+
+func Test_runKRMFunction_invalidInput(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"", "not a ResourceList", "- a\n- b", "apiVersion: v1\nkind: ConfigMap"} {
+		_, _, err := runKRMFunctionWithArgs(t, input)
+		require.ErrorIs(t, err, errInvalidResourceList, input)
+	}
+}
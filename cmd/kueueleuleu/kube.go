@@ -0,0 +1,81 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeFlags - flags of subcommands talking to a cluster, similar to kubectl ones, so the binary can be used
+// as a kubectl plugin.
+type kubeFlags struct {
+	kubeconfig string
+	context    string
+	namespace  string
+	as         string
+	asGroups   stringsFlag
+}
+
+func (f *kubeFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&f.kubeconfig, "kubeconfig", "",
+		"path to the kubeconfig file (default: $KUBECONFIG or ~/.kube/config)")
+	flagSet.StringVar(&f.context, "context", "", "kubeconfig context to use (default: the current context)")
+	flagSet.StringVar(&f.namespace, "namespace", "", "namespace (default: the namespace of the context)")
+	flagSet.StringVar(&f.namespace, "n", "", "shorthand for -namespace")
+	flagSet.StringVar(&f.as, "as", "", "user to impersonate")
+	flagSet.Var(&f.asGroups, "as-group", "group to impersonate, can be repeated")
+}
+
+func (f *kubeFlags) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = f.kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: f.context,
+	}
+	overrides.Context.Namespace = f.namespace
+	overrides.AuthInfo.Impersonate = f.as
+	overrides.AuthInfo.ImpersonateGroups = f.asGroups.values
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// client - returns a client for the cluster, and the namespace to use.
+func (f *kubeFlags) client() (kubernetes.Interface, string, error) {
+	clientConfig := f.clientConfig()
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot get namespace from kubeconfig: %w", err)
+	}
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot load kubeconfig: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot create kubernetes client: %w", err)
+	}
+
+	return client, namespace, nil
+}
@@ -0,0 +1,117 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: user
+  user:
+    token: dummy
+contexts:
+- name: dev
+  context:
+    cluster: cluster
+    user: user
+    namespace: dev
+- name: prod
+  context:
+    cluster: cluster
+    user: user
+current-context: dev
+`
+
+func Test_kubeFlags(t *testing.T) {
+	t.Parallel()
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600))
+
+	tests := []struct {
+		flags             kubeFlags
+		expectedNamespace string
+	}{
+		{
+			flags:             kubeFlags{kubeconfig: kubeconfig},
+			expectedNamespace: "dev",
+		},
+		{
+			flags:             kubeFlags{kubeconfig: kubeconfig, namespace: "other"},
+			expectedNamespace: "other",
+		},
+		{
+			flags:             kubeFlags{kubeconfig: kubeconfig, context: "prod"},
+			expectedNamespace: "default",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.expectedNamespace, func(t *testing.T) {
+			t.Parallel()
+
+			client, namespace, err := test.flags.client()
+			require.NoError(t, err)
+			assert.NotNil(t, client)
+			assert.Equal(t, test.expectedNamespace, namespace)
+		})
+	}
+
+	unknownContextFlags := kubeFlags{kubeconfig: kubeconfig, context: "unknown"}
+
+	_, _, err := unknownContextFlags.client()
+	require.Error(t, err)
+}
+
+func Test_kubeFlags_kubectlStyle(t *testing.T) {
+	t.Parallel()
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600))
+
+	var flags kubeFlags
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.register(flagSet)
+	require.NoError(t, flagSet.Parse([]string{
+		"--kubeconfig", kubeconfig, "--context=prod", "-n", "team", "--as", "jane", "--as-group", "devs",
+	}))
+
+	_, namespace, err := flags.client()
+	require.NoError(t, err)
+	assert.Equal(t, "team", namespace)
+
+	restConfig, err := flags.clientConfig().ClientConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "jane", restConfig.Impersonate.UserName)
+	assert.Equal(t, []string{"devs"}, restConfig.Impersonate.Groups)
+}
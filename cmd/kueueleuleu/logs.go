@@ -0,0 +1,127 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/norbjd/kueueleuleu"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	logsSubcommand = "logs"
+	outputDirPerm  = 0o755
+)
+
+type logsFlags struct {
+	kubeFlags
+	follow         bool
+	includePrepare bool
+	outputDir      string
+}
+
+func (f *logsFlags) register(flagSet *flag.FlagSet) {
+	f.kubeFlags.register(flagSet)
+	flagSet.BoolVar(&f.follow, "follow", false,
+		"follow the logs: the running step, then the next ones when they start, until the pod finishes")
+	flagSet.BoolVar(&f.follow, "f", false, "shorthand for -follow")
+	flagSet.BoolVar(&f.includePrepare, "include-prepare", false,
+		"also print the logs of the internal init container copying the tekton entrypoint")
+	flagSet.StringVar(&f.outputDir, "output-dir", "",
+		"write the logs of each container to DIR/<container>.log instead of stdout")
+}
+
+func (f *logsFlags) options() []kueueleuleu.LogsOption {
+	opts := make([]kueueleuleu.LogsOption, 0)
+
+	if f.follow {
+		opts = append(opts, kueueleuleu.WithFollow())
+	}
+
+	if f.includePrepare {
+		opts = append(opts, kueueleuleu.WithPrepareContainerLogs())
+	}
+
+	if f.outputDir != "" {
+		opts = append(opts, kueueleuleu.WithStepLogsWriter(func(containerName string) (io.WriteCloser, error) {
+			return os.Create(filepath.Join(f.outputDir, containerName+".log")) //nolint:wrapcheck
+		}))
+	}
+
+	return opts
+}
+
+func logsMain(args []string) {
+	var flags logsFlags
+
+	flagSet := flag.NewFlagSet(logsSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %s %s [OPTIONS] POD
+Print the logs of a kueueleuleu pod, step after step, each line prefixed with the container name.
+
+`, commandName(os.Args[0]), logsSubcommand)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	podNames := parseInterspersed(flagSet, args)
+	if len(podNames) != 1 {
+		log.Println("exactly one pod name is expected")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	client, namespace, err := flags.client()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err = streamLogs(ctx, client, namespace, podNames[0], os.Stdout, flags)
+
+	stop()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func streamLogs(ctx context.Context, client kubernetes.Interface, namespace, podName string, w io.Writer,
+	flags logsFlags,
+) error {
+	if flags.outputDir != "" {
+		err := os.MkdirAll(flags.outputDir, outputDirPerm)
+		if err != nil {
+			return fmt.Errorf("cannot create output directory: %w", err)
+		}
+	}
+
+	err := kueueleuleu.StreamLogs(ctx, client, namespace, podName, w, flags.options()...)
+	if err != nil {
+		return fmt.Errorf("cannot stream logs: %w", err)
+	}
+
+	return nil
+}
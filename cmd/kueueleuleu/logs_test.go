@@ -0,0 +1,110 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func succeededPod(t *testing.T) *corev1.Pod {
+	t.Helper()
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "two-steps",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "first", Image: "alpine", Command: []string{"echo", "first"}},
+				{Name: "second", Image: "alpine", Command: []string{"echo", "second"}},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	})
+	require.NoError(t, err)
+
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		ExitCode:   0,
+		FinishedAt: metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+	}}
+
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "kueueleuleu-prepare", State: terminated},
+	}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "second", State: terminated},
+		{Name: "first", State: terminated},
+	}
+
+	return &pod
+}
+
+func Test_streamLogs(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(succeededPod(t))
+
+	var stdout bytes.Buffer
+
+	// the fake clientset returns "fake logs" as the logs of any container
+	err := streamLogs(context.Background(), client, "default", "two-steps", &stdout, logsFlags{})
+	require.NoError(t, err)
+	assert.Equal(t, "[first] fake logs\n[second] fake logs\n", stdout.String())
+
+	stdout.Reset()
+
+	err = streamLogs(context.Background(), client, "default", "two-steps", &stdout, logsFlags{includePrepare: true})
+	require.NoError(t, err)
+	assert.Equal(t, "[kueueleuleu-prepare] fake logs\n[first] fake logs\n[second] fake logs\n", stdout.String())
+}
+
+func Test_streamLogs_outputDir(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(succeededPod(t))
+	outputDir := filepath.Join(t.TempDir(), "logs")
+
+	var stdout bytes.Buffer
+
+	err := streamLogs(context.Background(), client, "default", "two-steps", &stdout, logsFlags{outputDir: outputDir})
+	require.NoError(t, err)
+	assert.Empty(t, stdout.String())
+
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	for _, containerName := range []string{"first", "second"} {
+		logs, err := os.ReadFile(filepath.Join(outputDir, containerName+".log"))
+		require.NoError(t, err)
+		assert.Equal(t, "fake logs", string(logs))
+	}
+}
@@ -17,12 +17,17 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/norbjd/kueueleuleu"
 	"gopkg.in/yaml.v3"
@@ -42,23 +47,89 @@ var (
 	treeState  = "unknown"
 )
 
+// documentSeparator - matches lines separating YAML documents, like helm does to split manifests.
+var documentSeparator = regexp.MustCompile(`^---(\s.*)?$`)
+
 var (
 	errMalformedK8sObject    = errors.New("malformed k8s object")
 	errUnknownK8sObject      = errors.New("unknown k8s object")
 	errUnsupportedConversion = errors.New("unsupported conversion")
 )
 
+const (
+	convertSubcommand = "convert"
+	revertSubcommand  = "revert"
+	// unsupportedKindsPassthrough - writes objects that cannot be converted unchanged.
+	unsupportedKindsPassthrough = "passthrough"
+	// unsupportedKindsFail - exits with an error on objects that cannot be converted.
+	unsupportedKindsFail = "fail"
+	// maxLineSize - the maximum size of a line of manifests (e.g. long descriptions of CRDs).
+	maxLineSize = 16 * 1024 * 1024
+	// kubectlPluginPrefix - the prefix of kubectl plugins binaries: kubectl runs kubectl-kueueleuleu
+	// for "kubectl kueueleuleu".
+	kubectlPluginPrefix = "kubectl-"
+)
+
+type transformFunc func(t metav1.Common) (metav1.Common, error)
+
 func main() {
 	var (
 		displayVersion bool
 		help           bool
+		convertFlags   convertFlags
 	)
 
+	args := os.Args[1:]
+	revert := false
+
+	if len(args) > 0 {
+		switch args[0] {
+		case convertSubcommand:
+			args = args[1:]
+		case revertSubcommand:
+			args = args[1:]
+			revert = true
+		case logsSubcommand:
+			logsMain(args[1:])
+
+			return
+		case statusSubcommand:
+			statusMain(args[1:])
+
+			return
+		case runSubcommand:
+			runMain(args[1:])
+
+			return
+		case webhookSubcommand:
+			webhookMain(args[1:])
+
+			return
+		case installSubcommand:
+			installMain(args[1:])
+
+			return
+		case fnSubcommand:
+			fnMain(args[1:])
+
+			return
+		case postRenderSubcommand:
+			postRenderMain(args[1:])
+
+			return
+		}
+	}
+
+	flag.Usage = usage
 	flag.BoolVar(&displayVersion, "version", false, "output version information and exit")
 	flag.BoolVar(&help, "help", false, "display this help and exit")
 
 	file := flag.String("f", "", "path to YAML file or - (stdin)")
-	flag.Parse()
+	unsupportedKinds := flag.String("unsupported-kinds", unsupportedKindsPassthrough,
+		"what to do with objects other than Pods, Jobs and CronJobs: "+
+			unsupportedKindsPassthrough+" (write them unchanged) or "+unsupportedKindsFail)
+	convertFlags.register(flag.CommandLine)
+	_ = flag.CommandLine.Parse(args) // errors are handled by flag.ExitOnError
 
 	if help {
 		displayUsageAndExit(0)
@@ -79,7 +150,68 @@ There is NO WARRANTY.
 		displayUsageAndExit(1)
 	}
 
-	convertYAML(*file, os.Stdout)
+	if *unsupportedKinds != unsupportedKindsPassthrough && *unsupportedKinds != unsupportedKindsFail {
+		log.Printf("%v: -unsupported-kinds must be %s or %s", errInvalidFlag, unsupportedKindsPassthrough,
+			unsupportedKindsFail)
+		displayUsageAndExit(1)
+	}
+
+	transform := transformFunc(revertWithRightMethod)
+	settings := transformSettings{
+		action:                 "reverted",
+		failOnUnsupportedKinds: *unsupportedKinds == unsupportedKindsFail,
+		summary:                os.Stderr,
+	}
+
+	if !revert {
+		settings.action = "converted"
+
+		opts, err := convertFlags.options()
+		if err != nil {
+			log.Println(err)
+			displayUsageAndExit(1)
+		}
+
+		transform = func(t metav1.Common) (metav1.Common, error) {
+			return convertWithRightMethod(t, opts...)
+		}
+	}
+
+	transformYAML(*file, os.Stdout, transform, settings)
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %[1]s [%[6]s] -f FILE
+  or:  %[1]s %[2]s -f FILE
+  or:  %[1]s %[3]s [OPTIONS] POD
+  or:  %[1]s %[4]s [OPTIONS] [pod/|job/|cronjob/]NAME
+  or:  %[1]s %[5]s [OPTIONS] -f FILE
+  or:  %[1]s %[7]s [OPTIONS] -tls-cert-file FILE -tls-key-file FILE
+  or:  %[1]s %[8]s -render -image IMAGE [OPTIONS]
+  or:  %[1]s %[9]s [OPTIONS] < RESOURCE_LIST
+  or:  %[1]s %[10]s [OPTIONS] < MANIFESTS
+Convert Pods, Jobs and CronJobs to run their containers sequentially,
+or revert objects previously converted back to their original form.
+Subcommands talking to a cluster display their own options with -help.
+
+`, commandName(os.Args[0]), revertSubcommand, logsSubcommand,
+		statusSubcommand, runSubcommand, convertSubcommand, webhookSubcommand, installSubcommand,
+		fnSubcommand, postRenderSubcommand)
+	flag.PrintDefaults()
+}
+
+// commandName - returns how the binary was invoked, for usage messages: "kubectl kueueleuleu" when it is used
+// as a kubectl plugin (i.e. the binary is named kubectl-kueueleuleu), or the binary name otherwise.
+func commandName(binaryPath string) string {
+	binaryName := strings.TrimSuffix(filepath.Base(binaryPath), ".exe")
+
+	pluginName, isPlugin := strings.CutPrefix(binaryName, kubectlPluginPrefix)
+	if !isPlugin {
+		return binaryName
+	}
+
+	// kubectl plugins names use underscores for dashes, e.g. kubectl-my_plugin for "kubectl my-plugin"
+	return "kubectl " + strings.ReplaceAll(pluginName, "_", "-")
 }
 
 func displayUsageAndExit(exitCode int) {
@@ -91,9 +223,19 @@ kueueleuleu home page: <https://github.com/norbjd/kueueleuleu>
 	os.Exit(exitCode)
 }
 
-func convertYAML(inputFilename string, w io.Writer) {
+func convertYAML(inputFilename string, w io.Writer, opts ...kueueleuleu.Option) {
+	transformYAML(inputFilename, w, func(t metav1.Common) (metav1.Common, error) {
+		return convertWithRightMethod(t, opts...)
+	}, transformSettings{action: "converted"})
+}
+
+func revertYAML(inputFilename string, w io.Writer) {
+	transformYAML(inputFilename, w, revertWithRightMethod, transformSettings{action: "reverted"})
+}
+
+func transformYAML(inputFilename string, w io.Writer, transform transformFunc, settings transformSettings) {
 	input := getInput(inputFilename)
-	convertReader(input, w)
+	transformReader(input, w, transform, settings)
 }
 
 func getInput(file string) io.Reader {
@@ -114,73 +256,185 @@ func getInput(file string) io.Reader {
 	return reader
 }
 
-func convertReader(reader io.Reader, out io.Writer) {
-	yamlDecoder := yaml.NewDecoder(reader)
+// transformSettings - how transformReader handles documents.
+type transformSettings struct {
+	// action - what the transformation does, in the summary (e.g. "converted").
+	action string
+	// failOnUnsupportedKinds - exit with an error on objects that are not Pods, Jobs or CronJobs, instead of
+	// writing them unchanged.
+	failOnUnsupportedKinds bool
+	// summary - where to write the summary of transformed and skipped objects, nil for no summary.
+	summary io.Writer
+}
 
-	var k8sObject map[string]interface{}
+// transformSummary - the objects transformed, already transformed, and skipped, in the order of the input.
+type transformSummary struct {
+	transformed []string
+	unchanged   []string
+	skipped     []string
+}
 
-	type meta struct {
-		apiVersion string
-		kind       string
+func (s transformSummary) write(w io.Writer, action string) {
+	for _, line := range []struct {
+		description string
+		objects     []string
+	}{
+		{description: action, objects: s.transformed},
+		{description: "unchanged (already " + action + ")", objects: s.unchanged},
+		{description: "skipped (unsupported kind)", objects: s.skipped},
+	} {
+		if len(line.objects) > 0 {
+			fmt.Fprintf(w, "%s %d: %s\n", line.description, len(line.objects), strings.Join(line.objects, ", "))
+		}
 	}
+}
+
+// transformReader - writes the documents of reader to out, with Pods, Jobs and CronJobs transformed. Other objects
+// are written verbatim (or make the transformation fail, see transformSettings), in the same order.
+func transformReader(reader io.Reader, out io.Writer, transform transformFunc, settings transformSettings) {
+	var summary transformSummary
 
-	for yamlDecoder.Decode(&k8sObject) == nil {
-		apiVersion, isString := k8sObject["apiVersion"].(string)
-		if !isString {
-			log.Fatal(fmt.Errorf("%w: apiVersion is not a string", errMalformedK8sObject))
+	err := splitDocuments(reader, func(document []byte) error {
+		var k8sObject map[string]interface{}
+
+		if err := yaml.Unmarshal(document, &k8sObject); err != nil {
+			return fmt.Errorf("%w: %w", errMalformedK8sObject, err)
 		}
 
-		kind, isString := k8sObject["kind"].(string)
-		if !isString {
-			log.Fatal(fmt.Errorf("%w: kind is not a string", errMalformedK8sObject))
+		if k8sObject == nil {
+			return nil // empty document
 		}
 
-		metaToConvert := meta{
-			apiVersion: apiVersion,
-			kind:       kind,
+		outputYAML, err := transformDocument(k8sObject, document, transform, settings, &summary)
+		if err != nil {
+			return err
 		}
 
-		var outputYAML []byte
+		_, err = out.Write(append([]byte("---\n"), outputYAML...))
 
-		var err error
+		return err //nolint:wrapcheck
+	}, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		switch metaToConvert {
-		case meta{apiVersion: "v1", kind: "Pod"}:
-			outputYAML, err = convertToYAML(k8sObject, &corev1.Pod{})
-		case meta{apiVersion: "batch/v1", kind: "Job"}:
-			outputYAML, err = convertToYAML(k8sObject, &batchv1.Job{})
-		case meta{apiVersion: "batch/v1", kind: "CronJob"}:
-			outputYAML, err = convertToYAML(k8sObject, &batchv1.CronJob{})
-		default:
-			err = fmt.Errorf("%w: (%v, %v)", errUnknownK8sObject, metaToConvert.apiVersion, metaToConvert.kind)
-		}
+	if settings.summary != nil {
+		summary.write(settings.summary, settings.action)
+	}
+}
 
-		if err != nil {
-			log.Fatal(err)
+// transformDocument - returns the document with the object transformed (see transformNode), or the document itself
+// if it is unchanged or if its kind is not supported, and records the object in the summary.
+func transformDocument(k8sObject map[string]interface{}, document []byte, transform transformFunc,
+	settings transformSettings, summary *transformSummary,
+) ([]byte, error) {
+	apiVersion, isString := k8sObject["apiVersion"].(string)
+	if !isString {
+		return nil, fmt.Errorf("%w: apiVersion is not a string", errMalformedK8sObject)
+	}
+
+	kind, isString := k8sObject["kind"].(string)
+	if !isString {
+		return nil, fmt.Errorf("%w: kind is not a string", errMalformedK8sObject)
+	}
+
+	objectName := kind
+
+	if metadata, isMap := k8sObject["metadata"].(map[string]interface{}); isMap {
+		if namespace, _ := metadata["namespace"].(string); namespace != "" {
+			objectName += " " + namespace + "/" + fmt.Sprint(metadata["name"])
+		} else {
+			objectName += " " + fmt.Sprint(metadata["name"])
 		}
+	}
 
-		_, err = out.Write(append([]byte("---\n"), outputYAML...))
-		if err != nil {
-			log.Fatal(err)
+	var typedK8sObject metav1.Common
+
+	switch [2]string{apiVersion, kind} {
+	case [2]string{"v1", "Pod"}:
+		typedK8sObject = &corev1.Pod{}
+	case [2]string{"batch/v1", "Job"}:
+		typedK8sObject = &batchv1.Job{}
+	case [2]string{"batch/v1", "CronJob"}:
+		typedK8sObject = &batchv1.CronJob{}
+	default:
+		if settings.failOnUnsupportedKinds {
+			return nil, fmt.Errorf("%w: (%v, %v)", errUnknownK8sObject, apiVersion, kind)
 		}
+
+		summary.skipped = append(summary.skipped, objectName)
+
+		return document, nil
 	}
-}
 
-func convertToYAML(k8sObject map[string]interface{}, typedK8sObject metav1.Common) ([]byte, error) {
-	kueueleuleuObject, err := convert(k8sObject, typedK8sObject)
+	var node yaml.Node
+
+	err := yaml.Unmarshal(document, &node)
 	if err != nil {
-		return nil, fmt.Errorf("cannot convert to kueueleuleu: %w", err)
+		return nil, fmt.Errorf("%w: %w", errMalformedK8sObject, err)
 	}
 
-	outputYAML, err := kyaml.Marshal(kueueleuleuObject)
+	changed, err := transformNode(node.Content[0], typedK8sObject, transform)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read YAML: %w", err)
+		return nil, fmt.Errorf("cannot transform k8s object: %w", err)
 	}
 
-	return outputYAML, nil
+	if !changed {
+		summary.unchanged = append(summary.unchanged, objectName)
+
+		return document, nil
+	}
+
+	summary.transformed = append(summary.transformed, objectName)
+
+	return encodeNode(&node)
 }
 
-func convert(k8sObject map[string]interface{}, typedK8sObject metav1.Common) (metav1.Common, error) {
+// splitDocuments - calls handleDocument with each document of the YAML stream, and handleSeparator (if not nil)
+// with the lines separating them (e.g. "---"). Documents include their comments.
+func splitDocuments(reader io.Reader, handleDocument func(document []byte) error,
+	handleSeparator func(line []byte) error,
+) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxLineSize)
+
+	var document bytes.Buffer
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		if !documentSeparator.Match(line) {
+			document.Write(line)
+			document.WriteByte('\n')
+
+			continue
+		}
+
+		err := handleDocument(document.Bytes())
+		if err != nil {
+			return err
+		}
+
+		document.Reset()
+
+		if handleSeparator != nil {
+			err = handleSeparator(line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read YAML: %w", err)
+	}
+
+	return handleDocument(document.Bytes())
+}
+
+func transformObject(k8sObject map[string]interface{}, typedK8sObject metav1.Common,
+	transform transformFunc,
+) (metav1.Common, error) {
 	k8sObjectYAML, err := kyaml.Marshal(k8sObject)
 	if err != nil {
 		return nil, fmt.Errorf("internal error: %w", err)
@@ -191,32 +445,32 @@ func convert(k8sObject map[string]interface{}, typedK8sObject metav1.Common) (me
 		return nil, fmt.Errorf("cannot read YAML: %w", err)
 	}
 
-	converted, err := convertWithRightMethod(typedK8sObject)
+	transformed, err := transform(typedK8sObject)
 	if err != nil {
-		return nil, fmt.Errorf("cannot convert k8s object: %w", err)
+		return nil, err
 	}
 
-	return converted, err
+	return transformed, nil
 }
 
-func convertWithRightMethod(t metav1.Common) (metav1.Common, error) {
+func convertWithRightMethod(t metav1.Common, opts ...kueueleuleu.Option) (metav1.Common, error) {
 	switch tTyped := t.(type) {
 	case *corev1.Pod:
-		c, err := kueueleuleu.ConvertPod(*tTyped)
+		c, err := kueueleuleu.ConvertPod(*tTyped, opts...)
 		if err != nil {
 			err = fmt.Errorf("cannot convert pod: %w", err)
 		}
 
 		return &c, err
 	case *batchv1.Job:
-		c, err := kueueleuleu.ConvertJob(*tTyped)
+		c, err := kueueleuleu.ConvertJob(*tTyped, opts...)
 		if err != nil {
 			err = fmt.Errorf("cannot convert job: %w", err)
 		}
 
 		return &c, err
 	case *batchv1.CronJob:
-		c, err := kueueleuleu.ConvertCronJob(*tTyped)
+		c, err := kueueleuleu.ConvertCronJob(*tTyped, opts...)
 		if err != nil {
 			err = fmt.Errorf("cannot convert cronjob: %w", err)
 		}
@@ -226,3 +480,31 @@ func convertWithRightMethod(t metav1.Common) (metav1.Common, error) {
 		return nil, errUnsupportedConversion
 	}
 }
+
+func revertWithRightMethod(t metav1.Common) (metav1.Common, error) {
+	switch tTyped := t.(type) {
+	case *corev1.Pod:
+		r, err := kueueleuleu.RevertPod(*tTyped)
+		if err != nil {
+			err = fmt.Errorf("cannot revert pod: %w", err)
+		}
+
+		return &r, err
+	case *batchv1.Job:
+		r, err := kueueleuleu.RevertJob(*tTyped)
+		if err != nil {
+			err = fmt.Errorf("cannot revert job: %w", err)
+		}
+
+		return &r, err
+	case *batchv1.CronJob:
+		r, err := kueueleuleu.RevertCronJob(*tTyped)
+		if err != nil {
+			err = fmt.Errorf("cannot revert cronjob: %w", err)
+		}
+
+		return &r, err
+	default:
+		return nil, errUnsupportedConversion
+	}
+}
@@ -19,11 +19,19 @@ package main
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"io"
+	"os"
 	"testing"
 
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/imageconfig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
@@ -35,6 +43,25 @@ var (
 	podAndJobExpectedOutput string
 	//go:embed testdata/pod_output.yaml
 	podExpectedOutput string
+	//go:embed testdata/pod_without_command_output.yaml
+	podWithoutCommandExpectedOutput string
+	//go:embed testdata/mixed_kinds_output.yaml
+	mixedKindsExpectedOutput string
+	//go:embed testdata/newer_api_output.yaml
+	newerAPIExpectedOutput string
+	//go:embed testdata/formatting_output.yaml
+	formattingExpectedOutput string
+
+	//go:embed testdata/cronjob_reverted.yaml
+	cronjobExpectedReverted string
+	//go:embed testdata/job_reverted.yaml
+	jobExpectedReverted string
+	//go:embed testdata/pod_and_job_reverted.yaml
+	podAndJobExpectedReverted string
+	//go:embed testdata/pod_reverted.yaml
+	podExpectedReverted string
+	//go:embed testdata/newer_api_reverted.yaml
+	newerAPIExpectedReverted string
 )
 
 func Test_convertYAMLToStdout(t *testing.T) {
@@ -60,6 +87,10 @@ func Test_convertYAMLToStdout(t *testing.T) {
 			inputFilename: "testdata/pod_input.yaml",
 			expected:      podExpectedOutput,
 		},
+		{
+			inputFilename: "testdata/formatting_input.yaml",
+			expected:      formattingExpectedOutput,
+		},
 	}
 
 	for _, testCase := range tests {
@@ -79,3 +110,246 @@ func Test_convertYAMLToStdout(t *testing.T) {
 		})
 	}
 }
+
+func Test_convertYAMLToStdout_withImageCommandsFile(t *testing.T) {
+	t.Parallel()
+
+	resolver, err := imageconfig.LoadMappingFile("testdata/image_commands.yaml")
+	require.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+
+	convertYAML("testdata/pod_without_command_input.yaml", buffer, kueueleuleu.WithCommandResolver(resolver))
+
+	got, err := io.ReadAll(buffer)
+	require.NoError(t, err)
+
+	assert.Equal(t, podWithoutCommandExpectedOutput, string(got))
+}
+
+func Test_convertYAMLToStdout_alreadyConverted(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		inputFilename string
+		expected      string
+	}{
+		{
+			inputFilename: "testdata/cronjob_output.yaml",
+			expected:      cronjobExpectedOutput,
+		},
+		{
+			inputFilename: "testdata/job_output.yaml",
+			expected:      jobExpectedOutput,
+		},
+		{
+			inputFilename: "testdata/pod_and_job_output.yaml",
+			expected:      podAndJobExpectedOutput,
+		},
+		{
+			inputFilename: "testdata/pod_output.yaml",
+			expected:      podExpectedOutput,
+		},
+		{
+			inputFilename: "testdata/formatting_output.yaml",
+			expected:      formattingExpectedOutput,
+		},
+	}
+
+	policies := []kueueleuleu.AlreadyConvertedPolicy{
+		kueueleuleu.AlreadyConvertedSkip,
+		kueueleuleu.AlreadyConvertedReconvert,
+	}
+
+	for _, testCase := range tests {
+		testCase := testCase
+
+		for _, policy := range policies {
+			policy := policy
+
+			t.Run(testCase.inputFilename, func(t *testing.T) {
+				t.Parallel()
+
+				buffer := &bytes.Buffer{}
+
+				convertYAML(testCase.inputFilename, buffer, kueueleuleu.WithAlreadyConvertedPolicy(policy))
+
+				got, err := io.ReadAll(buffer)
+				require.NoError(t, err)
+
+				assert.Equal(t, testCase.expected, string(got))
+			})
+		}
+	}
+}
+
+func Test_revertYAMLToStdout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		inputFilename string
+		expected      string
+	}{
+		{
+			inputFilename: "testdata/cronjob_output.yaml",
+			expected:      cronjobExpectedReverted,
+		},
+		{
+			inputFilename: "testdata/job_output.yaml",
+			expected:      jobExpectedReverted,
+		},
+		{
+			inputFilename: "testdata/pod_and_job_output.yaml",
+			expected:      podAndJobExpectedReverted,
+		},
+		{
+			inputFilename: "testdata/pod_output.yaml",
+			expected:      podExpectedReverted,
+		},
+	}
+
+	for _, testCase := range tests {
+		testCase := testCase
+
+		t.Run(testCase.inputFilename, func(t *testing.T) {
+			t.Parallel()
+
+			buffer := &bytes.Buffer{}
+
+			revertYAML(testCase.inputFilename, buffer)
+
+			got, err := io.ReadAll(buffer)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expected, string(got))
+		})
+	}
+}
+
+// Test_convertYAMLToStdout_newerAPIFields - fields unknown to the Kubernetes API kueueleuleu is built with (e.g.
+// native sidecars, image volumes, or the status) must survive the conversion and the revert.
+func Test_convertYAMLToStdout_newerAPIFields(t *testing.T) {
+	t.Parallel()
+
+	converted := &bytes.Buffer{}
+	convertYAML("testdata/newer_api_input.yaml", converted)
+	assert.Equal(t, newerAPIExpectedOutput, converted.String())
+
+	reverted := &bytes.Buffer{}
+	revertYAML("testdata/newer_api_output.yaml", reverted)
+	assert.Equal(t, newerAPIExpectedReverted, reverted.String())
+}
+
+// Test_convertYAMLToStdout_formatting - the edited YAML (with its anchors and merge keys) must describe the same
+// objects as the typed conversion.
+func Test_convertYAMLToStdout_formatting(t *testing.T) {
+	t.Parallel()
+
+	readObjects := func(filename string, transform transformFunc) []interface{} {
+		t.Helper()
+
+		input, err := os.Open(filename)
+		require.NoError(t, err)
+
+		defer input.Close()
+
+		var objects []interface{}
+
+		decoder := yaml.NewDecoder(input)
+
+		for {
+			var k8sObject map[string]interface{}
+			if errors.Is(decoder.Decode(&k8sObject), io.EOF) {
+				return objects
+			}
+
+			typedK8sObject := metav1.Common(&corev1.Pod{})
+			if k8sObject["kind"] == "Job" {
+				typedK8sObject = &batchv1.Job{}
+			}
+
+			object, err := transformObject(k8sObject, typedK8sObject, transform)
+			require.NoError(t, err)
+
+			objects = append(objects, object)
+		}
+	}
+
+	expected := readObjects("testdata/formatting_input.yaml", func(object metav1.Common) (metav1.Common, error) {
+		return convertWithRightMethod(object)
+	})
+	actual := readObjects("testdata/formatting_output.yaml", func(object metav1.Common) (metav1.Common, error) {
+		return object, nil
+	})
+
+	require.Len(t, actual, 2)
+	assert.Equal(t, expected, actual)
+}
+
+func Test_transformReader_unsupportedKinds(t *testing.T) {
+	t.Parallel()
+
+	input, err := os.Open("testdata/mixed_kinds_input.yaml")
+	require.NoError(t, err)
+
+	defer input.Close()
+
+	output := &bytes.Buffer{}
+	summary := &bytes.Buffer{}
+
+	transformReader(input, output, func(object metav1.Common) (metav1.Common, error) {
+		return convertWithRightMethod(object)
+	}, transformSettings{action: "converted", summary: summary})
+
+	assert.Equal(t, mixedKindsExpectedOutput, output.String())
+	assert.Equal(t, "converted 1: Job dummy\n"+
+		"skipped (unsupported kind) 2: ConfigMap default/dummy-config, Service dummy\n", summary.String())
+}
+
+func Test_transformReader_alreadyConvertedSummary(t *testing.T) {
+	t.Parallel()
+
+	input, err := os.Open("testdata/mixed_kinds_output.yaml")
+	require.NoError(t, err)
+
+	defer input.Close()
+
+	output := &bytes.Buffer{}
+	summary := &bytes.Buffer{}
+
+	transformReader(input, output, func(object metav1.Common) (metav1.Common, error) {
+		return convertWithRightMethod(object)
+	}, transformSettings{action: "converted", summary: summary})
+
+	assert.Equal(t, mixedKindsExpectedOutput, output.String())
+	assert.Equal(t, "unchanged (already converted) 1: Job dummy\n"+
+		"skipped (unsupported kind) 2: ConfigMap default/dummy-config, Service dummy\n", summary.String())
+}
+
+func Test_transformDocument_failOnUnsupportedKinds(t *testing.T) {
+	t.Parallel()
+
+	document := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: dummy-config\n")
+	k8sObject := map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}
+
+	var summary transformSummary
+
+	_, err := transformDocument(k8sObject, document, revertWithRightMethod,
+		transformSettings{action: "reverted", failOnUnsupportedKinds: true}, &summary)
+	require.ErrorIs(t, err, errUnknownK8sObject)
+
+	got, err := transformDocument(k8sObject, document, revertWithRightMethod,
+		transformSettings{action: "reverted"}, &summary)
+	require.NoError(t, err)
+	assert.Equal(t, document, got)
+	assert.Equal(t, transformSummary{skipped: []string{"ConfigMap"}}, summary)
+}
+
+func Test_commandName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "kueueleuleu", commandName("/usr/local/bin/kueueleuleu"))
+	assert.Equal(t, "kubectl kueueleuleu", commandName("/usr/local/bin/kubectl-kueueleuleu"))
+	assert.Equal(t, "kubectl kueueleuleu", commandName("kubectl-kueueleuleu.exe"))
+	assert.Equal(t, "kubectl my-plugin", commandName("kubectl-my_plugin"))
+}
@@ -0,0 +1,299 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/imageconfig"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// environment variables used as defaults for conversion flags, so a whole team can share the same settings.
+const (
+	entrypointImageEnvVar           = "KUEUELEULEU_ENTRYPOINT_IMAGE"
+	entrypointImagePullPolicyEnvVar = "KUEUELEULEU_ENTRYPOINT_IMAGE_PULL_POLICY"
+	imagePullSecretsEnvVar          = "KUEUELEULEU_IMAGE_PULL_SECRETS"
+)
+
+var errInvalidFlag = errors.New("invalid flag")
+
+//nolint:gochecknoglobals
+var alreadyConvertedPolicies = map[string]kueueleuleu.AlreadyConvertedPolicy{
+	"skip":      kueueleuleu.AlreadyConvertedSkip,
+	"reconvert": kueueleuleu.AlreadyConvertedReconvert,
+	"fail":      kueueleuleu.AlreadyConvertedFail,
+}
+
+// stringsFlag - a flag that can be repeated. Its default value is replaced (not appended to) when it is set.
+type stringsFlag struct {
+	values []string
+	isSet  bool
+}
+
+func (s *stringsFlag) String() string {
+	return strings.Join(s.values, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	if !s.isSet {
+		s.values = nil
+		s.isSet = true
+	}
+
+	s.values = append(s.values, value)
+
+	return nil
+}
+
+// parseInterspersed - parses flags, even when they are after positional arguments (e.g. "POD -f"),
+// and returns positional arguments. Arguments after "--" are never parsed as flags.
+func parseInterspersed(flagSet *flag.FlagSet, args []string) []string {
+	var positional []string
+
+	for {
+		_ = flagSet.Parse(args) // errors are handled by flag.ExitOnError
+
+		remaining := flagSet.Args()
+		consumed := args[:len(args)-len(remaining)]
+
+		if len(remaining) == 0 || (len(consumed) > 0 && consumed[len(consumed)-1] == "--") {
+			return append(positional, remaining...)
+		}
+
+		positional = append(positional, remaining[0])
+		args = remaining[1:]
+	}
+}
+
+func splitEnvVar(name string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// resourceListFlag - a flag holding a resource list, e.g. cpu=10m,memory=32Mi.
+type resourceListFlag struct {
+	resourceList corev1.ResourceList
+	isSet        bool
+}
+
+func (r *resourceListFlag) String() string {
+	items := make([]string, 0, len(r.resourceList))
+
+	for name, quantity := range r.resourceList {
+		items = append(items, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+
+	sort.Strings(items)
+
+	return strings.Join(items, ",")
+}
+
+func (r *resourceListFlag) Set(value string) error {
+	resourceList, err := kueueleuleu.ParseResourceList(value)
+	if err != nil {
+		return fmt.Errorf("cannot parse resource list: %w", err)
+	}
+
+	r.resourceList = resourceList
+	r.isSet = true
+
+	return nil
+}
+
+type convertFlags struct {
+	alreadyConverted          string
+	entrypointImage           string
+	entrypointImagePullPolicy string
+	imagePullSecrets          stringsFlag
+	prepareRequests           resourceListFlag
+	prepareLimits             resourceListFlag
+	resolveCommands           bool
+	imageCommandsFile         string
+	offline                   bool
+	imageCacheDir             string
+	onErrors                  string
+	successExitCodes          string
+	stepTimeouts              string
+}
+
+func (f *convertFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&f.alreadyConverted, "already-converted", "skip",
+		"what to do with objects already converted: skip (output them unchanged), reconvert or fail")
+	flagSet.StringVar(&f.entrypointImage, "entrypoint-image", os.Getenv(entrypointImageEnvVar),
+		"tekton entrypoint image to use instead of the default one, e.g. from a mirror (env: "+
+			entrypointImageEnvVar+")")
+	flagSet.StringVar(&f.entrypointImagePullPolicy, "entrypoint-image-pull-policy",
+		os.Getenv(entrypointImagePullPolicyEnvVar),
+		"pull policy of the tekton entrypoint image: Always, IfNotPresent or Never (env: "+
+			entrypointImagePullPolicyEnvVar+")")
+
+	f.imagePullSecrets.values = splitEnvVar(imagePullSecretsEnvVar)
+	flagSet.Var(&f.imagePullSecrets, "image-pull-secret",
+		"image pull secret to add to pods, can be repeated (env: "+imagePullSecretsEnvVar+", comma-separated)")
+	flagSet.Var(&f.prepareRequests, "prepare-requests",
+		"resource requests of the init container copying the tekton entrypoint, e.g. cpu=10m,memory=32Mi "+
+			"(empty for none, default: cpu=10m,memory=32Mi)")
+	flagSet.Var(&f.prepareLimits, "prepare-limits",
+		"resource limits of the init container copying the tekton entrypoint, e.g. cpu=100m,memory=64Mi "+
+			"(empty for none, default: cpu=100m,memory=64Mi)")
+	flagSet.BoolVar(&f.resolveCommands, "resolve-commands", false,
+		"resolve the command of containers without one from their image ENTRYPOINT and CMD, "+
+			"fetched from registries with the docker config credentials")
+	flagSet.StringVar(&f.imageCommandsFile, "image-commands-file", "",
+		"YAML file mapping images to their entrypoint and cmd, used before fetching images from registries")
+	flagSet.BoolVar(&f.offline, "offline", false,
+		"never contact registries, only resolve commands with -image-commands-file")
+	flagSet.StringVar(&f.imageCacheDir, "image-cache-dir", defaultImageCacheDir(),
+		"directory where image configurations fetched from registries are cached (empty to disable caching)")
+	flagSet.StringVar(&f.onErrors, "on-error", "",
+		"what happens to the next steps when a step fails, per container: stopAndFail (default) or continue, "+
+			"e.g. cleanup=continue,notify=continue")
+	flagSet.StringVar(&f.successExitCodes, "success-exit-codes", "",
+		"non-zero exit codes reported as a success, per container (the command is run by /bin/sh, "+
+			"which must be in the image), e.g. grep=1,diff=1;2")
+	flagSet.StringVar(&f.stepTimeouts, "step-timeout", "",
+		"maximum duration of steps, per container (the next steps are skipped on timeout), e.g. build=10m,test=1h30m")
+}
+
+func defaultImageCacheDir() string {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(userCacheDir, "kueueleuleu")
+}
+
+func (f *convertFlags) commandResolver() (kueueleuleu.CommandResolver, error) {
+	var resolvers imageconfig.Chain
+
+	if f.imageCommandsFile != "" {
+		mappingResolver, err := imageconfig.LoadMappingFile(f.imageCommandsFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: -image-commands-file: %w", errInvalidFlag, err)
+		}
+
+		resolvers = append(resolvers, mappingResolver)
+	}
+
+	if f.offline {
+		if f.imageCommandsFile == "" {
+			return nil, fmt.Errorf("%w: -offline requires -image-commands-file", errInvalidFlag)
+		}
+	} else if f.resolveCommands {
+		resolvers = append(resolvers, imageconfig.NewRegistryResolver(imageconfig.WithCacheDir(f.imageCacheDir)))
+	}
+
+	if len(resolvers) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	return resolvers, nil
+}
+
+func (f *convertFlags) stepOptions() ([]kueueleuleu.Option, error) {
+	onErrors, err := kueueleuleu.ParseStepOnErrors(f.onErrors)
+	if err != nil {
+		return nil, fmt.Errorf("%w: -on-error: %w", errInvalidFlag, err)
+	}
+
+	successExitCodes, err := kueueleuleu.ParseStepSuccessExitCodes(f.successExitCodes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: -success-exit-codes: %w", errInvalidFlag, err)
+	}
+
+	timeouts, err := kueueleuleu.ParseStepTimeouts(f.stepTimeouts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: -step-timeout: %w", errInvalidFlag, err)
+	}
+
+	opts := make([]kueueleuleu.Option, 0, len(onErrors)+len(successExitCodes)+len(timeouts))
+
+	for containerName, onError := range onErrors {
+		opts = append(opts, kueueleuleu.WithStepOnError(containerName, onError))
+	}
+
+	for containerName, exitCodes := range successExitCodes {
+		opts = append(opts, kueueleuleu.WithStepSuccessExitCodes(containerName, exitCodes...))
+	}
+
+	for containerName, timeout := range timeouts {
+		opts = append(opts, kueueleuleu.WithStepTimeout(containerName, timeout))
+	}
+
+	return opts, nil
+}
+
+func (f *convertFlags) options() ([]kueueleuleu.Option, error) {
+	alreadyConvertedPolicy, isValid := alreadyConvertedPolicies[f.alreadyConverted]
+	if !isValid {
+		return nil, fmt.Errorf("%w: -already-converted: %s", errInvalidFlag, f.alreadyConverted)
+	}
+
+	pullPolicy := corev1.PullPolicy(f.entrypointImagePullPolicy)
+
+	switch pullPolicy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		return nil, fmt.Errorf("%w: -entrypoint-image-pull-policy: %s", errInvalidFlag, pullPolicy)
+	}
+
+	opts := []kueueleuleu.Option{
+		kueueleuleu.WithAlreadyConvertedPolicy(alreadyConvertedPolicy),
+		kueueleuleu.WithEntrypointImage(f.entrypointImage),
+		kueueleuleu.WithEntrypointImagePullPolicy(pullPolicy),
+		kueueleuleu.WithImagePullSecrets(f.imagePullSecrets.values...),
+	}
+
+	if f.prepareRequests.isSet {
+		opts = append(opts, kueueleuleu.WithPrepareContainerRequests(f.prepareRequests.resourceList))
+	}
+
+	if f.prepareLimits.isSet {
+		opts = append(opts, kueueleuleu.WithPrepareContainerLimits(f.prepareLimits.resourceList))
+	}
+
+	stepOpts, err := f.stepOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, stepOpts...)
+
+	resolver, err := f.commandResolver()
+	if err != nil {
+		return nil, err
+	}
+
+	if resolver != nil {
+		opts = append(opts, kueueleuleu.WithCommandResolver(resolver))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,180 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_convertFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args          []string
+		expectedError error
+	}{
+		{
+			args: []string{},
+		},
+		{
+			args: []string{
+				"-entrypoint-image", "registry.example.com/entrypoint", "-entrypoint-image-pull-policy", "Always",
+				"-image-pull-secret", "a", "-image-pull-secret", "b", "-already-converted", "reconvert",
+				"-prepare-requests", "cpu=20m,memory=16Mi", "-prepare-limits", "",
+			},
+		},
+		{
+			args:          []string{"-already-converted", "ignore"},
+			expectedError: errInvalidFlag,
+		},
+		{
+			args:          []string{"-entrypoint-image-pull-policy", "Sometimes"},
+			expectedError: errInvalidFlag,
+		},
+		{
+			args: []string{"-offline", "-image-commands-file", "testdata/image_commands.yaml"},
+		},
+		{
+			args: []string{
+				"-on-error", "cleanup=continue", "-success-exit-codes", "grep=1,diff=1;2", "-step-timeout", "build=10m",
+			},
+		},
+		{
+			args:          []string{"-step-timeout", "build=forever"},
+			expectedError: errInvalidFlag,
+		},
+		{
+			args:          []string{"-on-error", "cleanup=ignore"},
+			expectedError: errInvalidFlag,
+		},
+		{
+			args:          []string{"-success-exit-codes", "grep"},
+			expectedError: errInvalidFlag,
+		},
+		{
+			args:          []string{"-offline", "-resolve-commands"},
+			expectedError: errInvalidFlag,
+		},
+		{
+			args:          []string{"-image-commands-file", "testdata/does_not_exist.yaml"},
+			expectedError: errInvalidFlag,
+		},
+	}
+
+	for _, testCase := range tests {
+		testCase := testCase
+
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var flags convertFlags
+
+			flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+			flagSet.SetOutput(io.Discard)
+			flags.register(flagSet)
+			require.NoError(t, flagSet.Parse(testCase.args))
+
+			opts, err := flags.options()
+			if testCase.expectedError != nil {
+				require.ErrorIs(t, err, testCase.expectedError)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotEmpty(t, opts)
+		})
+	}
+}
+
+func Test_stringsFlag(t *testing.T) {
+	t.Parallel()
+
+	flagValue := stringsFlag{values: []string{"from-env"}}
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.Var(&flagValue, "s", "")
+	require.NoError(t, flagSet.Parse([]string{"-s", "a", "-s", "b"}))
+
+	assert.Equal(t, []string{"a", "b"}, flagValue.values)
+}
+
+func Test_resourceListFlag(t *testing.T) {
+	t.Parallel()
+
+	var flagValue resourceListFlag
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.Var(&flagValue, "r", "")
+
+	require.Error(t, flagSet.Parse([]string{"-r", "cpu"}))
+	require.NoError(t, flagSet.Parse([]string{"-r", "memory=32Mi"}))
+
+	assert.True(t, flagValue.isSet)
+	assert.Equal(t, "memory=32Mi", flagValue.String())
+}
+
+func Test_parseInterspersed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args               []string
+		expectedPositional []string
+		expectedFollow     bool
+	}{
+		{
+			args:               []string{"pod"},
+			expectedPositional: []string{"pod"},
+		},
+		{
+			args:               []string{"-f", "pod"},
+			expectedPositional: []string{"pod"},
+			expectedFollow:     true,
+		},
+		{
+			args:               []string{"pod", "-f", "other"},
+			expectedPositional: []string{"pod", "other"},
+			expectedFollow:     true,
+		},
+		{
+			args:               []string{"pod", "--", "-f"},
+			expectedPositional: []string{"pod", "-f"},
+		},
+	}
+
+	for _, testCase := range tests {
+		testCase := testCase
+
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var follow bool
+
+			flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+			flagSet.BoolVar(&follow, "f", false, "")
+
+			assert.Equal(t, testCase.expectedPositional, parseInterspersed(flagSet, testCase.args))
+			assert.Equal(t, testCase.expectedFollow, follow)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/webhook"
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const postRenderSubcommand = "post-render"
+
+func postRenderMain(args []string) {
+	var flags convertFlags
+
+	flagSet := flag.NewFlagSet(postRenderSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %[1]s %[2]s [OPTIONS] < MANIFESTS
+  or:  helm install --post-renderer %[1]s --post-renderer-args %[2]s [...]
+Convert the Pods, Jobs and CronJobs of a multi-document YAML stream read from stdin, and write the stream to
+stdout, to be used as a helm post-renderer. Only objects annotated (or labelled) with %[3]s: "true" (or whose
+pod template is) are converted. Other documents (e.g. Services, ConfigMaps or CRDs) are written unchanged.
+
+`, commandName(os.Args[0]), postRenderSubcommand, webhook.OptInKey)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	if len(parseInterspersed(flagSet, args)) != 0 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		log.Println(err)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	err = postRender(os.Stdin, os.Stdout, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// postRender - writes the documents of r to w, with opted-in Pods, Jobs and CronJobs converted.
+// Separators and other documents are written byte for byte.
+func postRender(r io.Reader, w io.Writer, opts ...kueueleuleu.Option) error {
+	return splitDocuments(r, func(document []byte) error {
+		return postRenderDocument(document, w, opts...)
+	}, func(line []byte) error {
+		_, err := w.Write(append(line, '\n'))
+		if err != nil {
+			return fmt.Errorf("cannot write manifests: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// postRenderDocument - writes the document converted if it is an opted-in object, or unchanged otherwise.
+// Comments (e.g. "# Source: chart/templates/job.yaml" added by helm) are kept.
+func postRenderDocument(document []byte, w io.Writer, opts ...kueueleuleu.Option) error {
+	output := document
+
+	converted, err := convertOptedInDocument(document, opts...)
+	if err != nil {
+		return err
+	}
+
+	if converted != nil {
+		output = converted
+	}
+
+	_, err = w.Write(output)
+	if err != nil {
+		return fmt.Errorf("cannot write manifests: %w", err)
+	}
+
+	return nil
+}
+
+// convertOptedInDocument - returns the document with the object converted (see transformNode), or nil if the
+// document must be left unchanged.
+func convertOptedInDocument(document []byte, opts ...kueueleuleu.Option) ([]byte, error) {
+	var node yaml.Node
+
+	err := yaml.Unmarshal(document, &node)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errMalformedK8sObject, err)
+	}
+
+	var k8sObject map[string]interface{}
+
+	if len(node.Content) > 0 {
+		err = node.Content[0].Decode(&k8sObject)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errMalformedK8sObject, err)
+		}
+	}
+
+	apiVersion, _ := k8sObject["apiVersion"].(string)
+	kind, _ := k8sObject["kind"].(string)
+
+	var typedObject metav1.Common
+
+	switch [2]string{apiVersion, kind} {
+	case [2]string{"v1", "Pod"}:
+		typedObject = &corev1.Pod{}
+	case [2]string{"batch/v1", "Job"}:
+		typedObject = &batchv1.Job{}
+	case [2]string{"batch/v1", "CronJob"}:
+		typedObject = &batchv1.CronJob{}
+	default:
+		return nil, nil
+	}
+
+	convertOptedIn := func(t metav1.Common) (metav1.Common, error) {
+		if !isOptedIn(t) {
+			return t, nil
+		}
+
+		return convertWithRightMethod(t, opts...)
+	}
+
+	changed, err := transformNode(node.Content[0], typedObject, convertOptedIn)
+	if err != nil {
+		metadata, _ := k8sObject["metadata"].(map[string]interface{})
+
+		return nil, fmt.Errorf("%s %v: %w", kind, metadata["name"], err)
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	return encodeNode(&node)
+}
+
+// isOptedIn - returns whether the object, or one of its pod templates, is annotated (or labelled) with the opt-in
+// of the webhook. Charts often only allow to set annotations of pods.
+func isOptedIn(object metav1.Common) bool {
+	objectMetas := []metav1.ObjectMeta{}
+
+	switch typed := object.(type) {
+	case *corev1.Pod:
+		objectMetas = append(objectMetas, typed.ObjectMeta)
+	case *batchv1.Job:
+		objectMetas = append(objectMetas, typed.ObjectMeta, typed.Spec.Template.ObjectMeta)
+	case *batchv1.CronJob:
+		objectMetas = append(objectMetas, typed.ObjectMeta, typed.Spec.JobTemplate.ObjectMeta,
+			typed.Spec.JobTemplate.Spec.Template.ObjectMeta)
+	}
+
+	for _, objectMeta := range objectMetas {
+		if objectMeta.Annotations[webhook.OptInKey] == "true" || objectMeta.Labels[webhook.OptInKey] == "true" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/postrender_output.yaml
+var postRenderExpectedOutput string
+
+func Test_postRender(t *testing.T) {
+	t.Parallel()
+
+	input, err := os.Open("testdata/postrender_input.yaml")
+	require.NoError(t, err)
+
+	defer input.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, postRender(input, &out))
+	assert.Equal(t, postRenderExpectedOutput, out.String())
+}
+
+func Test_postRender_unchanged(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{
+		"",
+		"---\n",
+		"# only a comment\n",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: a}\n--- # comment\napiVersion: v1\nkind: Secret\n",
+		// not opted in
+		podAndJobExpectedOutput,
+	} {
+		var out bytes.Buffer
+		require.NoError(t, postRender(strings.NewReader(input), &out))
+		assert.Equal(t, input, out.String())
+	}
+}
+
+func Test_postRender_options(t *testing.T) {
+	t.Parallel()
+
+	input := `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  labels:
+    norbjd.github.io/kueueleuleu-inject: "true"
+spec:
+  containers:
+  - name: step1
+    image: busybox
+    command: [echo]
+`
+
+	var out bytes.Buffer
+	require.NoError(t, postRender(strings.NewReader(input), &out,
+		kueueleuleu.WithEntrypointImage("registry.example.com/tekton/entrypoint:v0.55.0")))
+	assert.Contains(t, out.String(), "image: registry.example.com/tekton/entrypoint:v0.55.0")
+}
+
+func Test_postRender_invalid(t *testing.T) {
+	t.Parallel()
+
+	input := `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: without-command
+  annotations:
+    norbjd.github.io/kueueleuleu-inject: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: step1
+        image: busybox
+`
+
+	err := postRender(strings.NewReader(input), &bytes.Buffer{})
+	require.ErrorIs(t, err, kueueleuleu.ErrContainerDoesNotHaveACommand)
+	require.ErrorContains(t, err, "Job without-command")
+
+	err = postRender(strings.NewReader("{not: yaml"), &bytes.Buffer{})
+	require.ErrorIs(t, err, errMalformedK8sObject)
+}
@@ -0,0 +1,378 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	runSubcommand = "run"
+	// exitCodeFailure - the exit code of the run subcommand when the pod has failed without a failing step
+	// exit code (e.g. it was evicted), or when an error occurred.
+	exitCodeFailure    = 1
+	jobPodPollInterval = time.Second
+	deleteTimeout      = 30 * time.Second
+)
+
+var errNotRunnable = errors.New("only a single Pod or Job can be run")
+
+type runFlags struct {
+	kubeFlags
+	convertFlags
+	file    string
+	rm      bool
+	timeout time.Duration
+}
+
+func (f *runFlags) register(flagSet *flag.FlagSet) {
+	f.kubeFlags.register(flagSet)
+	f.convertFlags.register(flagSet)
+	flagSet.StringVar(&f.file, "f", "", "path to YAML file or - (stdin), containing a single Pod or Job")
+	flagSet.BoolVar(&f.rm, "rm", false, "delete the object once it is finished")
+	flagSet.DurationVar(&f.timeout, "timeout", 0,
+		"maximum duration to wait for the object to finish, e.g. 10m (default: no timeout)")
+}
+
+func runMain(args []string) {
+	var flags runFlags
+
+	flagSet := flag.NewFlagSet(runSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %s %s [OPTIONS] -f FILE
+Convert a Pod or a Job, create it, print the logs of its steps in order, and exit with the exit code
+of the failing step (or 0 if it has succeeded). Pods without a restart policy are run with restartPolicy: Never.
+The pods of a Job are followed until the Job finishes, the exit code is the one of its last pod.
+
+`, commandName(os.Args[0]), runSubcommand)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	if len(parseInterspersed(flagSet, args)) != 0 || flags.file == "" {
+		log.Println("input is not set")
+		flagSet.Usage()
+		os.Exit(exitCodeFailure)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		log.Println(err)
+		flagSet.Usage()
+		os.Exit(exitCodeFailure)
+	}
+
+	object, err := readObjectToRun(getInput(flags.file), opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, namespace, err := flags.client()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(runWithTimeout(client, namespace, object, flags))
+}
+
+func runWithTimeout(client kubernetes.Interface, namespace string, object metav1.Object, flags runFlags) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if flags.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, flags.timeout)
+		defer cancel()
+	}
+
+	exitCode, err := runObject(ctx, client, namespace, object, os.Stdout, flags.rm)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return exitCode
+}
+
+// readObjectToRun - reads a single Pod or Job, and converts it.
+func readObjectToRun(reader io.Reader, opts ...kueueleuleu.Option) (metav1.Object, error) {
+	yamlDecoder := yaml.NewDecoder(reader)
+
+	var k8sObject map[string]interface{}
+
+	err := yamlDecoder.Decode(&k8sObject)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read YAML: %w", err)
+	}
+
+	var other map[string]interface{}
+	if !errors.Is(yamlDecoder.Decode(&other), io.EOF) {
+		return nil, fmt.Errorf("%w: more than one object found", errNotRunnable)
+	}
+
+	apiVersion, _ := k8sObject["apiVersion"].(string)
+	kind, _ := k8sObject["kind"].(string)
+
+	var object metav1.Common
+
+	switch {
+	case apiVersion == "v1" && kind == "Pod":
+		object, err = transformObject(k8sObject, &corev1.Pod{}, func(t metav1.Common) (metav1.Common, error) {
+			pod, _ := t.(*corev1.Pod)
+			if pod.Spec.RestartPolicy == "" {
+				pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+			}
+
+			return convertWithRightMethod(pod, opts...)
+		})
+	case apiVersion == "batch/v1" && kind == "Job":
+		object, err = transformObject(k8sObject, &batchv1.Job{}, func(t metav1.Common) (metav1.Common, error) {
+			return convertWithRightMethod(t, opts...)
+		})
+	default:
+		return nil, fmt.Errorf("%w: (%v, %v)", errNotRunnable, apiVersion, kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	metaObject, _ := object.(metav1.Object)
+
+	return metaObject, nil
+}
+
+// runObject - creates the converted Pod or Job, prints the logs of its steps, and returns the exit code
+// of the failing step (or 0 if it has succeeded). When the object is a Job, see followJob.
+func runObject(ctx context.Context, client kubernetes.Interface, namespace string, object metav1.Object,
+	w io.Writer, rm bool,
+) (exitCode int, err error) {
+	if object.GetNamespace() != "" {
+		namespace = object.GetNamespace()
+	}
+
+	var (
+		podName string
+		job     *batchv1.Job
+		remove  func(context.Context) error
+	)
+
+	switch typedObject := object.(type) {
+	case *corev1.Pod:
+		pods := client.CoreV1().Pods(namespace)
+
+		created, err := pods.Create(ctx, typedObject, metav1.CreateOptions{})
+		if err != nil {
+			return exitCodeFailure, fmt.Errorf("cannot create pod: %w", err)
+		}
+
+		podName = created.Name
+		remove = func(ctx context.Context) error {
+			return pods.Delete(ctx, created.Name, metav1.DeleteOptions{}) //nolint:wrapcheck
+		}
+	case *batchv1.Job:
+		jobs := client.BatchV1().Jobs(namespace)
+
+		created, err := jobs.Create(ctx, typedObject, metav1.CreateOptions{})
+		if err != nil {
+			return exitCodeFailure, fmt.Errorf("cannot create job: %w", err)
+		}
+
+		job = created
+		remove = func(ctx context.Context) error {
+			propagationPolicy := metav1.DeletePropagationBackground
+
+			return jobs.Delete(ctx, created.Name, //nolint:wrapcheck
+				metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+		}
+	default:
+		return exitCodeFailure, errNotRunnable
+	}
+
+	if rm {
+		defer func() {
+			err = errors.Join(err, deleteObject(remove))
+		}()
+	}
+
+	if job != nil {
+		return followJob(ctx, client, namespace, job, w)
+	}
+
+	return followPod(ctx, client, namespace, podName, w)
+}
+
+// deleteObject - deletes the object, even if the run context is done (e.g. the timeout is exceeded).
+func deleteObject(remove func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+	defer cancel()
+
+	err := remove(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot delete object: %w", err)
+	}
+
+	return nil
+}
+
+// followJob - follows the pods of the job one after the other, in the order they are created (e.g. when the job
+// retries a failed pod), until the job has finished. Returns 0 if the job has completed, or the exit code
+// of the last pod otherwise. Pods are selected with the selector of the created job (including its
+// controller-uid), so pods of a previous job with the same name (e.g. still terminating) are not followed.
+func followJob(ctx context.Context, client kubernetes.Interface, namespace string, job *batchv1.Job, w io.Writer,
+) (int, error) {
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return exitCodeFailure, fmt.Errorf("invalid job selector: %w", err)
+	}
+
+	followedPods := make(map[string]bool)
+	exitCode := exitCodeFailure
+
+	for {
+		podName, jobCondition, err := waitForNextJobPod(ctx, client, namespace, job.Name, selector.String(),
+			followedPods)
+		if err != nil {
+			return exitCodeFailure, err
+		}
+
+		//nolint:exhaustive
+		switch jobCondition {
+		case batchv1.JobComplete:
+			return 0, nil
+		case batchv1.JobFailed:
+			// e.g. the active deadline of the job was exceeded while its last pod had succeeded
+			if exitCode == 0 {
+				return exitCodeFailure, nil
+			}
+
+			return exitCode, nil
+		}
+
+		followedPods[podName] = true
+
+		exitCode, err = followPod(ctx, client, namespace, podName, w)
+		if err != nil {
+			return exitCode, err
+		}
+	}
+}
+
+// waitForNextJobPod - waits for a pod of the job that has not been followed yet, the oldest one first. Once all
+// the pods of the job are followed and the job has finished, its final condition is returned instead.
+func waitForNextJobPod(ctx context.Context, client kubernetes.Interface, namespace, jobName, selector string,
+	followedPods map[string]bool,
+) (string, batchv1.JobConditionType, error) {
+	var (
+		podName      string
+		jobCondition batchv1.JobConditionType
+	)
+
+	err := wait.PollUntilContextCancel(ctx, jobPodPollInterval, true, func(ctx context.Context) (bool, error) {
+		// the job is read first: if it has finished, all its pods are listed
+		job, err := client.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("cannot get job: %w", err)
+		}
+
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, fmt.Errorf("cannot list pods: %w", err)
+		}
+
+		sort.Slice(pods.Items, func(i, j int) bool {
+			if !pods.Items[i].CreationTimestamp.Equal(&pods.Items[j].CreationTimestamp) {
+				return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+			}
+
+			return pods.Items[i].Name < pods.Items[j].Name
+		})
+
+		for _, pod := range pods.Items {
+			if !followedPods[pod.Name] {
+				podName = pod.Name
+
+				return true, nil
+			}
+		}
+
+		jobCondition = finalJobCondition(*job)
+
+		return jobCondition != "", nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("cannot wait for a pod of job %s: %w", jobName, err)
+	}
+
+	return podName, jobCondition, nil
+}
+
+// finalJobCondition - returns JobComplete or JobFailed if the job has finished, or an empty condition.
+func finalJobCondition(job batchv1.Job) batchv1.JobConditionType {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == corev1.ConditionTrue {
+			return condition.Type
+		}
+	}
+
+	return ""
+}
+
+func followPod(ctx context.Context, client kubernetes.Interface, namespace, podName string, w io.Writer,
+) (int, error) {
+	err := kueueleuleu.StreamLogs(ctx, client, namespace, podName, w, kueueleuleu.WithFollow())
+	if err != nil {
+		return exitCodeFailure, fmt.Errorf("cannot stream logs: %w", err)
+	}
+
+	completion, err := kueueleuleu.WaitForCompletion(ctx, client, namespace, podName)
+	if err != nil {
+		return exitCodeFailure, err //nolint:wrapcheck
+	}
+
+	return completionExitCode(completion), nil
+}
+
+func completionExitCode(completion kueueleuleu.Completion) int {
+	if completion.Succeeded() {
+		return 0
+	}
+
+	if completion.FailedStep != nil && completion.FailedStep.ExitCode != 0 {
+		return int(completion.FailedStep.ExitCode)
+	}
+
+	return exitCodeFailure
+}
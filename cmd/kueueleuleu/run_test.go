@@ -0,0 +1,319 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// controllerUIDLabel - the label selecting the pods of a job, set by the API server.
+const controllerUIDLabel = "batch.kubernetes.io/controller-uid"
+
+const twoStepsPodYAML = `apiVersion: v1
+kind: Pod
+metadata:
+  name: two-steps
+spec:
+  containers:
+    - name: first
+      image: alpine
+      command: [echo, first]
+    - name: second
+      image: alpine
+      command: [echo, second]
+`
+
+func Test_readObjectToRun(t *testing.T) {
+	t.Parallel()
+
+	object, err := readObjectToRun(strings.NewReader(twoStepsPodYAML))
+	require.NoError(t, err)
+
+	pod, isPod := object.(*corev1.Pod)
+	require.True(t, isPod)
+	assert.True(t, kueueleuleu.IsKueueleuleu(pod.ObjectMeta))
+	assert.Equal(t, corev1.RestartPolicyNever, pod.Spec.RestartPolicy)
+
+	object, err = readObjectToRun(getInput("testdata/job_input.yaml"))
+	require.NoError(t, err)
+
+	job, isJob := object.(*batchv1.Job)
+	require.True(t, isJob)
+	assert.True(t, kueueleuleu.IsKueueleuleu(job.Spec.Template.ObjectMeta))
+
+	_, err = readObjectToRun(getInput("testdata/cronjob_input.yaml"))
+	require.ErrorIs(t, err, errNotRunnable)
+
+	_, err = readObjectToRun(getInput("testdata/pod_and_job_input.yaml"))
+	require.ErrorIs(t, err, errNotRunnable)
+}
+
+// simulateKubelet - sets the status of the pod once it exists, until stop is closed. The status is set again
+// periodically, as the fake clientset can lose changes done between listing and watching pods.
+func simulateKubelet(client *fake.Clientset, podName string, status corev1.PodStatus, stop <-chan struct{}) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		pod, err := client.CoreV1().Pods("default").Get(context.Background(), podName, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+
+		pod.Status = status
+		_, _ = client.CoreV1().Pods("default").UpdateStatus(context.Background(), pod, metav1.UpdateOptions{})
+	}
+}
+
+func terminatedContainerStatus(name string, exitCode int32) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name: name,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode:   exitCode,
+			FinishedAt: metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		}},
+	}
+}
+
+func Test_runObject_pod(t *testing.T) {
+	t.Parallel()
+
+	object, err := readObjectToRun(strings.NewReader(twoStepsPodYAML))
+	require.NoError(t, err)
+
+	client := fake.NewSimpleClientset()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go simulateKubelet(client, "two-steps", corev1.PodStatus{
+		Phase: corev1.PodFailed,
+		ContainerStatuses: []corev1.ContainerStatus{
+			terminatedContainerStatus("first", 3),
+			terminatedContainerStatus("second", 1),
+		},
+	}, stop)
+
+	var stdout bytes.Buffer
+
+	exitCode, err := runObject(context.Background(), client, "default", object, &stdout, true)
+	require.NoError(t, err)
+
+	// the second step was skipped, and the fake clientset returns "fake logs" as the logs of any container
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "[first] fake logs\n", stdout.String())
+
+	_, err = client.CoreV1().Pods("default").Get(context.Background(), "two-steps", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err), "pod should have been deleted")
+}
+
+// newJobClientset - returns a fake clientset setting the uid, the selector and the labels of the pod template
+// of created jobs, like the API server does.
+func newJobClientset(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job, _ := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job) //nolint:forcetypeassert
+
+		job.UID = types.UID(job.Name + "-uid")
+		job.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{controllerUIDLabel: string(job.UID)}}
+
+		if job.Spec.Template.Labels == nil {
+			job.Spec.Template.Labels = make(map[string]string)
+		}
+
+		job.Spec.Template.Labels[controllerUIDLabel] = string(job.UID)
+		job.Spec.Template.Labels["job-name"] = job.Name
+
+		return false, nil, nil
+	})
+
+	return client
+}
+
+// simulateJobController - creates the pods of the job (the fake clientset does not) once it exists, and sets
+// the final condition of the job.
+func simulateJobController(client *fake.Clientset, job *batchv1.Job, podNames []string,
+	condition batchv1.JobConditionType,
+) {
+	for {
+		createdJob, err := client.BatchV1().Jobs("default").Get(context.Background(), job.Name, metav1.GetOptions{})
+		if err != nil {
+			time.Sleep(50 * time.Millisecond)
+
+			continue
+		}
+
+		for _, podName := range podNames {
+			pod := &corev1.Pod{
+				ObjectMeta: *createdJob.Spec.Template.ObjectMeta.DeepCopy(),
+				Spec:       createdJob.Spec.Template.Spec,
+			}
+			pod.Name = podName
+
+			_, _ = client.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{})
+		}
+
+		createdJob.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+		_, _ = client.BatchV1().Jobs("default").UpdateStatus(context.Background(), createdJob, metav1.UpdateOptions{})
+
+		return
+	}
+}
+
+// jobPodStatus - the status of a pod of the job, whose first step exited with exitCode (the next steps
+// are skipped if it is not 0).
+func jobPodStatus(job *batchv1.Job, exitCode int32) corev1.PodStatus {
+	status := corev1.PodStatus{Phase: corev1.PodSucceeded}
+	if exitCode != 0 {
+		status.Phase = corev1.PodFailed
+	}
+
+	for i, container := range job.Spec.Template.Spec.Containers {
+		containerExitCode := int32(0)
+
+		switch {
+		case i == 0:
+			containerExitCode = exitCode
+		case exitCode != 0:
+			containerExitCode = 1
+		}
+
+		status.ContainerStatuses = append(status.ContainerStatuses,
+			terminatedContainerStatus(container.Name, containerExitCode))
+	}
+
+	return status
+}
+
+func Test_runObject_job(t *testing.T) {
+	t.Parallel()
+
+	object, err := readObjectToRun(getInput("testdata/job_input.yaml"))
+	require.NoError(t, err)
+
+	job, _ := object.(*batchv1.Job)
+
+	// a pod of a previous job with the same name, still terminating: it is not followed, as it does not match
+	// the controller-uid of the created job
+	client := newJobClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-previous", Namespace: "default", Labels: map[string]string{
+			controllerUIDLabel: "previous-uid",
+			"job-name":         job.Name,
+		}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// the first pod fails, and the job retries it
+	go simulateJobController(client, job, []string{job.Name + "-abcde", job.Name + "-fghij"}, batchv1.JobComplete)
+	go simulateKubelet(client, job.Name+"-abcde", jobPodStatus(job, 3), stop)
+	go simulateKubelet(client, job.Name+"-fghij", jobPodStatus(job, 0), stop)
+
+	var stdout bytes.Buffer
+
+	exitCode, err := runObject(context.Background(), client, "default", object, &stdout, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	// logs of the first step of the failed pod, and of all the steps of the succeeded one
+	assert.Equal(t, 1+len(job.Spec.Template.Spec.Containers), strings.Count(stdout.String(), "fake logs\n"))
+
+	_, err = client.BatchV1().Jobs("default").Get(context.Background(), job.Name, metav1.GetOptions{})
+	require.NoError(t, err, "job should not have been deleted")
+}
+
+func Test_runObject_jobFailed(t *testing.T) {
+	t.Parallel()
+
+	object, err := readObjectToRun(getInput("testdata/job_input.yaml"))
+	require.NoError(t, err)
+
+	job, _ := object.(*batchv1.Job)
+
+	client := newJobClientset()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go simulateJobController(client, job, []string{job.Name + "-abcde", job.Name + "-fghij"}, batchv1.JobFailed)
+	go simulateKubelet(client, job.Name+"-abcde", jobPodStatus(job, 3), stop)
+	go simulateKubelet(client, job.Name+"-fghij", jobPodStatus(job, 2), stop)
+
+	// the exit code of the last pod
+	exitCode, err := runObject(context.Background(), client, "default", object, &bytes.Buffer{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, exitCode)
+}
+
+func Test_runObject_timeout(t *testing.T) {
+	t.Parallel()
+
+	object, err := readObjectToRun(strings.NewReader(twoStepsPodYAML))
+	require.NoError(t, err)
+
+	client := fake.NewSimpleClientset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	exitCode, err := runObject(ctx, client, "default", object, &bytes.Buffer{}, true)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, exitCodeFailure, exitCode)
+
+	// the pod is deleted even if the timeout is exceeded
+	_, err = client.CoreV1().Pods("default").Get(context.Background(), "two-steps", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err), "pod should have been deleted")
+}
+
+func Test_completionExitCode(t *testing.T) {
+	t.Parallel()
+
+	succeeded := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodSucceeded}}
+	failed := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed}}
+
+	assert.Equal(t, 0, completionExitCode(kueueleuleu.Completion{Pod: succeeded}))
+	assert.Equal(t, 2, completionExitCode(kueueleuleu.Completion{
+		Pod:        failed,
+		FailedStep: &kueueleuleu.StepStatus{Name: "step", State: kueueleuleu.StepFailed, ExitCode: 2},
+	}))
+	// e.g. the pod was evicted
+	assert.Equal(t, exitCodeFailure, completionExitCode(kueueleuleu.Completion{Pod: failed}))
+}
@@ -0,0 +1,304 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kyaml "sigs.k8s.io/yaml"
+)
+
+const statusSubcommand = "status"
+
+// output formats of the status subcommand.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var errNoKueueleuleuPod = errors.New("no kueueleuleu pod found")
+
+// podStatus - the status of a kueueleuleu pod, as output by the status subcommand.
+type podStatus struct {
+	Pod   string                   `json:"pod"`
+	Phase corev1.PodPhase          `json:"phase"`
+	Steps []kueueleuleu.StepStatus `json:"steps"`
+}
+
+type statusFlags struct {
+	kubeFlags
+	output string
+}
+
+func (f *statusFlags) register(flagSet *flag.FlagSet) {
+	f.kubeFlags.register(flagSet)
+	flagSet.StringVar(&f.output, "output", outputTable, "output format: table, json or yaml")
+	flagSet.StringVar(&f.output, "o", outputTable, "shorthand for -output")
+}
+
+func (f *statusFlags) validate() error {
+	switch f.output {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	default:
+		return fmt.Errorf("%w: -output: %s", errInvalidFlag, f.output)
+	}
+}
+
+func statusMain(args []string) {
+	var flags statusFlags
+
+	flagSet := flag.NewFlagSet(statusSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %s %s [OPTIONS] [pod/|job/|cronjob/]NAME
+Print the status of the steps of a kueueleuleu pod, or of the pods of a Job or a CronJob.
+
+`, commandName(os.Args[0]), statusSubcommand)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	names := parseInterspersed(flagSet, args)
+	if len(names) != 1 {
+		log.Println("exactly one object is expected")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if err := flags.validate(); err != nil {
+		log.Println(err)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	client, namespace, err := flags.client()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	podStatuses, err := getPodStatuses(ctx, client, namespace, names[0])
+
+	stop()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = writePodStatuses(os.Stdout, podStatuses, flags.output, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// getPodStatuses - returns the statuses of the kueueleuleu pods of an object, referenced like with kubectl
+// (e.g. my-pod, pod/my-pod, job/my-job, cronjob/my-cronjob).
+func getPodStatuses(ctx context.Context, client kubernetes.Interface, namespace, reference string,
+) ([]podStatus, error) {
+	pods, err := getPods(ctx, client, namespace, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	podStatuses := make([]podStatus, 0, len(pods))
+
+	for _, pod := range pods {
+		if !kueueleuleu.IsKueueleuleu(pod.ObjectMeta) {
+			continue
+		}
+
+		stepStatuses, err := kueueleuleu.GetStepStatuses(pod)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get steps statuses of pod %s: %w", pod.Name, err)
+		}
+
+		podStatuses = append(podStatuses, podStatus{
+			Pod:   pod.Name,
+			Phase: pod.Status.Phase,
+			Steps: stepStatuses,
+		})
+	}
+
+	if len(podStatuses) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNoKueueleuleuPod, reference)
+	}
+
+	return podStatuses, nil
+}
+
+// getPods - returns the pods of the referenced object, oldest first.
+func getPods(ctx context.Context, client kubernetes.Interface, namespace, reference string,
+) ([]corev1.Pod, error) {
+	kind, name, found := strings.Cut(reference, "/")
+	if !found {
+		kind, name = "pod", reference
+	}
+
+	var (
+		pods []corev1.Pod
+		err  error
+	)
+
+	switch strings.ToLower(kind) {
+	case "pod", "pods", "po":
+		var pod *corev1.Pod
+
+		pod, err = client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			pods = []corev1.Pod{*pod}
+		}
+	case "job", "jobs":
+		pods, err = getJobPods(ctx, client, namespace, name)
+	case "cronjob", "cronjobs", "cj":
+		pods, err = getCronJobPods(ctx, client, namespace, name)
+	default:
+		return nil, fmt.Errorf("%w: (%s)", errUnknownK8sObject, kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot get pods of %s: %w", reference, err)
+	}
+
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+
+	return pods, nil
+}
+
+func getJobPods(ctx context.Context, client kubernetes.Interface, namespace, name string) ([]corev1.Pod, error) {
+	job, err := client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get job: %w", err)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job selector: %w", err)
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pods: %w", err)
+	}
+
+	return pods.Items, nil
+}
+
+func getCronJobPods(ctx context.Context, client kubernetes.Interface, namespace, name string,
+) ([]corev1.Pod, error) {
+	cronJob, err := client.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cronjob: %w", err)
+	}
+
+	jobs, err := client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list jobs: %w", err)
+	}
+
+	pods := make([]corev1.Pod, 0)
+
+	for _, job := range jobs.Items {
+		controller := metav1.GetControllerOf(&job)
+		if controller == nil || controller.UID != cronJob.UID {
+			continue
+		}
+
+		jobPods, err := getJobPods(ctx, client, namespace, job.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		pods = append(pods, jobPods...)
+	}
+
+	return pods, nil
+}
+
+func writePodStatuses(w io.Writer, podStatuses []podStatus, output string, now time.Time) error {
+	switch output {
+	case outputTable:
+		return writePodStatusesTable(w, podStatuses, now)
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(podStatuses) //nolint:wrapcheck
+	case outputYAML:
+		podStatusesYAML, err := kyaml.Marshal(podStatuses)
+		if err != nil {
+			return fmt.Errorf("cannot write YAML: %w", err)
+		}
+
+		_, err = w.Write(podStatusesYAML)
+
+		return err //nolint:wrapcheck
+	default:
+		return fmt.Errorf("%w: -output: %s", errInvalidFlag, output)
+	}
+}
+
+func writePodStatusesTable(w io.Writer, podStatuses []podStatus, now time.Time) error {
+	tabWriter := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0) //nolint:gomnd
+
+	fmt.Fprintln(tabWriter, "POD\tSTEP\tSTATE\tEXIT CODE\tSTARTED\tDURATION\tREASON")
+
+	for _, podStatus := range podStatuses {
+		for _, stepStatus := range podStatus.Steps {
+			exitCode, startedAt, duration := "", "", ""
+
+			if stepStatus.State.IsFinished() && stepStatus.State != kueueleuleu.StepSkipped {
+				exitCode = strconv.Itoa(int(stepStatus.ExitCode))
+			}
+
+			if !stepStatus.StartedAt.IsZero() && stepStatus.State != kueueleuleu.StepSkipped {
+				startedAt = stepStatus.StartedAt.UTC().Format(time.RFC3339)
+
+				finishedAt := now
+				if !stepStatus.FinishedAt.IsZero() {
+					finishedAt = stepStatus.FinishedAt.Time
+				}
+
+				duration = finishedAt.Sub(stepStatus.StartedAt.Time).Round(time.Second).String()
+			}
+
+			fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", podStatus.Pod, stepStatus.Name, stepStatus.State,
+				exitCode, startedAt, duration, stepStatus.Reason)
+		}
+	}
+
+	return tabWriter.Flush() //nolint:wrapcheck
+}
@@ -0,0 +1,216 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// runningTwoStepsPod - a converted pod whose first step has succeeded, and second step is running.
+func runningTwoStepsPod(t *testing.T, name string, podLabels map[string]string) *corev1.Pod {
+	t.Helper()
+
+	pod := succeededPod(t)
+	pod.Name = name
+	pod.Labels = podLabels
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "first", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode:   0,
+			Message:    `[{"key":"StartedAt","value":"2024-01-01T12:00:05.000Z","type":3}]`,
+			FinishedAt: metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 15, 0, time.UTC)),
+		}}},
+		{Name: "second", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{
+			StartedAt: metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		}}},
+	}
+
+	return pod
+}
+
+func Test_getPodStatuses(t *testing.T) {
+	t.Parallel()
+
+	isController := true
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-job",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "batch/v1", Kind: "CronJob", Name: "my-cronjob", UID: "cronjob-uid", Controller: &isController},
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": "my-job"}},
+		},
+	}
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-cronjob",
+			Namespace: "default",
+			UID:       "cronjob-uid",
+		},
+	}
+
+	notKueueleuleuPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "not-kueueleuleu",
+			Namespace: "default",
+			Labels:    map[string]string{"job-name": "my-job"},
+		},
+	}
+
+	client := fake.NewSimpleClientset([]runtime.Object{
+		runningTwoStepsPod(t, "my-pod", nil),
+		runningTwoStepsPod(t, "my-job-abcde", map[string]string{"job-name": "my-job"}),
+		notKueueleuleuPod,
+		job,
+		cronJob,
+	}...)
+
+	tests := []struct {
+		reference    string
+		expectedPods []string
+	}{
+		{reference: "my-pod", expectedPods: []string{"my-pod"}},
+		{reference: "pod/my-pod", expectedPods: []string{"my-pod"}},
+		{reference: "job/my-job", expectedPods: []string{"my-job-abcde"}},
+		{reference: "cronjob/my-cronjob", expectedPods: []string{"my-job-abcde"}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.reference, func(t *testing.T) {
+			t.Parallel()
+
+			podStatuses, err := getPodStatuses(context.Background(), client, "default", test.reference)
+			require.NoError(t, err)
+
+			pods := make([]string, 0, len(podStatuses))
+			for _, podStatus := range podStatuses {
+				pods = append(pods, podStatus.Pod)
+				assert.Len(t, podStatus.Steps, 2)
+			}
+
+			assert.Equal(t, test.expectedPods, pods)
+		})
+	}
+
+	_, err := getPodStatuses(context.Background(), client, "default", "not-kueueleuleu")
+	require.ErrorIs(t, err, errNoKueueleuleuPod)
+
+	_, err = getPodStatuses(context.Background(), client, "default", "deployment/my-deployment")
+	require.ErrorIs(t, err, errUnknownK8sObject)
+}
+
+func Test_writePodStatuses(t *testing.T) {
+	t.Parallel()
+
+	pod := runningTwoStepsPod(t, "my-pod", nil)
+
+	stepStatuses, err := kueueleuleu.GetStepStatuses(*pod)
+	require.NoError(t, err)
+
+	podStatuses := []podStatus{{Pod: "my-pod", Phase: corev1.PodRunning, Steps: stepStatuses}}
+	now := time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC)
+
+	tests := []struct {
+		output         string
+		expectedOutput string
+	}{
+		{
+			output: "table",
+			expectedOutput: `POD      STEP     STATE       EXIT CODE   STARTED                DURATION   REASON
+my-pod   first    Succeeded   0           2024-01-01T12:00:05Z   10s        
+my-pod   second   Running                 2024-01-01T12:00:15Z   45s        
+`,
+		},
+		{
+			output: "json",
+			expectedOutput: `[
+  {
+    "pod": "my-pod",
+    "phase": "Running",
+    "steps": [
+      {
+        "name": "first",
+        "state": "Succeeded",
+        "exitCode": 0,
+        "startedAt": "2024-01-01T12:00:05Z",
+        "finishedAt": "2024-01-01T12:00:15Z"
+      },
+      {
+        "name": "second",
+        "state": "Running",
+        "exitCode": 0,
+        "startedAt": "2024-01-01T12:00:15Z",
+        "finishedAt": null
+      }
+    ]
+  }
+]
+`,
+		},
+		{
+			output: "yaml",
+			expectedOutput: `- phase: Running
+  pod: my-pod
+  steps:
+  - exitCode: 0
+    finishedAt: "2024-01-01T12:00:15Z"
+    name: first
+    startedAt: "2024-01-01T12:00:05Z"
+    state: Succeeded
+  - exitCode: 0
+    finishedAt: null
+    name: second
+    startedAt: "2024-01-01T12:00:15Z"
+    state: Running
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.output, func(t *testing.T) {
+			t.Parallel()
+
+			var output bytes.Buffer
+
+			require.NoError(t, writePodStatuses(&output, podStatuses, test.output, now))
+			assert.Equal(t, test.expectedOutput, output.String())
+		})
+	}
+
+	require.ErrorIs(t, writePodStatuses(&bytes.Buffer{}, podStatuses, "xml", now), errInvalidFlag)
+}
@@ -0,0 +1,288 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/webhook"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	webhookSubcommand = "webhook"
+	// webhookPath - the path of the webhook, to set in the MutatingWebhookConfiguration.
+	webhookPath       = "/mutate"
+	healthzPath       = "/healthz"
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 10 * time.Second
+
+	defaultWebhookServiceName       = "kueueleuleu-webhook"
+	defaultWebhookConfigurationName = "kueueleuleu"
+	policyResyncPeriod              = 10 * time.Minute
+)
+
+type webhookFlags struct {
+	kubeFlags
+	convertFlags
+	addr                     string
+	tlsCertFile              string
+	tlsKeyFile               string
+	selfSignedSecret         string
+	serviceName              string
+	webhookConfigurationName string
+	certCheckInterval        time.Duration
+	policyFile               string
+	policyConfigMap          string
+}
+
+func (f *webhookFlags) register(flagSet *flag.FlagSet) {
+	f.kubeFlags.register(flagSet)
+	f.convertFlags.register(flagSet)
+	flagSet.StringVar(&f.addr, "addr", ":8443", "address to listen on")
+	flagSet.StringVar(&f.tlsCertFile, "tls-cert-file", "", "path to the TLS certificate of the webhook server")
+	flagSet.StringVar(&f.tlsKeyFile, "tls-key-file", "", "path to the TLS private key of the webhook server")
+	flagSet.StringVar(&f.selfSignedSecret, "self-signed-secret", "",
+		"instead of -tls-cert-file and -tls-key-file, generate a self-signed certificate, stored in this Secret "+
+			"of -namespace, renewed before it expires, and trusted by patching the caBundle of "+
+			"-webhook-configuration")
+	flagSet.StringVar(&f.serviceName, "service", defaultWebhookServiceName,
+		"name of the Service of the webhook, the self-signed certificate is issued for")
+	flagSet.StringVar(&f.webhookConfigurationName, "webhook-configuration", defaultWebhookConfigurationName,
+		"name of the MutatingWebhookConfiguration to patch with the self-signed CA")
+	flagSet.DurationVar(&f.certCheckInterval, "cert-check-interval", time.Hour,
+		"how often the self-signed certificate is checked, and renewed if it is about to expire")
+	flagSet.StringVar(&f.policyFile, "policy-file", "",
+		"YAML file with the cluster-wide policy: a default policy, and policies per namespace")
+	flagSet.StringVar(&f.policyConfigMap, "policy-configmap", "",
+		"name of the ConfigMaps holding the policy of their namespace (key "+webhook.PolicyConfigMapKey+
+			"), overriding -policy-file")
+}
+
+func (f *webhookFlags) validate() error {
+	selfSigned := f.selfSignedSecret != ""
+	files := f.tlsCertFile != "" || f.tlsKeyFile != ""
+
+	switch {
+	case selfSigned && files:
+		return fmt.Errorf("%w: -self-signed-secret can't be used with -tls-cert-file and -tls-key-file",
+			errInvalidFlag)
+	case !selfSigned && (f.tlsCertFile == "" || f.tlsKeyFile == ""):
+		return fmt.Errorf("%w: TLS certificate and key (or -self-signed-secret) are required", errInvalidFlag)
+	case f.certCheckInterval <= 0:
+		return fmt.Errorf("%w: -cert-check-interval must be positive", errInvalidFlag)
+	}
+
+	return nil
+}
+
+func webhookMain(args []string) {
+	var flags webhookFlags
+
+	flagSet := flag.NewFlagSet(webhookSubcommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), `Usage: %[1]s %[2]s [OPTIONS] -tls-cert-file FILE -tls-key-file FILE
+  or:  %[1]s %[2]s [OPTIONS] -self-signed-secret NAME
+Serve a mutating admission webhook converting Pods, Jobs and CronJobs labelled with
+%[3]s: "true" when they are created. The webhook path is %[4]s.
+Policies (-policy-file, -policy-configmap) can change which objects are converted and how, per namespace.
+See "%[1]s %[5]s -help" to deploy it.
+
+`, commandName(os.Args[0]), webhookSubcommand, webhook.OptInKey, webhookPath, installSubcommand)
+		flagSet.PrintDefaults()
+	}
+	flags.register(flagSet)
+
+	if len(parseInterspersed(flagSet, args)) != 0 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	err := flags.validate()
+	if err != nil {
+		log.Println(err)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	opts, err := flags.options()
+	if err != nil {
+		log.Println(err)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = runWebhook(ctx, flags, opts)
+
+	stop()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runWebhook - sets up the self-signed certificate and policies if needed, and serves the webhook until ctx is done.
+func runWebhook(ctx context.Context, flags webhookFlags, opts []kueueleuleu.Option) error {
+	var (
+		client       kubernetes.Interface
+		namespace    string
+		policySource webhook.PolicySource
+		rotator      *webhook.CertificateRotator
+		err          error
+	)
+
+	if flags.selfSignedSecret != "" || flags.policyConfigMap != "" {
+		client, namespace, err = flags.client()
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.policyFile != "" {
+		policySource, err = webhook.LoadClusterPolicyFile(flags.policyFile)
+		if err != nil {
+			return fmt.Errorf("cannot load policy: %w", err)
+		}
+	}
+
+	if flags.policyConfigMap != "" {
+		policySource, err = startConfigMapPolicySource(ctx, client, flags.policyConfigMap, policySource)
+		if err != nil {
+			return err
+		}
+	}
+
+	handlerOpts := []webhook.Option{webhook.WithConvertOptions(opts...)}
+	if policySource != nil {
+		handlerOpts = append(handlerOpts, webhook.WithPolicySource(policySource))
+	}
+
+	if flags.selfSignedSecret != "" {
+		rotator, err = startCertificateRotator(ctx, client, namespace, flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	return serveWebhook(ctx, flags, rotator, handlerOpts)
+}
+
+// startConfigMapPolicySource - watches the policy ConfigMaps of all namespaces until ctx is done.
+func startConfigMapPolicySource(ctx context.Context, client kubernetes.Interface, name string,
+	base webhook.PolicySource,
+) (*webhook.ConfigMapPolicySource, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, policyResyncPeriod,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	lister := factory.Core().V1().ConfigMaps().Lister()
+
+	factory.Start(ctx.Done())
+
+	for _, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("%w: cannot list policy configmaps", context.Cause(ctx))
+		}
+	}
+
+	return webhook.NewConfigMapPolicySource(lister, name, base), nil
+}
+
+func newWebhookMux(opts ...webhook.Option) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath, webhook.NewHandler(opts...))
+	mux.HandleFunc(healthzPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return mux
+}
+
+// startCertificateRotator - generates (or loads) the self-signed certificate, and renews it in the background
+// until ctx is done.
+func startCertificateRotator(ctx context.Context, client kubernetes.Interface, namespace string,
+	flags webhookFlags,
+) (*webhook.CertificateRotator, error) {
+	rotator := webhook.NewCertificateRotator(client, namespace, flags.selfSignedSecret, flags.serviceName,
+		flags.webhookConfigurationName)
+
+	err := rotator.Rotate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set up self-signed certificate: %w", err)
+	}
+
+	go rotator.Run(ctx, flags.certCheckInterval)
+
+	return rotator, nil
+}
+
+// serveWebhook - serves the webhook until ctx is done, then shuts the server down gracefully.
+// The certificate is the one of the rotator if any, or the one of -tls-cert-file and -tls-key-file.
+func serveWebhook(ctx context.Context, flags webhookFlags, rotator *webhook.CertificateRotator,
+	opts []webhook.Option,
+) error {
+	server := &http.Server{
+		Addr:              flags.addr,
+		Handler:           newWebhookMux(opts...),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	certFile, keyFile := flags.tlsCertFile, flags.tlsKeyFile
+
+	if rotator != nil {
+		server.TLSConfig = &tls.Config{GetCertificate: rotator.GetCertificate, MinVersion: tls.VersionTLS12}
+		certFile, keyFile = "", ""
+	}
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		log.Printf("serving webhook on %s", flags.addr)
+		serveErr <- server.ListenAndServeTLS(certFile, keyFile)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("cannot serve webhook: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("cannot shut webhook server down: %w", err)
+	}
+
+	return nil
+}
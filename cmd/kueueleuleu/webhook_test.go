@@ -0,0 +1,126 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/norbjd/kueueleuleu/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_newWebhookMux(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(newWebhookMux())
+	defer server.Close()
+
+	healthz, err := http.Get(server.URL + healthzPath) //nolint:noctx
+	require.NoError(t, err)
+	healthz.Body.Close()
+	assert.Equal(t, http.StatusOK, healthz.StatusCode)
+
+	pod, err := json.Marshal(corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "not-opted-in"},
+	})
+	require.NoError(t, err)
+
+	request, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("uid"),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: pod},
+		},
+	})
+	require.NoError(t, err)
+
+	httpResponse, err := http.Post(server.URL+webhookPath, "application/json", bytes.NewReader(request)) //nolint:noctx
+	require.NoError(t, err)
+
+	defer httpResponse.Body.Close()
+
+	var response admissionv1.AdmissionReview
+	require.NoError(t, json.NewDecoder(httpResponse.Body).Decode(&response))
+	require.NotNil(t, response.Response)
+	assert.Equal(t, types.UID("uid"), response.Response.UID)
+	assert.True(t, response.Response.Allowed)
+}
+
+func Test_webhookFlags_validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args     []string
+		expected error
+	}{
+		{args: []string{"-tls-cert-file", "tls.crt", "-tls-key-file", "tls.key"}},
+		{args: []string{"-self-signed-secret", "secret"}},
+		{args: []string{}, expected: errInvalidFlag},
+		{args: []string{"-tls-cert-file", "tls.crt"}, expected: errInvalidFlag},
+		{args: []string{"-self-signed-secret", "secret", "-tls-cert-file", "tls.crt"}, expected: errInvalidFlag},
+		{args: []string{"-self-signed-secret", "secret", "-cert-check-interval", "0s"}, expected: errInvalidFlag},
+	}
+
+	for _, testCase := range tests {
+		var flags webhookFlags
+
+		flagSet := flag.NewFlagSet(webhookSubcommand, flag.ContinueOnError)
+		flags.register(flagSet)
+		require.NoError(t, flagSet.Parse(testCase.args))
+		assert.ErrorIs(t, flags.validate(), testCase.expected, testCase.args)
+	}
+}
+
+func Test_startConfigMapPolicySource(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kueueleuleu-policy", Namespace: "team-a"},
+		Data:       map[string]string{webhook.PolicyConfigMapKey: "mode: opt-out"},
+	})
+
+	source, err := startConfigMapPolicySource(ctx, client, "kueueleuleu-policy",
+		webhook.ClusterPolicy{Default: webhook.Policy{EntrypointImage: "mirror/entrypoint"}})
+	require.NoError(t, err)
+
+	policy, err := source.Policy("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{Mode: webhook.PolicyModeOptOut, EntrypointImage: "mirror/entrypoint"}, policy)
+
+	policy, err = source.Policy("team-b")
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{EntrypointImage: "mirror/entrypoint"}, policy)
+}
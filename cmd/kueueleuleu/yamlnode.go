@@ -0,0 +1,407 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/norbjd/kueueleuleu/internal/merge"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// yamlIndent - the indentation of the YAML written by the CLI (also used by kubectl, helm and kustomize).
+	yamlIndent = 2
+	// mergeKey - the key merging the fields of other mappings (e.g. "<<: *defaults").
+	mergeKey = "<<"
+)
+
+// transformNode - transforms the typed form of the object of node, and edits node with the changes only:
+// comments, key order, anchors, quoting style, and fields unknown to the Kubernetes API kueueleuleu is built with,
+// are kept. changed is false if the transformation did not change anything.
+func transformNode(node *yaml.Node, typedK8sObject metav1.Common, transform transformFunc) (bool, error) {
+	var k8sObject map[string]interface{}
+
+	err := node.Decode(&k8sObject)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errMalformedK8sObject, err)
+	}
+
+	transformed, err := transformObject(k8sObject, typedK8sObject, transform)
+	if err != nil {
+		return false, err
+	}
+
+	// typedK8sObject holds the original object, read by transformObject
+	if reflect.DeepEqual(typedK8sObject, transformed) {
+		return false, nil
+	}
+
+	before, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typedK8sObject)
+	if err != nil {
+		return false, fmt.Errorf("internal error: %w", err)
+	}
+
+	after, err := runtime.DefaultUnstructuredConverter.ToUnstructured(transformed)
+	if err != nil {
+		return false, fmt.Errorf("internal error: %w", err)
+	}
+
+	edited := copyNode(node)
+
+	err = mergeNode(edited, before, after)
+	if err != nil {
+		return false, err
+	}
+
+	matches, err := nodeMatches(edited, typedK8sObject, after)
+	if err != nil {
+		return false, err
+	}
+
+	if !matches {
+		// an edited anchor also changes its aliases: edit a copy without aliases instead
+		edited = expandAliases(node)
+
+		err = mergeNode(edited, before, after)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	*node = *edited
+
+	return true, nil
+}
+
+// nodeMatches - returns whether the typed form of node (an object of the same type as typedK8sObject) is expected.
+func nodeMatches(node *yaml.Node, typedK8sObject metav1.Common, expected map[string]interface{}) (bool, error) {
+	var k8sObject map[string]interface{}
+
+	err := node.Decode(&k8sObject)
+	if err != nil {
+		return false, fmt.Errorf("internal error: %w", err)
+	}
+
+	typedNodeObject, _ := reflect.New(reflect.TypeOf(typedK8sObject).Elem()).Interface().(metav1.Common)
+
+	nodeObject, err := transformObject(k8sObject, typedNodeObject, func(t metav1.Common) (metav1.Common, error) {
+		return t, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := runtime.DefaultUnstructuredConverter.ToUnstructured(nodeObject)
+	if err != nil {
+		return false, fmt.Errorf("internal error: %w", err)
+	}
+
+	return reflect.DeepEqual(expected, actual), nil
+}
+
+// encodeNode - returns the YAML of node, with the indentation of the CLI.
+func encodeNode(node *yaml.Node) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(yamlIndent)
+
+	removeMergeTags(node)
+
+	err := encoder.Encode(node)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write YAML: %w", err)
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot write YAML: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// removeMergeTags - removes the tag of merge keys, written as "!!merge <<" otherwise.
+func removeMergeTags(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!merge" {
+		node.Tag = ""
+	}
+
+	for _, child := range node.Content {
+		removeMergeTags(child)
+	}
+}
+
+// mergeNode - applies the changes between before and after (the typed forms of node, before and after
+// a transformation) to node (see merge.Merge).
+func mergeNode(node *yaml.Node, before, after interface{}) error {
+	return merge.Merge(nodeValue{node: node}, before, after) //nolint:wrapcheck
+}
+
+// nodeValue - a node edited by merge.Merge.
+type nodeValue struct {
+	node *yaml.Node
+}
+
+// resolveAlias - replaces an alias by a copy of its anchor: editing the anchor would also change its other aliases.
+func (v nodeValue) resolveAlias() {
+	if v.node.Kind == yaml.AliasNode {
+		*v.node = *copyNode(v.node.Alias)
+		v.node.Anchor = ""
+	}
+}
+
+func (v nodeValue) Mapping() (merge.Mapping, bool) {
+	v.resolveAlias()
+
+	if v.node.Kind == yaml.ScalarNode && v.node.Tag == "!!null" {
+		*v.node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: v.node.HeadComment,
+			LineComment: v.node.LineComment, FootComment: v.node.FootComment}
+	}
+
+	if v.node.Kind != yaml.MappingNode {
+		return nil, false
+	}
+
+	return mappingNode{node: v.node}, true
+}
+
+func (v nodeValue) Sequence() (merge.Sequence, bool) {
+	v.resolveAlias()
+
+	if v.node.Kind != yaml.SequenceNode {
+		return nil, false
+	}
+
+	return sequenceNode{node: v.node}, true
+}
+
+func (v nodeValue) Replace(value interface{}) error {
+	v.resolveAlias()
+
+	return replaceNode(v.node, value)
+}
+
+type mappingNode struct {
+	node *yaml.Node
+}
+
+func (m mappingNode) Field(key string) merge.Value {
+	valueNode := mappingValueOrMerged(m.node, key)
+	if valueNode == nil {
+		valueNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		addMappingKey(m.node, key, valueNode)
+	}
+
+	return nodeValue{node: valueNode}
+}
+
+func (m mappingNode) Remove(key string) {
+	removeMappingKey(m.node, key)
+}
+
+func (m mappingNode) Len() int {
+	return len(m.node.Content) / 2 //nolint:gomnd
+}
+
+type sequenceNode struct {
+	node *yaml.Node
+}
+
+func (s sequenceNode) Len() int {
+	return len(s.node.Content)
+}
+
+func (s sequenceNode) Item(index int) merge.Value {
+	return nodeValue{node: s.node.Content[index]}
+}
+
+func (s sequenceNode) NewItem() merge.Value {
+	return nodeValue{node: &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}}
+}
+
+func (s sequenceNode) SetItems(items []merge.Value) {
+	content := make([]*yaml.Node, 0, len(items))
+	for _, item := range items {
+		content = append(content, item.(nodeValue).node) //nolint:forcetypeassert
+	}
+
+	s.node.Content = content
+}
+
+// addMappingKey - appends the key to the mapping, except metadata, inserted before the spec like in the typed forms.
+func addMappingKey(mapping *yaml.Node, key string, value *yaml.Node) {
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+
+	if key == "metadata" {
+		for index := 0; index+1 < len(mapping.Content); index += 2 {
+			if mapping.Content[index].Value == "spec" {
+				mapping.Content = append(mapping.Content[:index],
+					append([]*yaml.Node{keyNode, value}, mapping.Content[index:]...)...)
+
+				return
+			}
+		}
+	}
+
+	mapping.Content = append(mapping.Content, keyNode, value)
+}
+
+// mappingValueOrMerged - returns the value of key in the mapping. When the key is only set by a merge key,
+// a copy of the merged value is added to the mapping (overriding the merged one), and returned.
+func mappingValueOrMerged(mapping *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(mapping, key); value != nil {
+		return value
+	}
+
+	merged := mappingValue(mapping, mergeKey)
+	if merged == nil {
+		return nil
+	}
+
+	sources := []*yaml.Node{merged}
+	if merged.Kind == yaml.SequenceNode {
+		sources = merged.Content
+	}
+
+	for _, source := range sources {
+		if source.Kind == yaml.AliasNode {
+			source = source.Alias
+		}
+
+		if value := mappingValue(source, key); value != nil {
+			value = copyNode(value)
+			addMappingKey(mapping, key, value)
+
+			return value
+		}
+	}
+
+	return nil
+}
+
+// removeMappingKey - removes the key from the mapping. Keys only set by a merge key can't be removed: they are
+// overridden with null.
+func removeMappingKey(mapping *yaml.Node, key string) {
+	for index := 0; index+1 < len(mapping.Content); index += 2 {
+		if mapping.Content[index].Value == key {
+			mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+
+			return
+		}
+	}
+
+	if mappingValueOrMerged(mapping, key) != nil {
+		*mappingValue(mapping, key) = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	}
+}
+
+// replaceNode - replaces node by the YAML of value, keeping its comments, and its style if possible
+// (e.g. flow sequences or quoted strings).
+func replaceNode(node *yaml.Node, value interface{}) error {
+	var replacement yaml.Node
+
+	err := replacement.Encode(value)
+	if err != nil {
+		return fmt.Errorf("internal error: %w", err)
+	}
+
+	if replacement.Kind == node.Kind && replacement.Tag == node.Tag {
+		replacement.Style = node.Style
+	}
+
+	if replacement.Kind == yaml.SequenceNode && node.Kind == yaml.SequenceNode && len(node.Content) > 0 {
+		keepItemsStyle(replacement.Content, node.Content)
+	}
+
+	replacement.HeadComment = node.HeadComment
+	replacement.LineComment = node.LineComment
+	replacement.FootComment = node.FootComment
+
+	*node = replacement
+
+	return nil
+}
+
+// keepItemsStyle - keeps the style of the previous items of a sequence of strings (e.g. command: ["sh", "-c"]):
+// items that were already there keep their own style (e.g. literal scripts), new items are quoted like the first one.
+func keepItemsStyle(items, previousItems []*yaml.Node) {
+	styles := make(map[string]yaml.Style)
+
+	for _, previousItem := range previousItems {
+		if _, found := styles[previousItem.Value]; !found && previousItem.Tag == "!!str" {
+			styles[previousItem.Value] = previousItem.Style
+		}
+	}
+
+	for _, item := range items {
+		if item.Kind != yaml.ScalarNode || item.Tag != "!!str" {
+			continue
+		}
+
+		if style, found := styles[item.Value]; found {
+			item.Style = style
+		} else if previousItems[0].Tag == "!!str" {
+			item.Style = previousItems[0].Style & (yaml.SingleQuotedStyle | yaml.DoubleQuotedStyle)
+		}
+	}
+}
+
+// expandAliases - returns a copy of node where aliases are replaced by a copy of their anchor, so that each copy
+// can be edited on its own.
+func expandAliases(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return expandAliases(node.Alias)
+	}
+
+	expanded := *node
+	expanded.Anchor = ""
+	expanded.Content = make([]*yaml.Node, len(node.Content))
+
+	for index, child := range node.Content {
+		expanded.Content[index] = expandAliases(child)
+	}
+
+	return &expanded
+}
+
+// copyNode - returns a deep copy of node. Aliases point to the copies of their anchors, if they are in node.
+func copyNode(node *yaml.Node) *yaml.Node {
+	return copyNodeWithAnchors(node, make(map[*yaml.Node]*yaml.Node))
+}
+
+func copyNodeWithAnchors(node *yaml.Node, copies map[*yaml.Node]*yaml.Node) *yaml.Node {
+	copied := *node
+	copies[node] = &copied
+
+	if copiedAlias, found := copies[node.Alias]; found {
+		copied.Alias = copiedAlias
+	}
+
+	copied.Content = make([]*yaml.Node, len(node.Content))
+
+	for index, child := range node.Content {
+		copied.Content[index] = copyNodeWithAnchors(child, copies)
+	}
+
+	return &copied
+}
@@ -17,82 +17,55 @@
 package kueueleuleu
 
 import (
-	"bytes"
-	"encoding/gob"
-	"errors"
-	"fmt"
-
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func ConvertPod(pod corev1.Pod) (corev1.Pod, error) {
-	var (
-		kueueleuleuPod corev1.Pod
-		err            error
-	)
+func ConvertPod(pod corev1.Pod, opts ...Option) (corev1.Pod, error) {
+	var err error
 
-	if errCopy := deepCopy(pod, &kueueleuleuPod); errCopy != nil {
-		return kueueleuleuPod, fmt.Errorf("can't convert pod: %w", errCopy)
-	}
+	kueueleuleuPod := *pod.DeepCopy()
+	objectMetas := []metav1.ObjectMeta{pod.ObjectMeta}
 
 	kueueleuleuPod.ObjectMeta = convertObjectMeta(kueueleuleuPod.ObjectMeta)
-	kueueleuleuPod.Spec, err = convertPodSpec(kueueleuleuPod.Spec)
+	kueueleuleuPod.Spec, err = convertPodSpecOnce(
+		kueueleuleuPod.Spec, &kueueleuleuPod.ObjectMeta, objectMetas, newOptions(opts))
 
 	return kueueleuleuPod, err
 }
 
-func ConvertJob(job batchv1.Job) (batchv1.Job, error) {
-	var (
-		kueueleuleuJob batchv1.Job
-		err            error
-	)
+func ConvertJob(job batchv1.Job, opts ...Option) (batchv1.Job, error) {
+	var err error
 
-	if errCopy := deepCopy(job, &kueueleuleuJob); errCopy != nil {
-		return kueueleuleuJob, fmt.Errorf("can't convert job: %w", errCopy)
-	}
+	kueueleuleuJob := *job.DeepCopy()
+	objectMetas := []metav1.ObjectMeta{job.ObjectMeta, job.Spec.Template.ObjectMeta}
 
 	kueueleuleuJob.ObjectMeta = convertObjectMeta(kueueleuleuJob.ObjectMeta)
 	kueueleuleuJob.Spec.Template.ObjectMeta = convertObjectMeta(kueueleuleuJob.Spec.Template.ObjectMeta)
-	kueueleuleuJob.Spec.Template.Spec, err = convertPodSpec(kueueleuleuJob.Spec.Template.Spec)
+	kueueleuleuJob.Spec.Template.Spec, err = convertPodSpecOnce(
+		kueueleuleuJob.Spec.Template.Spec, &kueueleuleuJob.Spec.Template.ObjectMeta, objectMetas, newOptions(opts))
 
 	return kueueleuleuJob, err
 }
 
-func ConvertCronJob(cronjob batchv1.CronJob) (batchv1.CronJob, error) {
-	var (
-		kueueleuleuCronjob batchv1.CronJob
-		err                error
-	)
+func ConvertCronJob(cronjob batchv1.CronJob, opts ...Option) (batchv1.CronJob, error) {
+	var err error
 
-	if errCopy := deepCopy(cronjob, &kueueleuleuCronjob); errCopy != nil {
-		return kueueleuleuCronjob, fmt.Errorf("can't convert cronjob: %w", errCopy)
+	kueueleuleuCronjob := *cronjob.DeepCopy()
+	objectMetas := []metav1.ObjectMeta{
+		cronjob.ObjectMeta,
+		cronjob.Spec.JobTemplate.ObjectMeta,
+		cronjob.Spec.JobTemplate.Spec.Template.ObjectMeta,
 	}
 
 	kueueleuleuCronjob.ObjectMeta = convertObjectMeta(kueueleuleuCronjob.ObjectMeta)
 	kueueleuleuCronjob.Spec.JobTemplate.ObjectMeta = convertObjectMeta(kueueleuleuCronjob.Spec.JobTemplate.ObjectMeta)
 	kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.ObjectMeta = convertObjectMeta(
 		kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.ObjectMeta)
-	kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.Spec, err = convertPodSpec(
-		kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.Spec)
+	kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.Spec, err = convertPodSpecOnce(
+		kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.Spec,
+		&kueueleuleuCronjob.Spec.JobTemplate.Spec.Template.ObjectMeta, objectMetas, newOptions(opts))
 
 	return kueueleuleuCronjob, err
 }
-
-var errInternal = errors.New("internal error")
-
-// deepCopy - copies src to dist
-// it might be slow, but we can always improve later if required.
-func deepCopy(src, dist any) error {
-	buf := bytes.Buffer{}
-
-	if err := gob.NewEncoder(&buf).Encode(src); err != nil {
-		return fmt.Errorf("%w: can't deep copy: %s", errInternal, err.Error())
-	}
-
-	if err := gob.NewDecoder(&buf).Decode(dist); err != nil {
-		return fmt.Errorf("%w: can't deep copy: %s", errInternal, err.Error())
-	}
-
-	return nil
-}
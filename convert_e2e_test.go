@@ -23,16 +23,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"testing"
 	"time"
 
-	"github.com/google/go-cmp/cmp"
 	"github.com/norbjd/kueueleuleu"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -105,6 +104,44 @@ var podSpecWhalesayInvalid = corev1.PodSpec{
 	RestartPolicy: "Never",
 }
 
+// podSpecRestricted - a pod spec compliant with the "restricted" pod security standard, running as non-root
+// with a read-only root filesystem.
+var podSpecRestricted = corev1.PodSpec{
+	SecurityContext: &corev1.PodSecurityContext{
+		RunAsNonRoot: toPtr(true),
+		RunAsUser:    toPtr(int64(1000)),
+		RunAsGroup:   toPtr(int64(1000)),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	},
+	Containers: []corev1.Container{
+		{
+			Name:            "step1",
+			Image:           "alpine",
+			Command:         []string{"sh", "-c"},
+			Args:            []string{"id -u && echo step1"},
+			SecurityContext: restrictedSecurityContext,
+		},
+		{
+			Name:            "step2",
+			Image:           "alpine",
+			Command:         []string{"sh", "-c"},
+			Args:            []string{"id -u && echo step2"},
+			SecurityContext: restrictedSecurityContext,
+		},
+	},
+	RestartPolicy: "Never",
+}
+
+var restrictedSecurityContext = &corev1.SecurityContext{
+	AllowPrivilegeEscalation: toPtr(false),
+	ReadOnlyRootFilesystem:   toPtr(true),
+	Capabilities: &corev1.Capabilities{
+		Drop: []corev1.Capability{"ALL"},
+	},
+}
+
 var whalesay = ` _ 
 <   >
  - 
@@ -190,7 +227,13 @@ func Test_CreatePod(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
-	waitUntilPodSucceeds(ctx, t, kubeClient, podCreated, 30*time.Second, debug)
+	waitCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, "default", podCreated.Name,
+		kueueleuleu.WithStepEventHandler(logStepEvent(t)))
+	require.NoError(t, err)
+	require.True(t, completion.Succeeded(), "pod has failed")
 }
 
 func Test_CreatePodSleep(t *testing.T) {
@@ -222,28 +265,53 @@ func Test_CreatePodSleep(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
-	results := waitUntilPodSucceeds(ctx, t, kubeClient, podCreated, 2*time.Minute, debug)
-	for _, result := range results {
-		t.Log(result)
-	}
+	start := time.Now()
+	startedSteps := make([]string, 0)
+	stepsStartedAt := make(map[string]time.Duration)
+	stepsFinishedAt := make(map[string]time.Duration)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, "default", podCreated.Name,
+		kueueleuleu.WithStepEventHandler(func(event kueueleuleu.StepEvent) {
+			logStepEvent(t)(event)
+
+			//nolint:exhaustive
+			switch event.Type {
+			case kueueleuleu.StepEventStarted:
+				startedSteps = append(startedSteps, event.Step.Name)
+				stepsStartedAt[event.Step.Name] = time.Since(start)
+			case kueueleuleu.StepEventFinished:
+				stepsFinishedAt[event.Step.Name] = time.Since(start)
+			}
+		}))
+	require.NoError(t, err)
+	require.True(t, completion.Succeeded(), "pod has failed")
 
-	require.GreaterOrEqual(t, len(results), 5)
+	assert.Equal(t, []string{"step1-sleep-5", "step2-sleep-10", "step3-sleep-20"}, startedSteps)
 
-	initSleep10StartedAt := results[0].t
-	step1Sleep5StartedAt := results[1].t
-	step2Sleep10StartedAt := results[2].t
-	step3Sleep20StartetAt := results[3].t
-	succeededAt := results[len(results)-1].t
+	// init containers are not steps: kubelet runs them before steps, their times are precise to the second
+	initContainerIndex := slices.IndexFunc(completion.Pod.Status.InitContainerStatuses,
+		func(initContainerStatus corev1.ContainerStatus) bool {
+			return initContainerStatus.Name == "init-sleep-10"
+		})
+	require.GreaterOrEqual(t, initContainerIndex, 0)
 
-	initSleep10StepDuration := step1Sleep5StartedAt - initSleep10StartedAt
-	step1Sleep5Duration := step2Sleep10StartedAt - step1Sleep5StartedAt
-	step2Sleep10Duration := step3Sleep20StartetAt - step2Sleep10StartedAt
-	step3Sleep20Duration := succeededAt - step3Sleep20StartetAt
+	initContainerTerminated := completion.Pod.Status.InitContainerStatuses[initContainerIndex].State.Terminated
+	require.NotNil(t, initContainerTerminated)
+	assert.GreaterOrEqual(t, initContainerTerminated.FinishedAt.Sub(initContainerTerminated.StartedAt.Time),
+		10*time.Second)
 
-	assert.GreaterOrEqual(t, initSleep10StepDuration, 10*time.Second)
-	assert.GreaterOrEqual(t, step1Sleep5Duration, 5*time.Second)
-	assert.GreaterOrEqual(t, step2Sleep10Duration, 10*time.Second)
-	assert.GreaterOrEqual(t, step3Sleep20Duration, 20*time.Second)
+	expectedStepDurations := map[string]time.Duration{
+		"step1-sleep-5":  5 * time.Second,
+		"step2-sleep-10": 10 * time.Second,
+		"step3-sleep-20": 20 * time.Second,
+	}
+
+	for stepName, expectedStepDuration := range expectedStepDurations {
+		assert.GreaterOrEqual(t, stepsFinishedAt[stepName]-stepsStartedAt[stepName], expectedStepDuration, stepName)
+	}
 }
 
 func Test_CreatePodWhalesayValid(t *testing.T) {
@@ -275,10 +343,15 @@ func Test_CreatePodWhalesayValid(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
-	_ = waitUntilPodSucceeds(ctx, t, kubeClient, podCreated, 2*time.Minute, debug)
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
 
-	getPod, err := kubeClient.CoreV1().Pods("default").Get(context.Background(), podCreated.Name, metav1.GetOptions{})
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, "default", podCreated.Name,
+		kueueleuleu.WithStepEventHandler(logStepEvent(t)))
 	require.NoError(t, err)
+	require.True(t, completion.Succeeded(), "pod has failed")
+
+	getPod := completion.Pod
 
 	// this works because the first container name (say-hello) is before the second one (say-nothing) in alphabetical order
 	// container statuses order does not honor containers order
@@ -317,75 +390,266 @@ func Test_CreatePodWhalesayInvalid(t *testing.T) {
 	require.ErrorContains(t, err, "say-goodbye")
 }
 
-type podEvent struct {
-	t                    time.Duration
-	runningContainerName string
-	podSucceeded         bool
-}
+func Test_CreatePodRestricted(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := getKubeClient(t)
+	ctx := context.Background()
 
-func (e podEvent) String() string {
-	s := fmt.Sprintf("[%s] %s", e.t.Round(time.Second), e.runningContainerName)
-	if e.podSucceeded {
-		s += " (succeeded)"
+	namespace, err := kubeClient.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("restricted-%s", uuid.NewUUID()),
+			Labels: map[string]string{
+				"pod-security.kubernetes.io/enforce": "restricted",
+			},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	defer func() {
+		err = kubeClient.CoreV1().Namespaces().Delete(ctx, namespace.Name, metav1.DeleteOptions{})
+		require.NoError(t, err)
+	}()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("restricted-%s", uuid.NewUUID()),
+			Namespace: namespace.Name,
+		},
+		Spec: podSpecRestricted,
 	}
 
-	return s
-}
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
 
-func waitUntilPodSucceeds(ctx context.Context, t *testing.T,
-	kubeClient kubernetes.Interface, pod *corev1.Pod, timeout time.Duration, debug bool,
-) []podEvent {
-	t.Helper()
+	// admission fails here if the pod does not comply with the "restricted" pod security standard
+	podCreated, err := kubeClient.CoreV1().
+		Pods(namespace.Name).
+		Create(ctx, &kueueleuleuPod, metav1.CreateOptions{})
+	require.NoError(t, err)
 
-	results := make([]podEvent, 0)
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
 
-	watcher, err := kubeClient.CoreV1().Pods(pod.Namespace).Watch(ctx, metav1.ListOptions{
-		FieldSelector:  fields.OneTermEqualSelector(metav1.ObjectNameField, pod.Name).String(),
-		TimeoutSeconds: toPtr(int64(timeout.Seconds())),
-		Limit:          10,
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, namespace.Name, podCreated.Name,
+		kueueleuleu.WithStepEventHandler(logStepEvent(t)))
+	require.NoError(t, err)
+	require.True(t, completion.Succeeded(), "pod has failed")
+
+	logsReq := kubeClient.CoreV1().Pods(namespace.Name).GetLogs(podCreated.Name, &corev1.PodLogOptions{
+		Container: "step2",
 	})
+	podLogs, err := logsReq.Stream(ctx)
 	require.NoError(t, err)
 
-	currentPod := *pod
+	defer podLogs.Close()
+	logs, err := io.ReadAll(podLogs)
+	require.NoError(t, err)
 
-	runningContainerName := ""
+	assert.Equal(t, "1000\nstep2\n", string(logs))
+}
 
-	start := time.Now()
+func Test_CreatePodContinueOnError(t *testing.T) {
+	t.Parallel()
 
-	for event := range watcher.ResultChan() {
-		eventPod, _ := event.Object.(*corev1.Pod)
+	kubeClient := getKubeClient(t)
+	ctx := context.Background()
 
-		if debug {
-			t.Log(cmp.Diff(currentPod, *eventPod))
-		}
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("continue-on-error-%s", uuid.NewUUID()),
+			Namespace: "default",
+			Annotations: map[string]string{
+				"norbjd.github.io/kueueleuleu-on-error": "best-effort=continue",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "best-effort",
+					Image:   "alpine",
+					Command: []string{"sh", "-c", "exit 3"},
+				},
+				{
+					Name:    "grep",
+					Image:   "alpine",
+					Command: []string{"grep", "nothing", "/etc/hostname"},
+				},
+				{
+					Name:    "last",
+					Image:   "alpine",
+					Command: []string{"echo", "last"},
+				},
+			},
+			RestartPolicy: "Never",
+		},
+	}
 
-		currentPod = *eventPod
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod, kueueleuleu.WithStepSuccessExitCodes("grep", 1))
+	require.NoError(t, err)
 
-		//nolint:exhaustive
-		switch eventPod.Status.Phase {
-		case corev1.PodSucceeded:
-			result := podEvent{t: time.Since(start), runningContainerName: "", podSucceeded: true}
-			results = append(results, result)
+	podCreated, err := kubeClient.CoreV1().
+		Pods(pod.Namespace).
+		Create(ctx, &kueueleuleuPod, metav1.CreateOptions{})
+	require.NoError(t, err)
 
-			return results
-		case corev1.PodFailed:
-			t.Fatal("pod has failed")
-		default:
-			break
-		}
+	defer func() {
+		err = kubeClient.CoreV1().Pods(pod.Namespace).Delete(ctx, podCreated.Name, metav1.DeleteOptions{})
+		require.NoError(t, err)
+	}()
 
-		currentlyRunningContainerName, _ := kueueleuleu.GetRunningContainerName(*eventPod)
-		if currentlyRunningContainerName != runningContainerName {
-			runningContainerName = currentlyRunningContainerName
-		} else {
-			continue
-		}
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, pod.Namespace, podCreated.Name,
+		kueueleuleu.WithStepEventHandler(logStepEvent(t)))
+	require.NoError(t, err)
+	require.True(t, completion.Succeeded(), "pod has failed")
+
+	podSucceeded := completion.Pod
+
+	expectedStepResults := []kueueleuleu.StepResult{
+		{Name: "best-effort", State: kueueleuleu.StepFailedContinued, ExitCode: 3},
+		{Name: "grep", State: kueueleuleu.StepSucceeded, ExitCode: 1},
+		{Name: "last", State: kueueleuleu.StepSucceeded, ExitCode: 0},
+	}
+
+	for _, expectedStepResult := range expectedStepResults {
+		stepResult, err := kueueleuleu.GetStepResult(*podSucceeded, expectedStepResult.Name)
+		require.NoError(t, err)
+		assert.Equal(t, expectedStepResult, stepResult)
+	}
+}
+
+func Test_CreatePodUnlistedExitCode(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := getKubeClient(t)
+	ctx := context.Background()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("unlisted-exit-code-%s", uuid.NewUUID()),
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "diff",
+					Image:   "alpine",
+					Command: []string{"sh", "-c", "exit 2"},
+				},
+				{
+					Name:    "never-run",
+					Image:   "alpine",
+					Command: []string{"echo", "never-run"},
+				},
+			},
+			RestartPolicy: "Never",
+		},
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod, kueueleuleu.WithStepSuccessExitCodes("diff", 1))
+	require.NoError(t, err)
+
+	podCreated, err := kubeClient.CoreV1().
+		Pods(pod.Namespace).
+		Create(ctx, &kueueleuleuPod, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	defer func() {
+		err = kubeClient.CoreV1().Pods(pod.Namespace).Delete(ctx, podCreated.Name, metav1.DeleteOptions{})
+		require.NoError(t, err)
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, pod.Namespace, podCreated.Name)
+	require.NoError(t, err)
+	assert.False(t, completion.Succeeded())
+	require.NotNil(t, completion.FailedStep)
+	assert.Equal(t, "diff", completion.FailedStep.Name)
+	assert.Equal(t, int32(2), completion.FailedStep.ExitCode)
 
-		result := podEvent{t: time.Since(start), runningContainerName: currentlyRunningContainerName, podSucceeded: false}
-		results = append(results, result)
+	stepStatuses, err := kueueleuleu.GetStepStatuses(*completion.Pod)
+	require.NoError(t, err)
+	require.Len(t, stepStatuses, 2)
+	assert.Equal(t, kueueleuleu.StepFailed, stepStatuses[0].State)
+	assert.Equal(t, kueueleuleu.StepSkipped, stepStatuses[1].State)
+}
+
+func Test_CreatePodStepTimeout(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := getKubeClient(t)
+	ctx := context.Background()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("step-timeout-%s", uuid.NewUUID()),
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "hung",
+					Image:   "alpine",
+					Command: []string{"sleep", "3600"},
+				},
+				{
+					Name:    "never-run",
+					Image:   "alpine",
+					Command: []string{"echo", "never-run"},
+				},
+			},
+			RestartPolicy: "Never",
+		},
 	}
 
-	t.Fatalf("timeout exceeded, pod was not succeeded after %s", timeout)
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod, kueueleuleu.WithStepTimeout("hung", 5*time.Second))
+	require.NoError(t, err)
 
-	return nil
+	podCreated, err := kubeClient.CoreV1().
+		Pods(pod.Namespace).
+		Create(ctx, &kueueleuleuPod, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	defer func() {
+		err = kubeClient.CoreV1().Pods(pod.Namespace).Delete(ctx, podCreated.Name, metav1.DeleteOptions{})
+		require.NoError(t, err)
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	completion, err := kueueleuleu.WaitForCompletion(waitCtx, kubeClient, pod.Namespace, podCreated.Name)
+	require.NoError(t, err)
+	assert.False(t, completion.Succeeded())
+	require.NotNil(t, completion.FailedStep)
+	assert.Equal(t, "hung", completion.FailedStep.Name)
+
+	podFailed := completion.Pod
+
+	timedOutContainerName, err := kueueleuleu.GetTimedOutContainerName(*podFailed)
+	require.NoError(t, err)
+	assert.Equal(t, "hung", timedOutContainerName)
+
+	stepStatuses, err := kueueleuleu.GetStepStatuses(*podFailed)
+	require.NoError(t, err)
+	require.Len(t, stepStatuses, 2)
+	assert.Equal(t, kueueleuleu.StepTimedOut, stepStatuses[0].State)
+	assert.Equal(t, kueueleuleu.StepSkipped, stepStatuses[1].State)
+	assert.False(t, stepStatuses[0].StartedAt.IsZero())
+}
+
+// logStepEvent - returns a step event handler logging events in debug mode.
+func logStepEvent(t *testing.T) func(kueueleuleu.StepEvent) {
+	t.Helper()
+
+	return func(event kueueleuleu.StepEvent) {
+		if debug {
+			t.Logf("%s %s (%s)", event.Type, event.Step.Name, event.Step.State)
+		}
+	}
 }
@@ -212,3 +212,157 @@ func Test_ConvertCronJob(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, kueueleuleu.IsKueueleuleu(kueueleuleuCronJob.ObjectMeta))
 }
+
+func Test_ConvertPod_alreadyConverted(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	convertedTwice, err := kueueleuleu.ConvertPod(kueueleuleuPod)
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleuPod, convertedTwice)
+
+	reconverted, err := kueueleuleu.ConvertPod(kueueleuleuPod,
+		kueueleuleu.WithAlreadyConvertedPolicy(kueueleuleu.AlreadyConvertedReconvert))
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleuPod, reconverted)
+
+	_, err = kueueleuleu.ConvertPod(kueueleuleuPod,
+		kueueleuleu.WithAlreadyConvertedPolicy(kueueleuleu.AlreadyConvertedFail))
+	require.ErrorIs(t, err, kueueleuleu.ErrAlreadyConverted)
+
+	// the annotation might have been removed, but the pod spec is still converted
+	kueueleuleuPod.Annotations = nil
+
+	_, err = kueueleuleu.ConvertPod(kueueleuleuPod,
+		kueueleuleu.WithAlreadyConvertedPolicy(kueueleuleu.AlreadyConvertedFail))
+	require.ErrorIs(t, err, kueueleuleu.ErrAlreadyConverted)
+
+	convertedTwice, err = kueueleuleu.ConvertPod(kueueleuleuPod)
+	require.NoError(t, err)
+	assert.True(t, kueueleuleu.IsKueueleuleu(convertedTwice.ObjectMeta))
+	assert.Len(t, convertedTwice.Spec.InitContainers, len(podSpec.InitContainers)+1)
+}
+
+func Test_ConvertJob_alreadyConverted(t *testing.T) {
+	t.Parallel()
+
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: podSpec,
+			},
+		},
+	}
+
+	kueueleuleuJob, err := kueueleuleu.ConvertJob(job)
+	require.NoError(t, err)
+
+	convertedTwice, err := kueueleuleu.ConvertJob(kueueleuleuJob)
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleuJob, convertedTwice)
+
+	_, err = kueueleuleu.ConvertJob(kueueleuleuJob,
+		kueueleuleu.WithAlreadyConvertedPolicy(kueueleuleu.AlreadyConvertedFail))
+	require.ErrorIs(t, err, kueueleuleu.ErrAlreadyConverted)
+}
+
+func Test_ConvertPod_withOptions(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: *podSpec.DeepCopy(),
+	}
+	pod.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "existing"}}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithEntrypointImage("registry.example.com/tekton/entrypoint:v0.55.0"),
+		kueueleuleu.WithEntrypointImagePullPolicy(corev1.PullIfNotPresent),
+		kueueleuleu.WithImagePullSecrets("existing", "mirror"),
+	)
+	require.NoError(t, err)
+
+	prepareInitContainer := kueueleuleuPod.Spec.InitContainers[0]
+	assert.Equal(t, "registry.example.com/tekton/entrypoint:v0.55.0", prepareInitContainer.Image)
+	assert.Equal(t, corev1.PullIfNotPresent, prepareInitContainer.ImagePullPolicy)
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "existing"}, {Name: "mirror"}},
+		kueueleuleuPod.Spec.ImagePullSecrets)
+
+	kueueleuleuPod, err = kueueleuleu.ConvertPod(pod, kueueleuleu.WithEntrypointImage(""))
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.DefaultEntrypointImage, kueueleuleuPod.Spec.InitContainers[0].Image)
+	assert.Empty(t, kueueleuleuPod.Spec.InitContainers[0].ImagePullPolicy)
+}
+
+func Test_ConvertPod_securityContext(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+	assert.Equal(t, &corev1.SecurityContext{
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		RunAsUser:                toPtr(int64(65532)),
+		RunAsGroup:               toPtr(int64(65532)),
+		RunAsNonRoot:             toPtr(true),
+		ReadOnlyRootFilesystem:   toPtr(true),
+		AllowPrivilegeEscalation: toPtr(false),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}, kueueleuleuPod.Spec.InitContainers[0].SecurityContext)
+
+	for _, container := range kueueleuleuPod.Spec.Containers {
+		assert.Equal(t, "/tekton/termination", container.TerminationMessagePath)
+	}
+
+	pod.Spec = *podSpec.DeepCopy()
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsUser:  toPtr(int64(1000)),
+		RunAsGroup: toPtr(int64(3000)),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type:             corev1.SeccompProfileTypeLocalhost,
+			LocalhostProfile: toPtr("profiles/audit.json"),
+		},
+	}
+	pod.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+
+	kueueleuleuPod, err = kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	securityContext := kueueleuleuPod.Spec.InitContainers[0].SecurityContext
+	assert.Equal(t, toPtr(int64(1000)), securityContext.RunAsUser)
+	assert.Equal(t, toPtr(int64(3000)), securityContext.RunAsGroup)
+	assert.Nil(t, securityContext.SeccompProfile, "the pod seccomp profile should be inherited")
+
+	firstContainer := kueueleuleuPod.Spec.Containers[0]
+	assert.Equal(t, "/dev/termination-log", firstContainer.TerminationMessagePath)
+	assert.Contains(t, firstContainer.Args, "-termination_path")
+	assert.Contains(t, firstContainer.Args, "/dev/termination-log")
+
+	revertedPod, err := kueueleuleu.RevertPod(kueueleuleuPod)
+	require.NoError(t, err)
+	assert.Equal(t, pod, revertedPod)
+}
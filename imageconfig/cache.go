@@ -0,0 +1,111 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package imageconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+)
+
+const (
+	cacheDirPermissions  = 0o700
+	cacheFilePermissions = 0o600
+)
+
+// diskCache - caches image commands on disk, one JSON file per image and platform.
+type diskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+func (c *diskCache) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// get - returns the cached image command, if any. Entries older than the TTL are ignored, unless neverExpires.
+func (c *diskCache) get(key string, neverExpires bool) (kueueleuleu.ImageCommand, bool) {
+	path := c.path(key)
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, false
+	}
+
+	if !neverExpires && time.Since(fileInfo.ModTime()) > c.ttl {
+		return kueueleuleu.ImageCommand{}, false
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, false
+	}
+
+	var imageCommand kueueleuleu.ImageCommand
+	if err := json.Unmarshal(content, &imageCommand); err != nil {
+		return kueueleuleu.ImageCommand{}, false
+	}
+
+	return imageCommand, true
+}
+
+func (c *diskCache) put(key string, imageCommand kueueleuleu.ImageCommand) error {
+	content, err := json.Marshal(imageCommand)
+	if err != nil {
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	if err := os.MkdirAll(c.dir, cacheDirPermissions); err != nil {
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	// write then rename, so concurrent readers never read a partial file
+	tmpFile, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	if err := os.Chmod(tmpFile.Name(), cacheFilePermissions); err != nil {
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("cannot write cache: %w", err)
+	}
+
+	return nil
+}
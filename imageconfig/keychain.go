@@ -0,0 +1,153 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package imageconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var ErrInvalidPullSecret = errors.New("invalid image pull secret")
+
+// SecretGetter - retrieves an image pull secret.
+type SecretGetter func(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+
+// SecretGetterFromClient - retrieves image pull secrets with a kubernetes client.
+func SecretGetterFromClient(client kubernetes.Interface) SecretGetter {
+	return func(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot get secret %s/%s: %w", namespace, name, err)
+		}
+
+		return secret, nil
+	}
+}
+
+type dockerConfigEntry struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// dockerConfigKeychain - a keychain built from the content of image pull secrets, keyed by registry.
+type dockerConfigKeychain map[string]authn.AuthConfig
+
+func (k dockerConfigKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	if authConfig, found := k[resource.RegistryStr()]; found {
+		return authn.FromConfig(authConfig), nil
+	}
+
+	return authn.Anonymous, nil
+}
+
+func keychainFromSecrets(ctx context.Context, secretGetter SecretGetter, namespace string,
+	imagePullSecrets []corev1.LocalObjectReference,
+) (authn.Keychain, error) {
+	keychains := make([]authn.Keychain, 0, len(imagePullSecrets))
+
+	for _, imagePullSecret := range imagePullSecrets {
+		secret, err := secretGetter(ctx, namespace, imagePullSecret.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		keychain, err := keychainFromSecret(secret)
+		if err != nil {
+			return nil, fmt.Errorf("%w (secret %s): %w", ErrInvalidPullSecret, imagePullSecret.Name, err)
+		}
+
+		keychains = append(keychains, keychain)
+	}
+
+	return authn.NewMultiKeychain(keychains...), nil
+}
+
+func keychainFromSecret(secret *corev1.Secret) (dockerConfigKeychain, error) {
+	var entries map[string]dockerConfigEntry
+
+	//nolint:exhaustive
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var config dockerConfigJSON
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", corev1.DockerConfigJsonKey, err)
+		}
+
+		entries = config.Auths
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &entries); err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", corev1.DockerConfigKey, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported secret type %s", secret.Type) //nolint:goerr113
+	}
+
+	keychain := make(dockerConfigKeychain)
+
+	for registry, entry := range entries {
+		authConfig := authn.AuthConfig{
+			Username: entry.Username,
+			Password: entry.Password,
+		}
+
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode auth of %s: %w", registry, err)
+			}
+
+			authConfig.Username, authConfig.Password, _ = strings.Cut(string(decoded), ":")
+		}
+
+		keychain[normalizeRegistry(registry)] = authConfig
+	}
+
+	return keychain, nil
+}
+
+// normalizeRegistry - converts registries as found in docker configs (e.g. https://index.docker.io/v1/)
+// to registries as returned by authn.Resource.RegistryStr (e.g. index.docker.io).
+func normalizeRegistry(registry string) string {
+	if parsedURL, err := url.Parse(registry); err == nil && parsedURL.Host != "" {
+		registry = parsedURL.Host
+	}
+
+	registry, _, _ = strings.Cut(registry, "/")
+
+	switch registry {
+	case "docker.io", "registry-1.docker.io":
+		return name.DefaultRegistry
+	default:
+		return registry
+	}
+}
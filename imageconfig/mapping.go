@@ -0,0 +1,113 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package imageconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/norbjd/kueueleuleu"
+	"sigs.k8s.io/yaml"
+)
+
+var ErrImageNotInMapping = errors.New("image not found in mapping")
+
+// MappingResolver - resolves the command of images from a user-supplied mapping, without contacting any registry.
+type MappingResolver struct {
+	commands map[string]kueueleuleu.ImageCommand
+}
+
+// NewMappingResolver - creates a resolver from a mapping of images to their commands. Images are normalized,
+// so "alpine" and "docker.io/library/alpine:latest" are the same image.
+func NewMappingResolver(commands map[string]kueueleuleu.ImageCommand) (*MappingResolver, error) {
+	resolver := &MappingResolver{
+		commands: make(map[string]kueueleuleu.ImageCommand, len(commands)),
+	}
+
+	for image, imageCommand := range commands {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image in mapping: %w", err)
+		}
+
+		resolver.commands[ref.Name()] = imageCommand
+	}
+
+	return resolver, nil
+}
+
+// LoadMappingFile - creates a resolver from a YAML (or JSON) file mapping images to their commands, e.g.:
+//
+//	docker/whalesay:
+//	  cmd: ["/bin/bash"]
+//	registry.example.com/tools/migrate:v1.2.0:
+//	  entrypoint: ["/usr/bin/migrate"]
+//	  cmd: ["up"]
+func LoadMappingFile(path string) (*MappingResolver, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mapping file: %w", err)
+	}
+
+	var commands map[string]kueueleuleu.ImageCommand
+	if err := yaml.UnmarshalStrict(content, &commands); err != nil {
+		return nil, fmt.Errorf("cannot read mapping file: %w", err)
+	}
+
+	return NewMappingResolver(commands)
+}
+
+// ResolveImageCommand - implements kueueleuleu.CommandResolver.
+func (m *MappingResolver) ResolveImageCommand(_ context.Context,
+	request kueueleuleu.ImageCommandRequest,
+) (kueueleuleu.ImageCommand, error) {
+	ref, err := name.ParseReference(request.Image)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, fmt.Errorf("%w: %w", ErrImageNotInMapping, err)
+	}
+
+	imageCommand, found := m.commands[ref.Name()]
+	if !found {
+		return kueueleuleu.ImageCommand{}, fmt.Errorf("%w: %s", ErrImageNotInMapping, request.Image)
+	}
+
+	return imageCommand, nil
+}
+
+// Chain - tries resolvers in order, and returns the first resolved command.
+type Chain []kueueleuleu.CommandResolver
+
+// ResolveImageCommand - implements kueueleuleu.CommandResolver.
+func (c Chain) ResolveImageCommand(ctx context.Context,
+	request kueueleuleu.ImageCommandRequest,
+) (kueueleuleu.ImageCommand, error) {
+	var err error
+
+	for _, resolver := range c {
+		imageCommand, errResolve := resolver.ResolveImageCommand(ctx, request)
+		if errResolve == nil {
+			return imageCommand, nil
+		}
+
+		err = errors.Join(err, errResolve)
+	}
+
+	return kueueleuleu.ImageCommand{}, err
+}
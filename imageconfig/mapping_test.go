@@ -0,0 +1,94 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package imageconfig_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/imageconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadMappingFile(t *testing.T) {
+	t.Parallel()
+
+	mappingFile := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(mappingFile, []byte(`
+alpine:
+  cmd: ["/bin/sh"]
+registry.example.com/tools/migrate:v1.2.0:
+  entrypoint: ["/usr/bin/migrate"]
+  cmd: ["up"]
+`), 0o600))
+
+	resolver, err := imageconfig.LoadMappingFile(mappingFile)
+	require.NoError(t, err)
+
+	// images are normalized
+	imageCommand, err := resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: "docker.io/library/alpine:latest",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.ImageCommand{Cmd: []string{"/bin/sh"}}, imageCommand)
+
+	imageCommand, err = resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: "registry.example.com/tools/migrate:v1.2.0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.ImageCommand{
+		Entrypoint: []string{"/usr/bin/migrate"},
+		Cmd:        []string{"up"},
+	}, imageCommand)
+
+	_, err = resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: "registry.example.com/tools/migrate:v1.3.0",
+	})
+	require.ErrorIs(t, err, imageconfig.ErrImageNotInMapping)
+}
+
+func Test_Chain(t *testing.T) {
+	t.Parallel()
+
+	first, err := imageconfig.NewMappingResolver(map[string]kueueleuleu.ImageCommand{
+		"alpine": {Cmd: []string{"/bin/sh"}},
+	})
+	require.NoError(t, err)
+
+	second, err := imageconfig.NewMappingResolver(map[string]kueueleuleu.ImageCommand{
+		"alpine":  {Cmd: []string{"/bin/ash"}},
+		"busybox": {Cmd: []string{"sh"}},
+	})
+	require.NoError(t, err)
+
+	chain := imageconfig.Chain{first, second}
+
+	imageCommand, err := chain.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{Image: "alpine"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh"}, imageCommand.Cmd)
+
+	imageCommand, err = chain.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{Image: "busybox"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sh"}, imageCommand.Cmd)
+
+	_, err = chain.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{Image: "ubuntu"})
+	require.ErrorIs(t, err, imageconfig.ErrImageNotInMapping)
+}
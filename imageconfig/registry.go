@@ -0,0 +1,201 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package imageconfig provides implementations of kueueleuleu.CommandResolver, resolving the command
+// of containers from their image configuration (ENTRYPOINT and CMD), either from an OCI registry
+// or from a user-supplied mapping (for offline use).
+package imageconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/norbjd/kueueleuleu"
+)
+
+const (
+	defaultCacheTTL = 24 * time.Hour
+	defaultTimeout  = 30 * time.Second
+)
+
+var ErrCannotFetchImageConfig = errors.New("cannot fetch image config")
+
+// RegistryResolver - resolves the command of images by fetching their configuration from an OCI registry.
+type RegistryResolver struct {
+	keychain     authn.Keychain
+	secretGetter SecretGetter
+	platform     v1.Platform
+	cache        *diskCache
+	timeout      time.Duration
+}
+
+// RegistryOption - customizes a RegistryResolver.
+type RegistryOption func(*RegistryResolver)
+
+// NewRegistryResolver - creates a resolver authenticating to registries with the docker config credentials
+// (~/.docker/config.json, or $DOCKER_CONFIG/config.json) and the pod image pull secrets if WithSecretGetter is set.
+// Without WithCacheDir, image configurations are not cached.
+func NewRegistryResolver(opts ...RegistryOption) *RegistryResolver {
+	resolver := &RegistryResolver{
+		keychain: authn.DefaultKeychain,
+		platform: v1.Platform{
+			OS:           "linux",
+			Architecture: "amd64",
+		},
+		timeout: defaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(resolver)
+	}
+
+	return resolver
+}
+
+// WithKeychain - replaces the default keychain (docker config credentials).
+func WithKeychain(keychain authn.Keychain) RegistryOption {
+	return func(r *RegistryResolver) {
+		r.keychain = keychain
+	}
+}
+
+// WithSecretGetter - uses the pod image pull secrets, retrieved with the getter, to authenticate to registries.
+// They take precedence over the keychain.
+func WithSecretGetter(secretGetter SecretGetter) RegistryOption {
+	return func(r *RegistryResolver) {
+		r.secretGetter = secretGetter
+	}
+}
+
+// WithPlatform - sets the platform used to pick an image from multi-platform images (default: linux/amd64).
+func WithPlatform(platform v1.Platform) RegistryOption {
+	return func(r *RegistryResolver) {
+		r.platform = platform
+	}
+}
+
+// WithCacheDir - caches image configurations on disk, in dir. Images referenced by digest are cached forever,
+// others (referenced by tag) for 24 hours unless WithCacheTTL is set.
+func WithCacheDir(dir string) RegistryOption {
+	return func(r *RegistryResolver) {
+		if r.cache == nil {
+			r.cache = &diskCache{ttl: defaultCacheTTL}
+		}
+
+		r.cache.dir = dir
+	}
+}
+
+// WithCacheTTL - sets how long image configurations of images referenced by tag are cached (see WithCacheDir).
+func WithCacheTTL(ttl time.Duration) RegistryOption {
+	return func(r *RegistryResolver) {
+		if r.cache == nil {
+			r.cache = &diskCache{}
+		}
+
+		r.cache.ttl = ttl
+	}
+}
+
+// WithTimeout - sets the timeout to fetch an image configuration (default: 30 seconds).
+func WithTimeout(timeout time.Duration) RegistryOption {
+	return func(r *RegistryResolver) {
+		r.timeout = timeout
+	}
+}
+
+// ResolveImageCommand - implements kueueleuleu.CommandResolver.
+func (r *RegistryResolver) ResolveImageCommand(ctx context.Context,
+	request kueueleuleu.ImageCommandRequest,
+) (kueueleuleu.ImageCommand, error) {
+	ref, err := name.ParseReference(request.Image)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, fmt.Errorf("%w: %w", ErrCannotFetchImageConfig, err)
+	}
+
+	_, pinnedByDigest := ref.(name.Digest)
+	cacheKey := ref.Name() + "@" + r.platform.String()
+
+	if r.cache != nil && r.cache.dir != "" {
+		if imageCommand, found := r.cache.get(cacheKey, pinnedByDigest); found {
+			return imageCommand, nil
+		}
+	}
+
+	imageCommand, err := r.fetch(ctx, ref, request)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, err
+	}
+
+	if r.cache != nil && r.cache.dir != "" {
+		// the cache is only an optimization, failing to write it must not fail the conversion
+		_ = r.cache.put(cacheKey, imageCommand)
+	}
+
+	return imageCommand, nil
+}
+
+func (r *RegistryResolver) fetch(ctx context.Context, ref name.Reference,
+	request kueueleuleu.ImageCommandRequest,
+) (kueueleuleu.ImageCommand, error) {
+	keychain, err := r.keychainFor(ctx, request)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, fmt.Errorf("%w: %w", ErrCannotFetchImageConfig, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	image, err := remote.Image(ref,
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithPlatform(r.platform),
+	)
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, fmt.Errorf("%w: %w", ErrCannotFetchImageConfig, err)
+	}
+
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return kueueleuleu.ImageCommand{}, fmt.Errorf("%w: %w", ErrCannotFetchImageConfig, err)
+	}
+
+	return kueueleuleu.ImageCommand{
+		Entrypoint: configFile.Config.Entrypoint,
+		Cmd:        configFile.Config.Cmd,
+	}, nil
+}
+
+func (r *RegistryResolver) keychainFor(ctx context.Context,
+	request kueueleuleu.ImageCommandRequest,
+) (authn.Keychain, error) {
+	if r.secretGetter == nil || len(request.ImagePullSecrets) == 0 {
+		return r.keychain, nil
+	}
+
+	secretsKeychain, err := keychainFromSecrets(ctx, r.secretGetter, request.Namespace, request.ImagePullSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return authn.NewMultiKeychain(secretsKeychain, r.keychain), nil
+}
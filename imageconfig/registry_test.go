@@ -0,0 +1,249 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package imageconfig_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/imageconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	registryUsername = "user"
+	registryPassword = "secret"
+)
+
+// pushImage - pushes a random image with the given entrypoint and cmd to the registry, and returns its reference.
+func pushImage(t *testing.T, registryHost string, repository string, entrypoint, cmd []string,
+	opts ...remote.Option,
+) string {
+	t.Helper()
+
+	image, err := random.Image(1024, 1)
+	require.NoError(t, err)
+
+	image, err = mutate.Config(image, v1.Config{
+		Entrypoint: entrypoint,
+		Cmd:        cmd,
+	})
+	require.NoError(t, err)
+
+	ref, err := name.ParseReference(registryHost + "/" + repository)
+	require.NoError(t, err)
+
+	require.NoError(t, remote.Write(ref, image, opts...))
+
+	return ref.String()
+}
+
+func newRegistry(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// newRegistryWithBasicAuth - a registry requiring basic auth, like a private registry.
+func newRegistryWithBasicAuth(t *testing.T) string {
+	t.Helper()
+
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != registryUsername || password != registryPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func Test_RegistryResolver(t *testing.T) {
+	t.Parallel()
+
+	registryHost := newRegistry(t)
+	image := pushImage(t, registryHost, "tools/migrate:v1", []string{"/usr/bin/migrate"}, []string{"up"})
+
+	resolver := imageconfig.NewRegistryResolver(imageconfig.WithKeychain(authn.NewMultiKeychain()))
+
+	imageCommand, err := resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: image,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.ImageCommand{
+		Entrypoint: []string{"/usr/bin/migrate"},
+		Cmd:        []string{"up"},
+	}, imageCommand)
+
+	_, err = resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: registryHost + "/does/not:exist",
+	})
+	require.ErrorIs(t, err, imageconfig.ErrCannotFetchImageConfig)
+}
+
+func Test_RegistryResolver_imagePullSecrets(t *testing.T) {
+	t.Parallel()
+
+	registryHost := newRegistryWithBasicAuth(t)
+	basicAuth := authn.FromConfig(authn.AuthConfig{Username: registryUsername, Password: registryPassword})
+	image := pushImage(t, registryHost, "private/image:latest", nil, []string{"/bin/sh", "-c", "date"},
+		remote.WithAuth(basicAuth))
+
+	dockerConfigJSON, err := json.Marshal(map[string]any{
+		"auths": map[string]any{
+			registryHost: map[string]string{
+				"auth": base64.StdEncoding.EncodeToString([]byte(registryUsername + ":" + registryPassword)),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	secretGetter := func(_ context.Context, namespace, name string) (*corev1.Secret, error) {
+		assert.Equal(t, "my-namespace", namespace)
+		assert.Equal(t, "my-pull-secret", name)
+
+		return &corev1.Secret{
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: dockerConfigJSON,
+			},
+		}, nil
+	}
+
+	request := kueueleuleu.ImageCommandRequest{
+		Image:            image,
+		Namespace:        "my-namespace",
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "my-pull-secret"}},
+	}
+
+	// without the secret, pulling is unauthorized
+	resolver := imageconfig.NewRegistryResolver(imageconfig.WithKeychain(authn.NewMultiKeychain()))
+	_, err = resolver.ResolveImageCommand(context.Background(), request)
+	require.ErrorIs(t, err, imageconfig.ErrCannotFetchImageConfig)
+
+	resolver = imageconfig.NewRegistryResolver(
+		imageconfig.WithKeychain(authn.NewMultiKeychain()),
+		imageconfig.WithSecretGetter(secretGetter),
+	)
+
+	imageCommand, err := resolver.ResolveImageCommand(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.ImageCommand{
+		Cmd: []string{"/bin/sh", "-c", "date"},
+	}, imageCommand)
+}
+
+func Test_RegistryResolver_cache(t *testing.T) {
+	t.Parallel()
+
+	registryHost := newRegistry(t)
+	image := pushImage(t, registryHost, "cached:latest", []string{"/first"}, nil)
+
+	cacheDir := t.TempDir()
+	resolver := imageconfig.NewRegistryResolver(
+		imageconfig.WithKeychain(authn.NewMultiKeychain()),
+		imageconfig.WithCacheDir(cacheDir),
+	)
+
+	imageCommand, err := resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: image,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/first"}, imageCommand.Entrypoint)
+
+	// the tag now points to another image, but the cached configuration is still used
+	pushImage(t, registryHost, "cached:latest", []string{"/second"}, nil)
+
+	imageCommand, err = resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: image,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/first"}, imageCommand.Entrypoint)
+
+	// unless the cache has expired
+	resolver = imageconfig.NewRegistryResolver(
+		imageconfig.WithKeychain(authn.NewMultiKeychain()),
+		imageconfig.WithCacheDir(cacheDir),
+		imageconfig.WithCacheTTL(0),
+	)
+
+	imageCommand, err = resolver.ResolveImageCommand(context.Background(), kueueleuleu.ImageCommandRequest{
+		Image: image,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/second"}, imageCommand.Entrypoint)
+}
+
+func Test_ConvertPod_withRegistryResolver(t *testing.T) {
+	t.Parallel()
+
+	registryHost := newRegistry(t)
+	image := pushImage(t, registryHost, "step:latest", []string{"/bin/step"}, []string{"--verbose"})
+
+	pod := corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "step1",
+					Image: image,
+				},
+				{
+					Name:  "step2",
+					Image: image,
+					Args:  []string{"--quiet"},
+				},
+			},
+		},
+	}
+
+	resolver := imageconfig.NewRegistryResolver(imageconfig.WithKeychain(authn.NewMultiKeychain()))
+
+	convertedPod, err := kueueleuleu.ConvertPod(pod, kueueleuleu.WithCommandResolver(resolver))
+	require.NoError(t, err)
+
+	revertedPod, err := kueueleuleu.RevertPod(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bin/step"}, revertedPod.Spec.Containers[0].Command)
+	assert.Equal(t, []string{"--verbose"}, revertedPod.Spec.Containers[0].Args)
+	assert.Equal(t, []string{"/bin/step"}, revertedPod.Spec.Containers[1].Command)
+	assert.Equal(t, []string{"--quiet"}, revertedPod.Spec.Containers[1].Args)
+}
@@ -0,0 +1,202 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package merge applies the changes made by a conversion (or a revert) to the typed form of a document, to the
+// document itself: fields unknown to the typed form, and fields left unchanged, are kept as is. It is shared by
+// the library (unstructured objects) and the CLI (YAML nodes, keeping comments and formatting).
+package merge
+
+import (
+	"reflect"
+	"sort"
+)
+
+// listItemKey - the field identifying the items of lists in pod specs (containers, volumes, volume mounts, ...).
+const listItemKey = "name"
+
+// Value - a value of a document, edited by Merge.
+type Value interface {
+	// Mapping - returns the value as a mapping (an empty one if the value is null), or false if it is not a mapping.
+	Mapping() (Mapping, bool)
+	// Sequence - returns the value as a sequence, or false if it is not a sequence.
+	Sequence() (Sequence, bool)
+	// Replace - replaces the value.
+	Replace(value interface{}) error
+}
+
+// Mapping - a mapping of a document.
+type Mapping interface {
+	// Field - returns the value of the field, added as null if it is not set.
+	Field(key string) Value
+	// Remove - removes the field.
+	Remove(key string)
+	// Len - returns the number of fields.
+	Len() int
+}
+
+// Sequence - a sequence of a document.
+type Sequence interface {
+	// Len - returns the number of items.
+	Len() int
+	// Item - returns the item at index.
+	Item(index int) Value
+	// NewItem - returns a new null item, added to the sequence by SetItems.
+	NewItem() Value
+	// SetItems - replaces the items of the sequence by items returned by Item and NewItem.
+	SetItems(items []Value)
+}
+
+// Merge - applies the changes between before and after (the typed forms of value, before and after a conversion
+// or a revert) to value. before is value as seen by the typed form, so value may have more fields, but never less.
+// Items of lists are matched by name (e.g. containers, volumes and volume mounts), other lists are replaced.
+func Merge(value Value, before, after interface{}) error {
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+
+	switch typedAfter := after.(type) {
+	case map[string]interface{}:
+		if typedBefore, isBeforeMap := before.(map[string]interface{}); isBeforeMap {
+			// a missing value is an empty struct of the typed form (e.g. metadata of pod templates)
+			if mapping, isMapping := value.Mapping(); isMapping {
+				return mergeMapping(mapping, typedBefore, typedAfter)
+			}
+		}
+	case []interface{}:
+		if typedBefore, isBeforeList := before.([]interface{}); isBeforeList && haveNames(typedAfter) {
+			if sequence, isSequence := value.Sequence(); isSequence && sequence.Len() == len(typedBefore) {
+				return mergeSequence(sequence, typedBefore, typedAfter)
+			}
+		}
+	}
+
+	return value.Replace(after)
+}
+
+func mergeMapping(mapping Mapping, before, after map[string]interface{}) error {
+	keys := make([]string, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+
+	// added fields are added in a stable order
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		afterField := after[key]
+
+		beforeField, inBefore := before[key]
+		if inBefore && reflect.DeepEqual(beforeField, afterField) {
+			continue
+		}
+
+		field := mapping.Field(key)
+
+		err := Merge(field, beforeField, afterField)
+		if err != nil {
+			return err
+		}
+
+		// e.g. the metadata of a pod template without annotations once reverted
+		if isEmptyStruct(afterField) {
+			if fieldMapping, isMapping := field.Mapping(); isMapping && fieldMapping.Len() == 0 {
+				mapping.Remove(key)
+			}
+		}
+	}
+
+	for key := range before {
+		if _, inAfter := after[key]; !inAfter {
+			mapping.Remove(key)
+		}
+	}
+
+	return nil
+}
+
+// mergeSequence - merges items in the order of after: removed items are dropped, and added items inserted.
+func mergeSequence(sequence Sequence, before, after []interface{}) error {
+	used := make([]bool, len(before))
+	items := make([]Value, 0, len(after))
+
+	for _, afterItem := range after {
+		name, _ := itemName(afterItem)
+
+		var (
+			item       = sequence.NewItem()
+			beforeItem interface{}
+		)
+
+		for index := range before {
+			if beforeName, _ := itemName(before[index]); !used[index] && beforeName == name {
+				used[index] = true
+				item, beforeItem = sequence.Item(index), before[index]
+
+				break
+			}
+		}
+
+		err := Merge(item, beforeItem, afterItem)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, item)
+	}
+
+	sequence.SetItems(items)
+
+	return nil
+}
+
+// haveNames - returns whether all items have a name. Lists without names (e.g. commands and args) are replaced.
+func haveNames(items []interface{}) bool {
+	for _, item := range items {
+		if _, hasName := itemName(item); !hasName {
+			return false
+		}
+	}
+
+	return true
+}
+
+func itemName(item interface{}) (string, bool) {
+	typedItem, isMap := item.(map[string]interface{})
+	if !isMap {
+		return "", false
+	}
+
+	name, isString := typedItem[listItemKey].(string)
+
+	return name, isString
+}
+
+// isEmptyStruct - returns whether value is a struct of the typed form without any field set (fields like
+// creationTimestamp are always set, but null).
+func isEmptyStruct(value interface{}) bool {
+	fields, isMap := value.(map[string]interface{})
+	if !isMap {
+		return false
+	}
+
+	for _, field := range fields {
+		if field != nil {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,167 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package merge_test
+
+import (
+	"testing"
+
+	"github.com/norbjd/kueueleuleu/internal/merge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// value - a value of a document decoded from JSON, read and written by get and set.
+type value struct {
+	get func() interface{}
+	set func(value interface{})
+}
+
+func (v value) Mapping() (merge.Mapping, bool) {
+	if v.get() == nil {
+		v.set(map[string]interface{}{})
+	}
+
+	fields, isMap := v.get().(map[string]interface{})
+
+	return mapping(fields), isMap
+}
+
+func (v value) Sequence() (merge.Sequence, bool) {
+	items, isList := v.get().([]interface{})
+
+	return sequence{items: items, set: v.set}, isList
+}
+
+func (v value) Replace(replacement interface{}) error {
+	v.set(replacement)
+
+	return nil
+}
+
+type mapping map[string]interface{}
+
+func (m mapping) Field(key string) merge.Value {
+	return value{get: func() interface{} { return m[key] }, set: func(field interface{}) { m[key] = field }}
+}
+
+func (m mapping) Remove(key string) {
+	delete(m, key)
+}
+
+func (m mapping) Len() int {
+	return len(m)
+}
+
+type sequence struct {
+	items []interface{}
+	set   func(value interface{})
+}
+
+func (s sequence) Len() int {
+	return len(s.items)
+}
+
+func (s sequence) Item(index int) merge.Value {
+	return value{get: func() interface{} { return s.items[index] }, set: func(item interface{}) { s.items[index] = item }}
+}
+
+func (s sequence) NewItem() merge.Value {
+	var item interface{}
+
+	return value{get: func() interface{} { return item }, set: func(newItem interface{}) { item = newItem }}
+}
+
+func (s sequence) SetItems(items []merge.Value) {
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		values = append(values, item.(value).get()) //nolint:forcetypeassert
+	}
+
+	s.set(values)
+}
+
+func mergeDocument(t *testing.T, document, before, after map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	root := value{
+		get: func() interface{} { return document },
+		set: func(merged interface{}) { document, _ = merged.(map[string]interface{}) },
+	}
+	require.NoError(t, merge.Merge(root, before, after))
+
+	return document
+}
+
+func Test_Merge(t *testing.T) {
+	t.Parallel()
+
+	document := map[string]interface{}{
+		"unknown": "kept",
+		"containers": []interface{}{
+			map[string]interface{}{"name": "first", "image": "alpine", "restartPolicy": "Always"},
+			map[string]interface{}{"name": "second", "image": "alpine", "command": []interface{}{"sh"}},
+		},
+	}
+	before := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{"name": "first", "image": "alpine"},
+			map[string]interface{}{"name": "second", "image": "alpine", "command": []interface{}{"sh"}},
+		},
+	}
+	after := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{"name": "second", "image": "alpine", "command": []interface{}{"entrypoint", "sh"}},
+			map[string]interface{}{"name": "first", "image": "busybox"},
+			map[string]interface{}{"name": "added", "image": "alpine"},
+		},
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{"key": "value"}},
+	}
+
+	// items are matched by name, reordered like after, and keep their unknown fields; unnamed lists are replaced
+	assert.Equal(t, map[string]interface{}{
+		"unknown": "kept",
+		"containers": []interface{}{
+			map[string]interface{}{"name": "second", "image": "alpine", "command": []interface{}{"entrypoint", "sh"}},
+			map[string]interface{}{"name": "first", "image": "busybox", "restartPolicy": "Always"},
+			map[string]interface{}{"name": "added", "image": "alpine"},
+		},
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{"key": "value"}},
+	}, mergeDocument(t, document, before, after))
+}
+
+func Test_Merge_emptyStruct(t *testing.T) {
+	t.Parallel()
+
+	document := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{"key": "value"}},
+		"spec":     map[string]interface{}{},
+	}
+	before := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations":       map[string]interface{}{"key": "value"},
+			"creationTimestamp": nil,
+		},
+		"spec": map[string]interface{}{},
+	}
+	after := map[string]interface{}{
+		"metadata": map[string]interface{}{"creationTimestamp": nil},
+		"spec":     map[string]interface{}{},
+	}
+
+	// the metadata is removed, like when it was not set before the conversion
+	assert.Equal(t, map[string]interface{}{"spec": map[string]interface{}{}}, mergeDocument(t, document, before, after))
+}
@@ -27,14 +27,26 @@ import (
 
 const (
 	prepareInitContainerName = "kueueleuleu-prepare"
-	tektonEntrypointImage    = "gcr.io/tekton-releases/github.com/tektoncd/pipeline/cmd/entrypoint" +
-		"@sha256:40abc3a78b558f251e890085972ed25fe7ad428f47998bc9c9c18f564dc03c32"
+	tektonEntrypointBinary   = "/tekton/bin/entrypoint"
+	tektonBinVolumeName      = "tekton-internal-bin"
+	tektonStepsVolumeName    = "tekton-internal-steps"
+	tektonRunVolumeName      = "tekton-internal-run-%d"
+	tektonTerminationPath    = "/tekton/termination"
+
+	// the nonroot user of the distroless image the tekton entrypoint image is built on.
+	prepareDefaultUserID = 65532
 
 	kueueleuleuAnnotationKey   = "norbjd.github.io/kueueleuleu"
 	kueueleuleuAnnotationValue = "true"
+
+	prepareRequestsAnnotationKey = "norbjd.github.io/kueueleuleu-prepare-requests"
+	prepareLimitsAnnotationKey   = "norbjd.github.io/kueueleuleu-prepare-limits"
 )
 
-var ErrContainerDoesNotHaveACommand = errors.New("container does not have a command, but we expect one")
+var (
+	ErrContainerDoesNotHaveACommand = errors.New("container does not have a command, but we expect one")
+	ErrAlreadyConverted             = errors.New("already converted")
+)
 
 func convertObjectMeta(objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
 	if objectMeta.Annotations == nil {
@@ -60,26 +72,159 @@ func checkPodSpecIsValid(podSpec corev1.PodSpec) error {
 	return err
 }
 
+// isPodSpecConverted - checks if the pod spec carries anything added by convertPodSpec.
+func isPodSpecConverted(podSpec corev1.PodSpec) bool {
+	for _, initContainer := range podSpec.InitContainers {
+		if initContainer.Name == prepareInitContainerName {
+			return true
+		}
+	}
+
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == tektonBinVolumeName || volume.Name == tektonStepsVolumeName {
+			return true
+		}
+	}
+
+	for _, container := range podSpec.Containers {
+		if len(container.Command) == 1 && container.Command[0] == tektonEntrypointBinary {
+			return true
+		}
+	}
+
+	return false
+}
+
+// internalVolumeNames - returns the names of the volumes added by convertPodSpec to a pod spec with containerCount
+// containers, which are also the names of the volume mounts added to its containers. Other volumes are the user's,
+// even if their name starts with tekton-internal-.
+func internalVolumeNames(containerCount int) map[string]bool {
+	names := map[string]bool{
+		tektonBinVolumeName:   true,
+		tektonStepsVolumeName: true,
+	}
+
+	for i := 0; i < containerCount; i++ {
+		names[fmt.Sprintf(tektonRunVolumeName, i)] = true
+	}
+
+	return names
+}
+
+// mergeAnnotations - merges annotations of the object metas, from the outermost (e.g. job)
+// to the innermost (e.g. pod template): the innermost wins.
+func mergeAnnotations(objectMetas []metav1.ObjectMeta) map[string]string {
+	annotations := make(map[string]string)
+
+	for _, objectMeta := range objectMetas {
+		for key, value := range objectMeta.Annotations {
+			annotations[key] = value
+		}
+	}
+
+	return annotations
+}
+
+// convertPodSpecOnce - converts the pod spec, unless it is already converted (either because one of the object
+// metas is annotated, or because the pod spec itself is already converted): in that case,
+// the behavior depends on the AlreadyConvertedPolicy. objectMetas are the original object metas, from the
+// outermost to the innermost, and podObjectMeta is the converted pod (or pod template) one.
+func convertPodSpecOnce(podSpec corev1.PodSpec, podObjectMeta *metav1.ObjectMeta, objectMetas []metav1.ObjectMeta,
+	opts options,
+) (corev1.PodSpec, error) {
+	annotated := false
+
+	for _, objectMeta := range objectMetas {
+		annotated = annotated || IsKueueleuleu(objectMeta)
+	}
+
+	podSpecConverted := isPodSpecConverted(podSpec)
+	annotations := mergeAnnotations(objectMetas)
+
+	if !annotated && !podSpecConverted {
+		return convertPodSpecAndRecordSettings(podSpec, podObjectMeta, objectMetas, annotations, opts)
+	}
+
+	switch opts.alreadyConvertedPolicy {
+	case AlreadyConvertedFail:
+		return corev1.PodSpec{}, ErrAlreadyConverted
+	case AlreadyConvertedReconvert:
+		if podSpecConverted {
+			originalPodSpec, err := revertPodSpec(podSpec)
+			if err != nil {
+				return corev1.PodSpec{}, fmt.Errorf("can't recover original pod spec: %w", err)
+			}
+
+			podSpec = originalPodSpec
+		}
+
+		return convertPodSpecAndRecordSettings(podSpec, podObjectMeta, objectMetas, annotations, opts)
+	case AlreadyConvertedSkip:
+	}
+
+	return podSpec, nil
+}
+
+// convertPodSpecAndRecordSettings - resolves missing commands, converts the pod spec, and records the step settings
+// needed by the status helpers in the pod object meta.
+func convertPodSpecAndRecordSettings(podSpec corev1.PodSpec, podObjectMeta *metav1.ObjectMeta,
+	objectMetas []metav1.ObjectMeta, annotations map[string]string, opts options,
+) (corev1.PodSpec, error) {
+	namespace := ""
+	if len(objectMetas) > 0 {
+		namespace = objectMetas[0].Namespace
+	}
+
+	err := resolveCommands(opts.ctx, podSpec, namespace, opts.commandResolver)
+	if err != nil {
+		return corev1.PodSpec{}, fmt.Errorf("pod spec is invalid: %w", err)
+	}
+
+	settings, err := getStepSettings(podSpec, annotations, opts)
+	if err != nil {
+		return corev1.PodSpec{}, err
+	}
+
+	kueueleuleuPodSpec, err := convertPodSpec(podSpec, annotations, settings, opts)
+	if err != nil {
+		return corev1.PodSpec{}, err
+	}
+
+	recordStepSettings(podObjectMeta, settings)
+
+	return kueueleuleuPodSpec, nil
+}
+
 //nolint:funlen
-func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
+func convertPodSpec(podSpec corev1.PodSpec, annotations map[string]string, settings map[string]stepSettings,
+	opts options,
+) (corev1.PodSpec, error) {
 	errInvalidPodSpec := checkPodSpecIsValid(podSpec)
 	if errInvalidPodSpec != nil {
 		return corev1.PodSpec{}, fmt.Errorf("pod spec is invalid: %w", errInvalidPodSpec)
 	}
 
+	prepareResources, err := prepareContainerResources(annotations, opts)
+	if err != nil {
+		return corev1.PodSpec{}, err
+	}
+
 	kueueleuleuPodSpec := podSpec
 
 	initContainer := corev1.Container{
-		Name:    prepareInitContainerName,
-		Image:   tektonEntrypointImage,
-		Command: strings.Split("/ko-app/entrypoint init /ko-app/entrypoint /tekton/bin/entrypoint", " "),
+		Name:            prepareInitContainerName,
+		Image:           opts.entrypointImage,
+		ImagePullPolicy: opts.entrypointImagePullPolicy,
+		Command:         strings.Split("/ko-app/entrypoint init /ko-app/entrypoint /tekton/bin/entrypoint", " "),
+		Resources:       prepareResources,
+		SecurityContext: prepareContainerSecurityContext(podSpec),
 		VolumeMounts: []corev1.VolumeMount{
 			{
-				Name:      "tekton-internal-bin",
+				Name:      tektonBinVolumeName,
 				MountPath: "/tekton/bin",
 			},
 			{
-				Name:      "tekton-internal-steps",
+				Name:      tektonStepsVolumeName,
 				MountPath: "/tekton/steps",
 			},
 		},
@@ -87,19 +232,20 @@ func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
 
 	// prepend our own init container
 	kueueleuleuPodSpec.InitContainers = append([]corev1.Container{initContainer}, podSpec.InitContainers...)
+	kueueleuleuPodSpec.ImagePullSecrets = addImagePullSecrets(podSpec.ImagePullSecrets, opts.imagePullSecrets)
 
 	newVolumes := kueueleuleuPodSpec.Volumes
 	newVolumes = append(newVolumes,
 		[]corev1.Volume{
 			{
 				// this is only used in the init container because /tekton/steps must exist, and is not useful otherwise
-				Name: "tekton-internal-steps",
+				Name: tektonStepsVolumeName,
 				VolumeSource: corev1.VolumeSource{
 					EmptyDir: &corev1.EmptyDirVolumeSource{},
 				},
 			},
 			{
-				Name: "tekton-internal-bin",
+				Name: tektonBinVolumeName,
 				VolumeSource: corev1.VolumeSource{
 					EmptyDir: &corev1.EmptyDirVolumeSource{},
 				},
@@ -109,7 +255,7 @@ func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
 
 	for i := range podSpec.Containers {
 		volume := corev1.Volume{
-			Name:         fmt.Sprintf("tekton-internal-run-%d", i),
+			Name:         fmt.Sprintf(tektonRunVolumeName, i),
 			VolumeSource: corev1.VolumeSource{},
 		}
 
@@ -122,7 +268,7 @@ func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
 		newVolumeMounts := container.VolumeMounts
 		newVolumeMounts = append(newVolumeMounts, []corev1.VolumeMount{
 			{
-				Name:      "tekton-internal-bin",
+				Name:      tektonBinVolumeName,
 				MountPath: "/tekton/bin",
 				ReadOnly:  true,
 			},
@@ -130,7 +276,7 @@ func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
 
 		for otherContainerIndex := range podSpec.Containers {
 			volumeMount := corev1.VolumeMount{
-				Name:      fmt.Sprintf("tekton-internal-run-%d", otherContainerIndex),
+				Name:      fmt.Sprintf(tektonRunVolumeName, otherContainerIndex),
 				MountPath: fmt.Sprintf("/tekton/run/%d", otherContainerIndex),
 			}
 			if index != otherContainerIndex {
@@ -151,6 +297,16 @@ func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
 			}
 		}
 
+		// the entrypoint always writes a termination message: let kubelet mount a writable file for it,
+		// otherwise this fails with non-root users or read-only root filesystems
+		if container.TerminationMessagePath == "" {
+			container.TerminationMessagePath = tektonTerminationPath
+		} else if container.TerminationMessagePath != tektonTerminationPath {
+			newArgs = append(newArgs, "-termination_path", container.TerminationMessagePath)
+		}
+
+		newArgs = append(newArgs, settings[container.Name].entrypointArgs()...)
+
 		newArgs = append(newArgs, []string{
 			"-post_file",
 			fmt.Sprintf("/tekton/run/%d/out", index),
@@ -159,20 +315,91 @@ func convertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
 			"-entrypoint",
 		}...)
 
-		newArgs = append(newArgs, container.Command[0])
-		newArgs = append(newArgs, "--")
-
-		if len(container.Command) > 1 {
-			newArgs = append(newArgs, container.Command[1:]...)
-		}
+		commandLine := append(append([]string{}, container.Command...), container.Args...)
+		commandLine = settings[container.Name].wrapCommand(commandLine, container.TerminationMessagePath)
 
-		newArgs = append(newArgs, container.Args...)
+		newArgs = append(newArgs, commandLine[0], "--")
+		newArgs = append(newArgs, commandLine[1:]...)
 
 		container.Args = newArgs
-		container.Command = []string{"/tekton/bin/entrypoint"}
+		container.Command = []string{tektonEntrypointBinary}
 
 		kueueleuleuPodSpec.Containers[index] = container
 	}
 
 	return kueueleuleuPodSpec, nil
 }
+
+func addImagePullSecrets(imagePullSecrets []corev1.LocalObjectReference,
+	secretNames []string,
+) []corev1.LocalObjectReference {
+	existingSecretNames := make(map[string]bool)
+
+	for _, imagePullSecret := range imagePullSecrets {
+		existingSecretNames[imagePullSecret.Name] = true
+	}
+
+	for _, secretName := range secretNames {
+		if existingSecretNames[secretName] {
+			continue
+		}
+
+		existingSecretNames[secretName] = true
+		imagePullSecrets = append(imagePullSecrets, corev1.LocalObjectReference{Name: secretName})
+	}
+
+	return imagePullSecrets
+}
+
+// prepareContainerSecurityContext - builds a security context for the prepare init container compliant
+// with the "restricted" pod security standard. The user and group are the pod ones if set.
+func prepareContainerSecurityContext(podSpec corev1.PodSpec) *corev1.SecurityContext {
+	if podSpec.OS != nil && podSpec.OS.Name == corev1.Windows {
+		return nil
+	}
+
+	runAsUser := int64(prepareDefaultUserID)
+	runAsGroup := int64(prepareDefaultUserID)
+
+	var seccompProfile *corev1.SeccompProfile
+
+	podSecurityContext := podSpec.SecurityContext
+	if podSecurityContext != nil {
+		if podSecurityContext.RunAsUser != nil {
+			runAsUser = *podSecurityContext.RunAsUser
+		}
+
+		if podSecurityContext.RunAsGroup != nil {
+			runAsGroup = *podSecurityContext.RunAsGroup
+		}
+	}
+
+	// inherit the pod seccomp profile if any
+	if podSecurityContext == nil || podSecurityContext.SeccompProfile == nil {
+		seccompProfile = &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		}
+	}
+
+	var runAsNonRoot *bool
+
+	if runAsUser != 0 {
+		runAsNonRoot = toPtr(true)
+	}
+
+	return &corev1.SecurityContext{
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		RunAsUser:                &runAsUser,
+		RunAsGroup:               &runAsGroup,
+		RunAsNonRoot:             runAsNonRoot,
+		ReadOnlyRootFilesystem:   toPtr(true),
+		AllowPrivilegeEscalation: toPtr(false),
+		SeccompProfile:           seccompProfile,
+	}
+}
+
+func toPtr[T any](x T) *T {
+	return &x
+}
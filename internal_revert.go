@@ -0,0 +1,133 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrContainerIsNotConverted = errors.New("container was not converted by kueueleuleu")
+
+func revertObjectMeta(objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
+	delete(objectMeta.Annotations, kueueleuleuAnnotationKey)
+
+	if len(objectMeta.Annotations) == 0 {
+		objectMeta.Annotations = nil
+	}
+
+	return objectMeta
+}
+
+func revertPodSpec(podSpec corev1.PodSpec) (corev1.PodSpec, error) {
+	originalPodSpec := podSpec
+
+	originalPodSpec.InitContainers = nil
+
+	for _, initContainer := range podSpec.InitContainers {
+		if initContainer.Name != prepareInitContainerName {
+			originalPodSpec.InitContainers = append(originalPodSpec.InitContainers, initContainer)
+		}
+	}
+
+	internalVolumes := internalVolumeNames(len(podSpec.Containers))
+
+	originalPodSpec.Volumes = nil
+
+	for _, volume := range podSpec.Volumes {
+		if !internalVolumes[volume.Name] {
+			originalPodSpec.Volumes = append(originalPodSpec.Volumes, volume)
+		}
+	}
+
+	originalPodSpec.Containers = make([]corev1.Container, 0, len(podSpec.Containers))
+
+	var err error
+
+	for _, container := range podSpec.Containers {
+		originalContainer, errRevert := revertContainer(container, internalVolumes)
+		if errRevert != nil {
+			err = errors.Join(err, fmt.Errorf("%w (container %s)", errRevert, container.Name))
+		}
+
+		originalPodSpec.Containers = append(originalPodSpec.Containers, originalContainer)
+	}
+
+	if err != nil {
+		return corev1.PodSpec{}, fmt.Errorf("pod spec can't be reverted: %w", err)
+	}
+
+	return originalPodSpec, nil
+}
+
+func revertContainer(container corev1.Container, internalVolumes map[string]bool) (corev1.Container, error) {
+	originalContainer := container
+
+	originalContainer.VolumeMounts = nil
+
+	for _, volumeMount := range container.VolumeMounts {
+		if !internalVolumes[volumeMount.Name] {
+			originalContainer.VolumeMounts = append(originalContainer.VolumeMounts, volumeMount)
+		}
+	}
+
+	command, args, err := parseEntrypointArgs(container.Command, container.Args)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+
+	originalContainer.Command = command
+	originalContainer.Args = args
+
+	if originalContainer.TerminationMessagePath == tektonTerminationPath {
+		originalContainer.TerminationMessagePath = ""
+	}
+
+	return originalContainer, nil
+}
+
+// parseEntrypointArgs - retrieves the original command and args from the tekton entrypoint command and args
+// built by convertPodSpec, i.e. [/tekton/bin/entrypoint] [<entrypoint flags>... -entrypoint <command> -- <args>...].
+func parseEntrypointArgs(command, args []string) ([]string, []string, error) {
+	if len(command) != 1 || command[0] != tektonEntrypointBinary {
+		return nil, nil, ErrContainerIsNotConverted
+	}
+
+	for i, arg := range args {
+		if arg != "-entrypoint" {
+			continue
+		}
+
+		if len(args) < i+3 || args[i+2] != "--" {
+			break
+		}
+
+		commandLine := unwrapCommand(append([]string{args[i+1]}, args[i+3:]...))
+
+		var originalArgs []string
+		if len(commandLine) > 1 {
+			originalArgs = commandLine[1:]
+		}
+
+		return commandLine[:1], originalArgs, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: can't find the -entrypoint <command> -- layout in args", ErrContainerIsNotConverted)
+}
@@ -0,0 +1,304 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const logsPollInterval = time.Second
+
+// LogsOption - customizes StreamLogs.
+type LogsOption func(*logsOptions)
+
+type logsOptions struct {
+	follow         bool
+	includePrepare bool
+	newStepWriter  func(containerName string) (io.WriteCloser, error)
+}
+
+// WithFollow - follows the logs: the running step is followed until it finishes, then the next step when it starts,
+// until the pod finishes. Without it, only the logs written so far are retrieved.
+func WithFollow() LogsOption {
+	return func(o *logsOptions) {
+		o.follow = true
+	}
+}
+
+// WithPrepareContainerLogs - also retrieves the logs of the internal init container copying the tekton entrypoint,
+// skipped by default.
+func WithPrepareContainerLogs() LogsOption {
+	return func(o *logsOptions) {
+		o.includePrepare = true
+	}
+}
+
+// WithStepLogsWriter - writes the logs of each container to its own writer, returned by newStepWriter, instead
+// of the writer given to StreamLogs. Lines are not prefixed, and writers are closed once the container logs
+// are retrieved.
+func WithStepLogsWriter(newStepWriter func(containerName string) (io.WriteCloser, error)) LogsOption {
+	return func(o *logsOptions) {
+		o.newStepWriter = newStepWriter
+	}
+}
+
+// containerLogsState - whether the logs of a container can be retrieved.
+type containerLogsState int
+
+const (
+	// containerLogsNotAvailableYet - the container (or step) has not started yet.
+	containerLogsNotAvailableYet containerLogsState = iota
+	// containerLogsAvailable - the container (or step) has started.
+	containerLogsAvailable
+	// containerLogsNeverAvailable - the step was skipped, or the pod has finished before the container started.
+	containerLogsNeverAvailable
+)
+
+// StreamLogs - writes the logs of the kueueleuleu pod namespace/name to w, container after container in the order
+// they run: init containers (except the internal one copying the tekton entrypoint, see WithPrepareContainerLogs),
+// then steps. Each line is prefixed with the container name between brackets, e.g. "[step1] hello".
+// Skipped steps, and steps that have not started yet, are ignored (unless following, see WithFollow).
+func StreamLogs(ctx context.Context, client kubernetes.Interface, namespace, name string, w io.Writer,
+	opts ...LogsOption,
+) error {
+	options := logsOptions{}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	pods := client.CoreV1().Pods(namespace)
+
+	pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot get pod %s/%s: %w", namespace, name, err)
+	}
+
+	if !IsKueueleuleu(pod.ObjectMeta) {
+		return ErrNotAKueueleuleuPod
+	}
+
+	for _, containerName := range getLogsContainerNames(pod, options.includePrepare) {
+		var state containerLogsState
+
+		pod, state, err = waitForContainerLogs(ctx, pods, pod, containerName, options.follow)
+		if err != nil {
+			return err
+		}
+
+		switch state {
+		case containerLogsNotAvailableYet:
+			// not following: next containers have not started either
+			return nil
+		case containerLogsNeverAvailable:
+			continue
+		case containerLogsAvailable:
+		}
+
+		err = writeContainerLogs(ctx, pods, name, containerName, w, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getLogsContainerNames - returns the names of the containers of the pod, in the order they run.
+func getLogsContainerNames(pod *corev1.Pod, includePrepare bool) []string {
+	containerNames := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+
+	for _, initContainer := range pod.Spec.InitContainers {
+		if initContainer.Name != prepareInitContainerName || includePrepare {
+			containerNames = append(containerNames, initContainer.Name)
+		}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		containerNames = append(containerNames, container.Name)
+	}
+
+	return containerNames
+}
+
+// waitForContainerLogs - when following, waits until the logs of the container are available (or will never be),
+// and returns the last version of the pod.
+func waitForContainerLogs(ctx context.Context, pods typedcorev1.PodInterface, pod *corev1.Pod,
+	containerName string, follow bool,
+) (*corev1.Pod, containerLogsState, error) {
+	state, err := getContainerLogsState(pod, containerName)
+	if err != nil || !follow || state != containerLogsNotAvailableYet {
+		return pod, state, err
+	}
+
+	err = wait.PollUntilContextCancel(ctx, logsPollInterval, false, func(ctx context.Context) (bool, error) {
+		currentPod, errGet := pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if errGet != nil {
+			return false, fmt.Errorf("cannot get pod %s/%s: %w", pod.Namespace, pod.Name, errGet)
+		}
+
+		pod = currentPod
+
+		var errState error
+
+		state, errState = getContainerLogsState(pod, containerName)
+
+		return state != containerLogsNotAvailableYet, errState
+	})
+	if err != nil {
+		return nil, state, fmt.Errorf("cannot wait for container %s to start: %w", containerName, err)
+	}
+
+	return pod, state, nil
+}
+
+func getContainerLogsState(pod *corev1.Pod, containerName string) (containerLogsState, error) {
+	podIsFinished := pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+
+	for _, initContainerStatus := range pod.Status.InitContainerStatuses {
+		if initContainerStatus.Name != containerName {
+			continue
+		}
+
+		if initContainerStatus.State.Running != nil || initContainerStatus.State.Terminated != nil {
+			return containerLogsAvailable, nil
+		}
+
+		break
+	}
+
+	if isInitContainer(pod, containerName) {
+		if podIsFinished {
+			return containerLogsNeverAvailable, nil
+		}
+
+		return containerLogsNotAvailableYet, nil
+	}
+
+	stepStatuses, err := GetStepStatuses(*pod)
+	if err != nil {
+		return containerLogsNotAvailableYet, err
+	}
+
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.Name != containerName {
+			continue
+		}
+
+		switch {
+		case stepStatus.State == StepSkipped:
+			return containerLogsNeverAvailable, nil
+		case stepStatus.State != StepWaiting:
+			return containerLogsAvailable, nil
+		case podIsFinished:
+			return containerLogsNeverAvailable, nil
+		default:
+			return containerLogsNotAvailableYet, nil
+		}
+	}
+
+	return containerLogsNotAvailableYet, fmt.Errorf("%w: %s", ErrStepNotFound, containerName)
+}
+
+func isInitContainer(pod *corev1.Pod, containerName string) bool {
+	for _, initContainer := range pod.Spec.InitContainers {
+		if initContainer.Name == containerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeContainerLogs(ctx context.Context, pods typedcorev1.PodInterface, podName, containerName string,
+	w io.Writer, options logsOptions,
+) (err error) {
+	logs, err := pods.GetLogs(podName, &corev1.PodLogOptions{
+		Container: containerName,
+		Follow:    options.follow,
+	}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get logs of container %s: %w", containerName, err)
+	}
+
+	defer logs.Close()
+
+	if options.newStepWriter != nil {
+		var stepWriter io.WriteCloser
+
+		// err is not redeclared, so errors closing the step writer are returned
+		stepWriter, err = options.newStepWriter(containerName)
+		if err != nil {
+			return fmt.Errorf("cannot write logs of container %s: %w", containerName, err)
+		}
+
+		defer func() {
+			err = errors.Join(err, stepWriter.Close())
+		}()
+
+		_, err = io.Copy(stepWriter, logs)
+		if err != nil {
+			return fmt.Errorf("cannot write logs of container %s: %w", containerName, err)
+		}
+
+		return nil
+	}
+
+	err = copyPrefixedLines(w, logs, "["+containerName+"] ")
+	if err != nil {
+		return fmt.Errorf("cannot write logs of container %s: %w", containerName, err)
+	}
+
+	return nil
+}
+
+// copyPrefixedLines - copies lines of r to w, prefixed with prefix. A newline is added to the last line if needed.
+func copyPrefixedLines(w io.Writer, r io.Reader, prefix string) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+
+			if _, errWrite := io.WriteString(w, prefix+line); errWrite != nil {
+				return errWrite //nolint:wrapcheck
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// the fake clientset returns "fake logs" as the logs of any container.
+
+// getLogsRequests - returns the containers whose logs were requested, and whether they were followed.
+func getLogsRequests(client *fake.Clientset) []string {
+	containers := make([]string, 0)
+
+	for _, action := range client.Actions() {
+		if action.GetSubresource() != "log" {
+			continue
+		}
+
+		logOptions, _ := action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+
+		container := logOptions.Container
+		if logOptions.Follow {
+			container += " (follow)"
+		}
+
+		containers = append(containers, container)
+	}
+
+	return containers
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed   bool
+	closeErr error
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+
+	return b.closeErr
+}
+
+func Test_StreamLogs(t *testing.T) {
+	t.Parallel()
+
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	failedPod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "failed",
+			Namespace: "default",
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	failedPod.Status.Phase = corev1.PodFailed
+	failedPod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "kueueleuleu-prepare", State: terminatedState(0, "", at)},
+		{Name: "dummy-init-container", State: terminatedState(0, "", at)},
+	}
+	failedPod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container3", State: terminatedState(1, "", at)},
+		{Name: "container1", State: terminatedState(0, "", at)},
+		{Name: "aaa", State: terminatedState(1, "", at)},
+	}
+
+	tests := []struct {
+		name             string
+		pod              *corev1.Pod
+		opts             []kueueleuleu.LogsOption
+		expectedRequests []string
+		expectedLogs     string
+	}{
+		{
+			name:             "failed pod",
+			pod:              &failedPod,
+			expectedRequests: []string{"dummy-init-container", "container1", "aaa"},
+			expectedLogs: "[dummy-init-container] fake logs\n" +
+				"[container1] fake logs\n" +
+				"[aaa] fake logs\n",
+		},
+		{
+			name:             "with prepare container",
+			pod:              &failedPod,
+			opts:             []kueueleuleu.LogsOption{kueueleuleu.WithPrepareContainerLogs()},
+			expectedRequests: []string{"kueueleuleu-prepare", "dummy-init-container", "container1", "aaa"},
+			expectedLogs: "[kueueleuleu-prepare] fake logs\n" +
+				"[dummy-init-container] fake logs\n" +
+				"[container1] fake logs\n" +
+				"[aaa] fake logs\n",
+		},
+		{
+			name:             "running pod",
+			pod:              runningPod(t, "running", nil),
+			expectedRequests: []string{"dummy-init-container", "container1", "aaa"},
+			expectedLogs: "[dummy-init-container] fake logs\n" +
+				"[container1] fake logs\n" +
+				"[aaa] fake logs\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := fake.NewSimpleClientset(test.pod)
+
+			var logs bytes.Buffer
+
+			err := kueueleuleu.StreamLogs(context.Background(), client, "default", test.pod.Name, &logs, test.opts...)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectedRequests, getLogsRequests(client))
+			assert.Equal(t, test.expectedLogs, logs.String())
+		})
+	}
+}
+
+func Test_StreamLogs_stepLogsWriter(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(runningPod(t, "running", nil))
+
+	stepWriters := make(map[string]*closingBuffer)
+
+	var logs bytes.Buffer
+
+	err := kueueleuleu.StreamLogs(context.Background(), client, "default", "running", &logs,
+		kueueleuleu.WithStepLogsWriter(func(containerName string) (io.WriteCloser, error) {
+			stepWriters[containerName] = &closingBuffer{}
+
+			return stepWriters[containerName], nil
+		}))
+	require.NoError(t, err)
+
+	assert.Empty(t, logs.String())
+	assert.Len(t, stepWriters, 3)
+
+	for _, containerName := range []string{"dummy-init-container", "container1", "aaa"} {
+		require.Contains(t, stepWriters, containerName)
+		assert.Equal(t, "fake logs", stepWriters[containerName].String())
+		assert.True(t, stepWriters[containerName].closed)
+	}
+}
+
+func Test_StreamLogs_stepLogsWriterCloseError(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(runningPod(t, "running", nil))
+	errFlush := errors.New("cannot flush logs")
+
+	err := kueueleuleu.StreamLogs(context.Background(), client, "default", "running", &bytes.Buffer{},
+		kueueleuleu.WithStepLogsWriter(func(string) (io.WriteCloser, error) {
+			return &closingBuffer{closeErr: errFlush}, nil
+		}))
+	require.ErrorIs(t, err, errFlush)
+}
+
+func Test_StreamLogs_follow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	pod := runningPod(t, "running", nil)
+	client := fake.NewSimpleClientset(pod)
+
+	var logs bytes.Buffer
+
+	done := make(chan error)
+
+	go func() {
+		done <- kueueleuleu.StreamLogs(ctx, client, "default", "running", &logs, kueueleuleu.WithFollow())
+	}()
+
+	// the last step has not started yet: logs are streamed once it starts
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container1", State: terminatedState(0, "", at)},
+		{Name: "aaa", State: terminatedState(0, "", at)},
+		{Name: "container3", State: terminatedState(0, "", at)},
+	}
+
+	_, err := client.CoreV1().Pods("default").UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(watchTestTimeout):
+		require.FailNow(t, "timed out")
+	}
+
+	assert.Equal(t, "[dummy-init-container] fake logs\n"+
+		"[container1] fake logs\n"+
+		"[aaa] fake logs\n"+
+		"[container3] fake logs\n", logs.String())
+	assert.Equal(t, []string{
+		"dummy-init-container (follow)", "container1 (follow)", "aaa (follow)", "container3 (follow)",
+	}, getLogsRequests(client))
+}
+
+func Test_StreamLogs_notAKueueleuleuPod(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "not-kueueleuleu",
+			Namespace: "default",
+		},
+		Spec: podSpec,
+	})
+
+	err := kueueleuleu.StreamLogs(context.Background(), client, "default", "not-kueueleuleu", io.Discard)
+	require.ErrorIs(t, err, kueueleuleu.ErrNotAKueueleuleuPod)
+}
@@ -0,0 +1,178 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultEntrypointImage - the tekton entrypoint image used unless WithEntrypointImage is set.
+const DefaultEntrypointImage = "gcr.io/tekton-releases/github.com/tektoncd/pipeline/cmd/entrypoint" +
+	"@sha256:40abc3a78b558f251e890085972ed25fe7ad428f47998bc9c9c18f564dc03c32"
+
+// Option - customizes the conversion done by ConvertPod, ConvertJob and ConvertCronJob.
+type Option func(*options)
+
+type options struct {
+	alreadyConvertedPolicy    AlreadyConvertedPolicy
+	entrypointImage           string
+	entrypointImagePullPolicy corev1.PullPolicy
+	imagePullSecrets          []string
+	prepareRequests           corev1.ResourceList
+	prepareLimits             corev1.ResourceList
+	commandResolver           CommandResolver
+	ctx                       context.Context //nolint:containedctx
+	stepOnErrors              map[string]OnError
+	stepSuccessExitCodes      map[string][]int32
+	stepTimeouts              map[string]time.Duration
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		alreadyConvertedPolicy: AlreadyConvertedSkip,
+		entrypointImage:        DefaultEntrypointImage,
+		prepareRequests:        DefaultPrepareContainerResources().Requests,
+		prepareLimits:          DefaultPrepareContainerResources().Limits,
+		ctx:                    context.Background(),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// AlreadyConvertedPolicy - what to do when converting an object that has already been converted.
+type AlreadyConvertedPolicy int
+
+const (
+	// AlreadyConvertedSkip - return the object unchanged (default).
+	AlreadyConvertedSkip AlreadyConvertedPolicy = iota
+	// AlreadyConvertedReconvert - revert the object to recover its original spec, and convert it again.
+	AlreadyConvertedReconvert
+	// AlreadyConvertedFail - return an error wrapping ErrAlreadyConverted.
+	AlreadyConvertedFail
+)
+
+// WithAlreadyConvertedPolicy - sets the behavior when the object to convert is already converted.
+func WithAlreadyConvertedPolicy(policy AlreadyConvertedPolicy) Option {
+	return func(o *options) {
+		o.alreadyConvertedPolicy = policy
+	}
+}
+
+// WithEntrypointImage - sets the image of the tekton entrypoint, copied by the init container to run containers
+// sequentially. Use this to pull the entrypoint from a mirror of DefaultEntrypointImage.
+// An empty image means DefaultEntrypointImage.
+func WithEntrypointImage(image string) Option {
+	return func(o *options) {
+		if image == "" {
+			image = DefaultEntrypointImage
+		}
+
+		o.entrypointImage = image
+	}
+}
+
+// WithEntrypointImagePullPolicy - sets the pull policy of the tekton entrypoint image.
+// By default, no pull policy is set, so kubernetes defaults apply.
+func WithEntrypointImagePullPolicy(pullPolicy corev1.PullPolicy) Option {
+	return func(o *options) {
+		o.entrypointImagePullPolicy = pullPolicy
+	}
+}
+
+// WithImagePullSecrets - adds image pull secrets to the pod, e.g. to pull the tekton entrypoint image
+// from a private registry. Secrets already referenced by the pod are not added twice.
+// Note that these secrets are kept when reverting the object.
+func WithImagePullSecrets(secretNames ...string) Option {
+	return func(o *options) {
+		o.imagePullSecrets = append(o.imagePullSecrets, secretNames...)
+	}
+}
+
+// WithPrepareContainerRequests - replaces the default resource requests of the init container
+// copying the tekton entrypoint (see DefaultPrepareContainerResources). An empty list means no requests.
+// The norbjd.github.io/kueueleuleu-prepare-requests annotation of the object, if any, takes precedence.
+func WithPrepareContainerRequests(requests corev1.ResourceList) Option {
+	// copied now, and for each converted object, so that neither the caller nor converted objects share the list
+	requests = requests.DeepCopy()
+
+	return func(o *options) {
+		o.prepareRequests = requests.DeepCopy()
+	}
+}
+
+// WithPrepareContainerLimits - replaces the default resource limits of the init container
+// copying the tekton entrypoint (see DefaultPrepareContainerResources). An empty list means no limits.
+// The norbjd.github.io/kueueleuleu-prepare-limits annotation of the object, if any, takes precedence.
+func WithPrepareContainerLimits(limits corev1.ResourceList) Option {
+	// copied like in WithPrepareContainerRequests
+	limits = limits.DeepCopy()
+
+	return func(o *options) {
+		o.prepareLimits = limits.DeepCopy()
+	}
+}
+
+// WithStepOnError - sets what happens to the next steps when the container fails (default: OnErrorStopAndFail).
+// The norbjd.github.io/kueueleuleu-on-error annotation of the object, if any, takes precedence for the containers
+// it lists (e.g. "cleanup=continue").
+func WithStepOnError(containerName string, onError OnError) Option {
+	return func(o *options) {
+		if o.stepOnErrors == nil {
+			o.stepOnErrors = make(map[string]OnError)
+		}
+
+		o.stepOnErrors[containerName] = onError
+	}
+}
+
+// WithStepSuccessExitCodes - sets non-zero exit codes of the container to report as a success (StepSucceeded):
+// the next steps run. Other non-zero exit codes fail the step as usual. As the tekton entrypoint can't stop
+// depending on the exit code, the command is run by /bin/sh, which must be in the container image.
+// With OnErrorContinue, the next steps run anyway, and exit codes not listed are reported as StepFailedContinued.
+// The norbjd.github.io/kueueleuleu-success-exit-codes annotation of the object, if any, takes precedence
+// for the containers it lists (e.g. "grep=1,diff=1;2"). Success exit codes are recorded in this annotation
+// of the pod (or pod template), and are kept when reverting the object.
+func WithStepSuccessExitCodes(containerName string, exitCodes ...int32) Option {
+	return func(o *options) {
+		if o.stepSuccessExitCodes == nil {
+			o.stepSuccessExitCodes = make(map[string][]int32)
+		}
+
+		o.stepSuccessExitCodes[containerName] = exitCodes
+	}
+}
+
+// WithStepTimeout - sets the maximum duration of the container command. When it is exceeded, the command is killed,
+// the step is reported as StepTimedOut, and the next steps are skipped (even with OnErrorContinue).
+// The norbjd.github.io/kueueleuleu-timeout annotation of the object, if any, takes precedence for the containers
+// it lists (e.g. "build=10m,test=1h30m").
+func WithStepTimeout(containerName string, timeout time.Duration) Option {
+	return func(o *options) {
+		if o.stepTimeouts == nil {
+			o.stepTimeouts = make(map[string]time.Duration)
+		}
+
+		o.stepTimeouts[containerName] = timeout
+	}
+}
@@ -0,0 +1,132 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var ErrCannotResolveCommand = errors.New("cannot resolve container command")
+
+// ImageCommand - the ENTRYPOINT and CMD of an image configuration.
+type ImageCommand struct {
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+}
+
+// ImageCommandRequest - the image whose command must be resolved, and how to pull it.
+type ImageCommandRequest struct {
+	Image string
+	// Namespace - the namespace of the object being converted, might be empty.
+	Namespace        string
+	ImagePullSecrets []corev1.LocalObjectReference
+}
+
+// CommandResolver - resolves the command of containers that do not have one, from their image configuration.
+// See the imageconfig package for implementations.
+type CommandResolver interface {
+	ResolveImageCommand(ctx context.Context, request ImageCommandRequest) (ImageCommand, error)
+}
+
+// WithCommandResolver - resolves the command of containers that do not have one with the resolver,
+// instead of returning ErrContainerDoesNotHaveACommand. Like kubernetes does, the image ENTRYPOINT is used
+// as the command, and the image CMD as args if the container does not have args.
+// Note that reverting a converted object does not remove the resolved commands.
+func WithCommandResolver(resolver CommandResolver) Option {
+	return func(o *options) {
+		o.commandResolver = resolver
+	}
+}
+
+// WithContext - sets the context used while converting, e.g. to cancel resolving commands with the resolver
+// (see WithCommandResolver). By default, the conversion can't be cancelled.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// resolveCommands - sets the command of containers without one, using the resolver. The pod spec is modified in place.
+func resolveCommands(ctx context.Context, podSpec corev1.PodSpec, namespace string,
+	resolver CommandResolver,
+) error {
+	if resolver == nil {
+		return nil
+	}
+
+	var err error
+
+	for i, container := range podSpec.Containers {
+		if len(container.Command) > 0 {
+			continue
+		}
+
+		command, args, errResolve := resolveCommand(ctx, container, ImageCommandRequest{
+			Image:            container.Image,
+			Namespace:        namespace,
+			ImagePullSecrets: podSpec.ImagePullSecrets,
+		}, resolver)
+		if errResolve != nil {
+			err = errors.Join(err, fmt.Errorf("%w (container %s): %w", ErrCannotResolveCommand, container.Name, errResolve))
+
+			continue
+		}
+
+		podSpec.Containers[i].Command = command
+		podSpec.Containers[i].Args = args
+	}
+
+	return err
+}
+
+func resolveCommand(ctx context.Context, container corev1.Container, request ImageCommandRequest,
+	resolver CommandResolver,
+) ([]string, []string, error) {
+	imageCommand, err := resolver.ResolveImageCommand(ctx, request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("image %s: %w", request.Image, err)
+	}
+
+	command := append([]string{}, imageCommand.Entrypoint...)
+
+	args := container.Args
+	if len(args) == 0 {
+		args = imageCommand.Cmd
+	}
+
+	args = append([]string{}, args...)
+
+	// without ENTRYPOINT, the first item of args (or CMD) is the executable
+	if len(command) == 0 {
+		if len(args) == 0 {
+			return nil, nil, fmt.Errorf("image %s has neither ENTRYPOINT nor CMD: %w",
+				request.Image, ErrContainerDoesNotHaveACommand)
+		}
+
+		command, args = args[:1], args[1:]
+	}
+
+	if len(args) == 0 {
+		args = nil
+	}
+
+	return command, args, nil
+}
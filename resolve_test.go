@@ -0,0 +1,166 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeResolver map[string]kueueleuleu.ImageCommand
+
+func (f fakeResolver) ResolveImageCommand(_ context.Context,
+	request kueueleuleu.ImageCommandRequest,
+) (kueueleuleu.ImageCommand, error) {
+	imageCommand, found := f[request.Image]
+	if !found {
+		return kueueleuleu.ImageCommand{}, assert.AnError
+	}
+
+	return imageCommand, nil
+}
+
+func Test_ConvertPod_withCommandResolver(t *testing.T) {
+	t.Parallel()
+
+	resolver := fakeResolver{
+		"entrypoint-and-cmd": {Entrypoint: []string{"/bin/app", "-v"}, Cmd: []string{"serve"}},
+		"cmd-only":           {Cmd: []string{"/bin/sh", "-c", "date"}},
+		"nothing":            {},
+	}
+
+	tests := []struct {
+		container       corev1.Container
+		expectedCommand []string
+		expectedArgs    []string
+		expectedError   error
+	}{
+		{
+			container:       corev1.Container{Image: "entrypoint-and-cmd"},
+			expectedCommand: []string{"/bin/app", "-v"},
+			expectedArgs:    []string{"serve"},
+		},
+		{
+			container:       corev1.Container{Image: "entrypoint-and-cmd", Args: []string{"migrate"}},
+			expectedCommand: []string{"/bin/app", "-v"},
+			expectedArgs:    []string{"migrate"},
+		},
+		{
+			container:       corev1.Container{Image: "cmd-only"},
+			expectedCommand: []string{"/bin/sh"},
+			expectedArgs:    []string{"-c", "date"},
+		},
+		{
+			container:       corev1.Container{Image: "cmd-only", Args: []string{"/bin/true"}},
+			expectedCommand: []string{"/bin/true"},
+		},
+		{
+			container:       corev1.Container{Image: "unknown", Command: []string{"echo"}},
+			expectedCommand: []string{"echo"},
+		},
+		{
+			container:     corev1.Container{Image: "nothing"},
+			expectedError: kueueleuleu.ErrContainerDoesNotHaveACommand,
+		},
+		{
+			container:     corev1.Container{Image: "unknown"},
+			expectedError: kueueleuleu.ErrCannotResolveCommand,
+		},
+	}
+
+	for _, testCase := range tests {
+		testCase := testCase
+
+		t.Run(testCase.container.Image, func(t *testing.T) {
+			t.Parallel()
+
+			container := testCase.container
+			container.Name = "step"
+
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{container},
+				},
+			}
+
+			convertedPod, err := kueueleuleu.ConvertPod(pod, kueueleuleu.WithCommandResolver(resolver))
+			if testCase.expectedError != nil {
+				require.ErrorIs(t, err, testCase.expectedError)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.container.Command, pod.Spec.Containers[0].Command, "input must not be modified")
+
+			revertedPod, err := kueueleuleu.RevertPod(convertedPod)
+			require.NoError(t, err)
+
+			// reverting does not keep the boundary between command and args
+			revertedContainer := revertedPod.Spec.Containers[0]
+			assert.Equal(t, append(append([]string{}, testCase.expectedCommand...), testCase.expectedArgs...),
+				append(revertedContainer.Command, revertedContainer.Args...))
+		})
+	}
+}
+
+type contextResolver struct{}
+
+func (contextResolver) ResolveImageCommand(ctx context.Context,
+	_ kueueleuleu.ImageCommandRequest,
+) (kueueleuleu.ImageCommand, error) {
+	if err := ctx.Err(); err != nil {
+		return kueueleuleu.ImageCommand{}, err //nolint:wrapcheck
+	}
+
+	return kueueleuleu.ImageCommand{Entrypoint: []string{"/bin/app"}}, nil
+}
+
+func Test_ConvertPod_withContext(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "step", Image: "app"}},
+		},
+	}
+
+	_, err := kueueleuleu.ConvertPod(pod, kueueleuleu.WithCommandResolver(contextResolver{}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithCommandResolver(contextResolver{}),
+		kueueleuleu.WithContext(ctx),
+	)
+	require.ErrorIs(t, err, kueueleuleu.ErrCannotResolveCommand)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,118 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	ErrInvalidResourceList     = errors.New("invalid resource list")
+	ErrInvalidPrepareResources = errors.New("invalid resources for the prepare init container")
+)
+
+// DefaultPrepareContainerResources - the resources of the init container copying the tekton entrypoint.
+// It only copies a binary, so it does not need much, but setting them allows running converted pods
+// in namespaces where a LimitRange or a ResourceQuota requires explicit resources.
+func DefaultPrepareContainerResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+}
+
+// ParseResourceList - parses a comma-separated list of resources, e.g. "cpu=10m,memory=32Mi".
+// This is the format of the norbjd.github.io/kueueleuleu-prepare-requests
+// and norbjd.github.io/kueueleuleu-prepare-limits annotations.
+func ParseResourceList(s string) (corev1.ResourceList, error) {
+	resourceList := make(corev1.ResourceList)
+
+	if strings.TrimSpace(s) == "" {
+		return resourceList, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("%w: %q is not <resource>=<quantity>", ErrInvalidResourceList, item)
+		}
+
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalidResourceList, name, err.Error())
+		}
+
+		resourceList[corev1.ResourceName(name)] = quantity
+	}
+
+	return resourceList, nil
+}
+
+// prepareContainerResources - computes the resources of the prepare init container: annotations of the object
+// take precedence over options, themselves replacing the defaults. Requests and limits are replaced as a whole.
+func prepareContainerResources(annotations map[string]string, opts options) (corev1.ResourceRequirements, error) {
+	resources := corev1.ResourceRequirements{
+		Requests: opts.prepareRequests,
+		Limits:   opts.prepareLimits,
+	}
+
+	var err error
+
+	if requests, isSet := annotations[prepareRequestsAnnotationKey]; isSet {
+		resources.Requests, err = ParseResourceList(requests)
+		if err != nil {
+			return corev1.ResourceRequirements{}, fmt.Errorf("%w: annotation %s: %w",
+				ErrInvalidPrepareResources, prepareRequestsAnnotationKey, err)
+		}
+	}
+
+	if limits, isSet := annotations[prepareLimitsAnnotationKey]; isSet {
+		resources.Limits, err = ParseResourceList(limits)
+		if err != nil {
+			return corev1.ResourceRequirements{}, fmt.Errorf("%w: annotation %s: %w",
+				ErrInvalidPrepareResources, prepareLimitsAnnotationKey, err)
+		}
+	}
+
+	for name, request := range resources.Requests {
+		if limit, hasLimit := resources.Limits[name]; hasLimit && request.Cmp(limit) > 0 {
+			return corev1.ResourceRequirements{}, fmt.Errorf("%w: %s request (%s) is greater than its limit (%s)",
+				ErrInvalidPrepareResources, name, request.String(), limit.String())
+		}
+	}
+
+	if len(resources.Requests) == 0 {
+		resources.Requests = nil
+	}
+
+	if len(resources.Limits) == 0 {
+		resources.Limits = nil
+	}
+
+	return resources, nil
+}
@@ -0,0 +1,154 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"testing"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ParseResourceList(t *testing.T) {
+	t.Parallel()
+
+	resourceList, err := kueueleuleu.ParseResourceList("cpu=10m, memory=32Mi")
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("10m"),
+		corev1.ResourceMemory: resource.MustParse("32Mi"),
+	}, resourceList)
+
+	resourceList, err = kueueleuleu.ParseResourceList("")
+	require.NoError(t, err)
+	assert.Empty(t, resourceList)
+
+	_, err = kueueleuleu.ParseResourceList("cpu")
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidResourceList)
+
+	_, err = kueueleuleu.ParseResourceList("cpu=a lot")
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidResourceList)
+}
+
+func Test_ConvertPod_prepareContainerResources(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.DefaultPrepareContainerResources(), kueueleuleuPod.Spec.InitContainers[0].Resources)
+
+	kueueleuleuPod, err = kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithPrepareContainerRequests(corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("50m"),
+		}),
+		kueueleuleu.WithPrepareContainerLimits(corev1.ResourceList{}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("50m"),
+		},
+	}, kueueleuleuPod.Spec.InitContainers[0].Resources)
+
+	_, err = kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithPrepareContainerRequests(corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("1"),
+		}),
+	)
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidPrepareResources)
+
+	// lists given to options are not shared with converted pods
+	requests := corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("50m"),
+	}
+	withRequests := kueueleuleu.WithPrepareContainerRequests(requests)
+	requests[corev1.ResourceMemory] = resource.MustParse("64Mi")
+
+	kueueleuleuPod, err = kueueleuleu.ConvertPod(pod, withRequests)
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("50m"),
+	}, kueueleuleuPod.Spec.InitContainers[0].Resources.Requests)
+
+	kueueleuleuPod.Spec.InitContainers[0].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("1")
+
+	kueueleuleuPod, err = kueueleuleu.ConvertPod(pod, withRequests)
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("50m"),
+	}, kueueleuleuPod.Spec.InitContainers[0].Resources.Requests)
+}
+
+func Test_ConvertJob_prepareContainerResourcesFromAnnotations(t *testing.T) {
+	t.Parallel()
+
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+			Annotations: map[string]string{
+				"norbjd.github.io/kueueleuleu-prepare-requests": "cpu=1m",
+				"norbjd.github.io/kueueleuleu-prepare-limits":   "cpu=200m,memory=128Mi",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						// the innermost annotation wins
+						"norbjd.github.io/kueueleuleu-prepare-requests": "cpu=20m,memory=64Mi",
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+
+	kueueleuleuJob, err := kueueleuleu.ConvertJob(job,
+		kueueleuleu.WithPrepareContainerLimits(corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("1"),
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("20m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("200m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+	}, kueueleuleuJob.Spec.Template.Spec.InitContainers[0].Resources)
+
+	job.Annotations["norbjd.github.io/kueueleuleu-prepare-limits"] = "cpu"
+
+	_, err = kueueleuleu.ConvertJob(job)
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidPrepareResources)
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidResourceList)
+}
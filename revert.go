@@ -0,0 +1,82 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"errors"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var ErrNotAKueueleuleuObject = errors.New("not a kueueleuleu object")
+
+// RevertPod - reverts a pod converted with ConvertPod to its original form.
+// Because the conversion does not keep track of the boundary between the original command and args,
+// the reverted containers have the original entrypoint as command and everything else as args.
+func RevertPod(pod corev1.Pod) (corev1.Pod, error) {
+	if !IsKueueleuleu(pod.ObjectMeta) {
+		return corev1.Pod{}, fmt.Errorf("can't revert pod: %w", ErrNotAKueueleuleuObject)
+	}
+
+	var err error
+
+	originalPod := *pod.DeepCopy()
+
+	originalPod.ObjectMeta = revertObjectMeta(originalPod.ObjectMeta)
+	originalPod.Spec, err = revertPodSpec(originalPod.Spec)
+
+	return originalPod, err
+}
+
+// RevertJob - reverts a job converted with ConvertJob to its original form (see RevertPod).
+func RevertJob(job batchv1.Job) (batchv1.Job, error) {
+	if !IsKueueleuleu(job.ObjectMeta) {
+		return batchv1.Job{}, fmt.Errorf("can't revert job: %w", ErrNotAKueueleuleuObject)
+	}
+
+	var err error
+
+	originalJob := *job.DeepCopy()
+
+	originalJob.ObjectMeta = revertObjectMeta(originalJob.ObjectMeta)
+	originalJob.Spec.Template.ObjectMeta = revertObjectMeta(originalJob.Spec.Template.ObjectMeta)
+	originalJob.Spec.Template.Spec, err = revertPodSpec(originalJob.Spec.Template.Spec)
+
+	return originalJob, err
+}
+
+// RevertCronJob - reverts a cronjob converted with ConvertCronJob to its original form (see RevertPod).
+func RevertCronJob(cronjob batchv1.CronJob) (batchv1.CronJob, error) {
+	if !IsKueueleuleu(cronjob.ObjectMeta) {
+		return batchv1.CronJob{}, fmt.Errorf("can't revert cronjob: %w", ErrNotAKueueleuleuObject)
+	}
+
+	var err error
+
+	originalCronjob := *cronjob.DeepCopy()
+
+	originalCronjob.ObjectMeta = revertObjectMeta(originalCronjob.ObjectMeta)
+	originalCronjob.Spec.JobTemplate.ObjectMeta = revertObjectMeta(originalCronjob.Spec.JobTemplate.ObjectMeta)
+	originalCronjob.Spec.JobTemplate.Spec.Template.ObjectMeta = revertObjectMeta(
+		originalCronjob.Spec.JobTemplate.Spec.Template.ObjectMeta)
+	originalCronjob.Spec.JobTemplate.Spec.Template.Spec, err = revertPodSpec(
+		originalCronjob.Spec.JobTemplate.Spec.Template.Spec)
+
+	return originalCronjob, err
+}
@@ -0,0 +1,199 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"testing"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RevertPod(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	revertedPod, err := kueueleuleu.RevertPod(kueueleuleuPod)
+	require.NoError(t, err)
+	assert.False(t, kueueleuleu.IsKueueleuleu(revertedPod.ObjectMeta))
+	assert.Equal(t, pod, revertedPod)
+}
+
+func Test_RevertPod_commandAndArgs(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "dummy",
+			Annotations: map[string]string{"foo": "bar"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "step1",
+					Image:   "alpine",
+					Command: []string{"sh", "-c"},
+					Args:    []string{"echo -- -entrypoint"},
+				},
+				{
+					Name:    "step2",
+					Image:   "alpine",
+					Command: []string{"true"},
+				},
+			},
+		},
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	revertedPod, err := kueueleuleu.RevertPod(kueueleuleuPod)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar"}, revertedPod.Annotations)
+
+	// the boundary between command and args is lost, but the resulting command line is the same
+	assert.Equal(t, []string{"sh"}, revertedPod.Spec.Containers[0].Command)
+	assert.Equal(t, []string{"-c", "echo -- -entrypoint"}, revertedPod.Spec.Containers[0].Args)
+	assert.Equal(t, []string{"true"}, revertedPod.Spec.Containers[1].Command)
+	assert.Nil(t, revertedPod.Spec.Containers[1].Args)
+	assert.Nil(t, revertedPod.Spec.InitContainers)
+	assert.Nil(t, revertedPod.Spec.Volumes)
+}
+
+func Test_RevertPod_userVolumeWithTektonPrefix(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "step1",
+					Image:   "alpine",
+					Command: []string{"true"},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "tekton-internal-cache", MountPath: "/cache"},
+					},
+				},
+				{
+					Name:    "step2",
+					Image:   "alpine",
+					Command: []string{"true"},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "tekton-internal-cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+
+	kueueleuleuPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	// only the volumes added by the conversion are removed
+	revertedPod, err := kueueleuleu.RevertPod(kueueleuleuPod)
+	require.NoError(t, err)
+	assert.Equal(t, pod, revertedPod)
+}
+
+func Test_RevertPod_notKueueleuleu(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	_, err := kueueleuleu.RevertPod(pod)
+	require.ErrorIs(t, err, kueueleuleu.ErrNotAKueueleuleuObject)
+
+	pod.Annotations = map[string]string{"norbjd.github.io/kueueleuleu": "true"}
+
+	_, err = kueueleuleu.RevertPod(pod)
+	require.ErrorIs(t, err, kueueleuleu.ErrContainerIsNotConverted)
+	require.ErrorContains(t, err, "container1")
+}
+
+func Test_RevertJob(t *testing.T) {
+	t.Parallel()
+
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: podSpec,
+			},
+			BackoffLimit:            toPtr(int32(1)),
+			TTLSecondsAfterFinished: toPtr(int32(100)),
+		},
+	}
+
+	kueueleuleuJob, err := kueueleuleu.ConvertJob(job)
+	require.NoError(t, err)
+
+	revertedJob, err := kueueleuleu.RevertJob(kueueleuleuJob)
+	require.NoError(t, err)
+	assert.Equal(t, job, revertedJob)
+}
+
+func Test_RevertCronJob(t *testing.T) {
+	t.Parallel()
+
+	cronjob := batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: podSpec,
+					},
+					BackoffLimit:            toPtr(int32(1)),
+					TTLSecondsAfterFinished: toPtr(int32(100)),
+				},
+			},
+			Schedule: "0 0 * * *",
+		},
+	}
+
+	kueueleuleuCronJob, err := kueueleuleu.ConvertCronJob(cronjob)
+	require.NoError(t, err)
+
+	revertedCronJob, err := kueueleuleu.RevertCronJob(kueueleuleuCronJob)
+	require.NoError(t, err)
+	assert.Equal(t, cronjob, revertedCronJob)
+}
@@ -0,0 +1,283 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// tekton entrypoint termination message keys and values.
+	terminationMessageStartedAt       = "StartedAt"
+	terminationMessageExitCode        = "ExitCode"
+	terminationMessageReason          = "Reason"
+	terminationMessageTimeoutExceeded = "TimeoutExceeded"
+
+	// StepReasonWaitingForPreviousStep - the reason of a step waiting for the previous step to finish.
+	StepReasonWaitingForPreviousStep = "WaitingForPreviousStep"
+	// StepReasonPreviousStepFailed - the reason of a step skipped because a previous step has failed.
+	StepReasonPreviousStepFailed = "PreviousStepFailed"
+)
+
+var (
+	ErrStepNotFound           = errors.New("step not found")
+	ErrStepNotFinished        = errors.New("step is not finished")
+	ErrSentinelNoStepTimedOut = errors.New("no step timed out")
+)
+
+// StepState - the state of a step (a container of a kueueleuleu pod).
+type StepState string
+
+const (
+	// StepWaiting - the step has not started yet: it waits for the previous step to finish,
+	// or for the pod to start (e.g. pulling images).
+	StepWaiting StepState = "Waiting"
+	// StepRunning - the step is running.
+	StepRunning StepState = "Running"
+	// StepSucceeded - the step exited with 0, or with one of its success exit codes.
+	StepSucceeded StepState = "Succeeded"
+	// StepFailed - the step exited with a non-zero exit code, and the next steps are skipped.
+	StepFailed StepState = "Failed"
+	// StepFailedContinued - the step exited with a non-zero exit code, but the next steps run anyway
+	// (see OnErrorContinue).
+	StepFailedContinued StepState = "FailedContinued"
+	// StepTimedOut - the step was killed because it exceeded its timeout (see WithStepTimeout),
+	// and the next steps are skipped.
+	StepTimedOut StepState = "TimedOut"
+	// StepSkipped - the step did not run because a previous step has failed or timed out.
+	StepSkipped StepState = "Skipped"
+)
+
+// IsFinished - whether the step will not change anymore.
+func (s StepState) IsFinished() bool {
+	return s != StepWaiting && s != StepRunning
+}
+
+// stopsNextSteps - whether the next steps are skipped after a step in this state.
+func (s StepState) stopsNextSteps() bool {
+	return s == StepFailed || s == StepTimedOut || s == StepSkipped
+}
+
+// StepStatus - the status of a step.
+type StepStatus struct {
+	Name  string    `json:"name"`
+	State StepState `json:"state"`
+	// ExitCode - the exit code of the step command, only set when the step is finished.
+	ExitCode int32 `json:"exitCode"`
+	// StartedAt - when the step command started, zero if it has not started yet.
+	StartedAt metav1.Time `json:"startedAt"`
+	// FinishedAt - when the step finished, zero if it is not finished.
+	FinishedAt metav1.Time `json:"finishedAt"`
+	// Reason - a short explanation of the state, e.g. WaitingForPreviousStep, ImagePullBackOff, OOMKilled.
+	Reason string `json:"reason,omitempty"`
+}
+
+// StepResult - the result of a finished step.
+type StepResult struct {
+	Name     string
+	State    StepState
+	ExitCode int32
+}
+
+// GetStepStatuses - returns the status of every step of the pod, in the order containers are declared,
+// built from the containers statuses and the termination messages written by the tekton entrypoint.
+func GetStepStatuses(pod corev1.Pod) ([]StepStatus, error) {
+	if !IsKueueleuleu(pod.ObjectMeta) {
+		return nil, ErrNotAKueueleuleuPod
+	}
+
+	successExitCodes, err := ParseStepSuccessExitCodes(pod.Annotations[successExitCodesAnnotationKey])
+	if err != nil {
+		return nil, err
+	}
+
+	containerStatuses := make(map[string]corev1.ContainerStatus, len(pod.Status.ContainerStatuses))
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		containerStatuses[containerStatus.Name] = containerStatus
+	}
+
+	stepStatuses := make([]StepStatus, 0, len(pod.Spec.Containers))
+
+	var previousStepStatus *StepStatus
+
+	for _, container := range pod.Spec.Containers {
+		stepStatus := getStepStatus(container.Name, containerStatuses[container.Name], previousStepStatus,
+			successExitCodes[container.Name])
+
+		stepStatuses = append(stepStatuses, stepStatus)
+		previousStepStatus = &stepStatuses[len(stepStatuses)-1]
+	}
+
+	return stepStatuses, nil
+}
+
+func getStepStatus(containerName string, containerStatus corev1.ContainerStatus, previousStepStatus *StepStatus,
+	successExitCodes []int32,
+) StepStatus {
+	stepStatus := StepStatus{
+		Name:  containerName,
+		State: StepWaiting,
+	}
+
+	state := containerStatus.State
+
+	switch {
+	case state.Terminated != nil && !state.Terminated.FinishedAt.IsZero():
+		return getTerminatedStepStatus(stepStatus, *state.Terminated, previousStepStatus, successExitCodes)
+	case state.Running != nil:
+		// all containers start at the same time, but steps wait for the previous step to finish
+		if previousStepStatus != nil && !previousStepStatus.State.IsFinished() {
+			stepStatus.Reason = StepReasonWaitingForPreviousStep
+
+			break
+		}
+
+		stepStatus.State = StepRunning
+		stepStatus.StartedAt = state.Running.StartedAt
+
+		// the container might have been restarted after the previous step has finished
+		if previousStepStatus != nil && previousStepStatus.FinishedAt.After(stepStatus.StartedAt.Time) {
+			stepStatus.StartedAt = previousStepStatus.FinishedAt
+		}
+	case state.Waiting != nil:
+		stepStatus.Reason = state.Waiting.Reason
+	}
+
+	return stepStatus
+}
+
+func getTerminatedStepStatus(stepStatus StepStatus, terminated corev1.ContainerStateTerminated,
+	previousStepStatus *StepStatus, successExitCodes []int32,
+) StepStatus {
+	terminationMessage := parseTerminationMessage(terminated.Message)
+
+	stepStatus.State = StepSucceeded
+	stepStatus.ExitCode = terminated.ExitCode
+	stepStatus.FinishedAt = terminated.FinishedAt
+	stepStatus.StartedAt = terminated.StartedAt
+
+	if startedAt, err := time.Parse(time.RFC3339, terminationMessage[terminationMessageStartedAt]); err == nil {
+		stepStatus.StartedAt = metav1.NewTime(startedAt)
+	}
+
+	if terminated.ExitCode != 0 {
+		switch {
+		case previousStepStatus != nil && previousStepStatus.State.stopsNextSteps():
+			stepStatus.State = StepSkipped
+			stepStatus.Reason = StepReasonPreviousStepFailed
+		case terminationMessage[terminationMessageReason] == terminationMessageTimeoutExceeded:
+			stepStatus.State = StepTimedOut
+			stepStatus.Reason = terminationMessageTimeoutExceeded
+		default:
+			stepStatus.State = StepFailed
+			stepStatus.Reason = terminated.Reason
+		}
+
+		return stepStatus
+	}
+
+	// when continuing on error, the container exits with 0, and the entrypoint writes the command exit code
+	// in the termination message
+	exitCode, err := strconv.ParseInt(terminationMessage[terminationMessageExitCode], 10, 32)
+	if err != nil {
+		return stepStatus
+	}
+
+	stepStatus.ExitCode = int32(exitCode)
+
+	if stepStatus.ExitCode != 0 && !slices.Contains(successExitCodes, stepStatus.ExitCode) {
+		stepStatus.State = StepFailedContinued
+	}
+
+	return stepStatus
+}
+
+// GetStepResult - returns the result of a finished step. The exit code is the one of the command run by the step,
+// which can be different from the container exit code when the step continues on error.
+func GetStepResult(pod corev1.Pod, containerName string) (StepResult, error) {
+	stepStatuses, err := GetStepStatuses(pod)
+	if err != nil {
+		return StepResult{}, err
+	}
+
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.Name != containerName {
+			continue
+		}
+
+		if !stepStatus.State.IsFinished() {
+			return StepResult{}, fmt.Errorf("%w: %s", ErrStepNotFinished, containerName)
+		}
+
+		return StepResult{
+			Name:     stepStatus.Name,
+			State:    stepStatus.State,
+			ExitCode: stepStatus.ExitCode,
+		}, nil
+	}
+
+	return StepResult{}, fmt.Errorf("%w: %s", ErrStepNotFound, containerName)
+}
+
+// GetTimedOutContainerName - returns the name of the container that exceeded its timeout (see WithStepTimeout),
+// or ErrSentinelNoStepTimedOut.
+func GetTimedOutContainerName(pod corev1.Pod) (string, error) {
+	stepStatuses, err := GetStepStatuses(pod)
+	if err != nil {
+		return "", err
+	}
+
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.State == StepTimedOut {
+			return stepStatus.Name, nil
+		}
+	}
+
+	return "", ErrSentinelNoStepTimedOut
+}
+
+// terminationMessageEntry - an entry of the termination message written by the tekton entrypoint.
+type terminationMessageEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// parseTerminationMessage - parses the termination message written by the tekton entrypoint, a JSON list
+// of key/value entries (e.g. StartedAt, ExitCode). An invalid message is ignored.
+func parseTerminationMessage(message string) map[string]string {
+	var entries []terminationMessageEntry
+
+	values := make(map[string]string)
+
+	if err := json.Unmarshal([]byte(message), &entries); err != nil {
+		return values
+	}
+
+	for _, entry := range entries {
+		values[entry.Key] = entry.Value
+	}
+
+	return values
+}
@@ -0,0 +1,102 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package status provides read-only helpers to follow kueueleuleu pods from controllers: they never modify
+// the pods they are given, so they can be used with pods of an informer cache (see corev1listers.PodLister).
+package status
+
+import (
+	"fmt"
+
+	"github.com/norbjd/kueueleuleu"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// PodsLister - lists pods, e.g. from an informer cache.
+// Implemented by corev1listers.PodLister and corev1listers.PodNamespaceLister.
+type PodsLister interface {
+	List(selector labels.Selector) ([]*corev1.Pod, error)
+}
+
+// Progress - the progress of a kueueleuleu pod.
+type Progress struct {
+	Steps []kueueleuleu.StepStatus
+	// RunningStep - the name of the running step, empty if no step is running.
+	RunningStep string
+	// FinishedSteps - the number of finished steps (see kueueleuleu.StepState.IsFinished).
+	FinishedSteps int
+}
+
+// IsFinished - whether all steps are finished.
+func (p Progress) IsFinished() bool {
+	return p.FinishedSteps == len(p.Steps)
+}
+
+// ListKueueleuleuPods - lists the kueueleuleu pods matching the selector. Returned pods are the ones
+// of the lister, so when it is backed by an informer cache, they must not be modified.
+func ListKueueleuleuPods(lister PodsLister, selector labels.Selector) ([]*corev1.Pod, error) {
+	pods, err := lister.List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pods: %w", err)
+	}
+
+	kueueleuleuPods := make([]*corev1.Pod, 0, len(pods))
+
+	for _, pod := range pods {
+		if kueueleuleu.IsKueueleuleu(pod.ObjectMeta) {
+			kueueleuleuPods = append(kueueleuleuPods, pod)
+		}
+	}
+
+	return kueueleuleuPods, nil
+}
+
+// GetProgress - returns the progress of a kueueleuleu pod. Like all status helpers, it never modifies the pod,
+// so it can be used with pods of an informer cache.
+func GetProgress(pod *corev1.Pod) (Progress, error) {
+	stepStatuses, err := kueueleuleu.GetStepStatuses(*pod)
+	if err != nil {
+		return Progress{}, err //nolint:wrapcheck
+	}
+
+	progress := Progress{
+		Steps: stepStatuses,
+	}
+
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.State == kueueleuleu.StepRunning {
+			progress.RunningStep = stepStatus.Name
+		}
+
+		if stepStatus.State.IsFinished() {
+			progress.FinishedSteps++
+		}
+	}
+
+	return progress, nil
+}
+
+// GetProgressByName - returns the progress of the kueueleuleu pod namespace/name, retrieved with the lister.
+func GetProgressByName(lister corev1listers.PodLister, namespace, name string) (Progress, error) {
+	pod, err := lister.Pods(namespace).Get(name)
+	if err != nil {
+		return Progress{}, fmt.Errorf("cannot get pod %s/%s: %w", namespace, name, err)
+	}
+
+	return GetProgress(pod)
+}
@@ -0,0 +1,144 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package status_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var podSpec = corev1.PodSpec{
+	Containers: []corev1.Container{
+		{Name: "step1", Image: "alpine", Command: []string{"echo", "step1"}},
+		{Name: "step2", Image: "alpine", Command: []string{"sleep", "60"}},
+		{Name: "step3", Image: "alpine", Command: []string{"echo", "step3"}},
+	},
+}
+
+func newPodLister(t *testing.T, pods ...*corev1.Pod) corev1listers.PodLister {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	for _, pod := range pods {
+		require.NoError(t, indexer.Add(pod))
+	}
+
+	return corev1listers.NewPodLister(indexer)
+}
+
+// runningPod - a converted pod whose first step is finished, and second step is running.
+// Statuses are not in the order containers are declared, as returned by the API server.
+func runningPod(t *testing.T, name string, podLabels map[string]string) *corev1.Pod {
+	t.Helper()
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    podLabels,
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	startedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: startedAt}}
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		Reason:     "Completed",
+		FinishedAt: startedAt,
+	}}
+
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "kueueleuleu-prepare", State: terminated},
+	}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "step3", State: running},
+		{Name: "step1", State: terminated},
+		{Name: "step2", State: running},
+	}
+
+	return &pod
+}
+
+func Test_ListKueueleuleuPods(t *testing.T) {
+	t.Parallel()
+
+	notConvertedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "not-converted",
+			Namespace: "default",
+			Labels:    map[string]string{"team": "a"},
+		},
+		Spec: podSpec,
+	}
+
+	lister := newPodLister(t,
+		runningPod(t, "pod-a", map[string]string{"team": "a"}),
+		runningPod(t, "pod-b", map[string]string{"team": "b"}),
+		notConvertedPod,
+	)
+
+	pods, err := status.ListKueueleuleuPods(lister, labels.Everything())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"pod-a", "pod-b"}, []string{pods[0].Name, pods[1].Name})
+
+	pods, err = status.ListKueueleuleuPods(lister.Pods("default"), labels.SelectorFromSet(labels.Set{"team": "a"}))
+	require.NoError(t, err)
+	require.Len(t, pods, 1)
+	assert.Equal(t, "pod-a", pods[0].Name)
+
+	pods, err = status.ListKueueleuleuPods(lister.Pods("other"), labels.Everything())
+	require.NoError(t, err)
+	assert.Empty(t, pods)
+}
+
+func Test_GetProgressByName(t *testing.T) {
+	t.Parallel()
+
+	pod := runningPod(t, "pod-a", nil)
+	originalPod := pod.DeepCopy()
+	lister := newPodLister(t, pod)
+
+	progress, err := status.GetProgressByName(lister, "default", "pod-a")
+	require.NoError(t, err)
+	assert.Equal(t, "step2", progress.RunningStep)
+	assert.Equal(t, 1, progress.FinishedSteps)
+	assert.False(t, progress.IsFinished())
+	require.Len(t, progress.Steps, 3)
+	assert.Equal(t, "step1", progress.Steps[0].Name)
+
+	// the pod of the lister is not modified
+	assert.Equal(t, originalPod, pod)
+
+	_, err = status.GetProgressByName(lister, "default", "does-not-exist")
+	assert.True(t, apierrors.IsNotFound(err))
+}
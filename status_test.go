@@ -0,0 +1,295 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func terminatedState(exitCode int32, message string, finishedAt metav1.Time) corev1.ContainerState {
+	reason := "Completed"
+	if exitCode != 0 {
+		reason = "Error"
+	}
+
+	return corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{
+			ExitCode:   exitCode,
+			Reason:     reason,
+			Message:    message,
+			FinishedAt: finishedAt,
+		},
+	}
+}
+
+func Test_GetStepStatuses(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	convertedPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	podStartedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	step1StartedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 5, 0, time.UTC))
+	step1FinishedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC))
+	step2FinishedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 20, 0, time.UTC))
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: podStartedAt}}
+
+	// the pod is initializing
+	convertedPod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "aaa", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+	}
+
+	stepStatuses, err := kueueleuleu.GetStepStatuses(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, []kueueleuleu.StepStatus{
+		{Name: "container1", State: kueueleuleu.StepWaiting},
+		{Name: "aaa", State: kueueleuleu.StepWaiting, Reason: "PodInitializing"},
+		{Name: "container3", State: kueueleuleu.StepWaiting},
+	}, stepStatuses)
+
+	// the first step is running, statuses are not in the containers order
+	convertedPod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "aaa", State: running},
+		{Name: "container1", State: running},
+		{Name: "container3", State: running},
+	}
+
+	stepStatuses, err = kueueleuleu.GetStepStatuses(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, []kueueleuleu.StepStatus{
+		{Name: "container1", State: kueueleuleu.StepRunning, StartedAt: podStartedAt},
+		{Name: "aaa", State: kueueleuleu.StepWaiting, Reason: kueueleuleu.StepReasonWaitingForPreviousStep},
+		{Name: "container3", State: kueueleuleu.StepWaiting, Reason: kueueleuleu.StepReasonWaitingForPreviousStep},
+	}, stepStatuses)
+
+	// the first step has succeeded, the second one is running
+	convertedPod.Status.ContainerStatuses[1].State = terminatedState(0,
+		`[{"key":"StartedAt","value":"2024-01-01T12:00:05.000Z","type":3}]`, step1FinishedAt)
+
+	stepStatuses, err = kueueleuleu.GetStepStatuses(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, []kueueleuleu.StepStatus{
+		{
+			Name: "container1", State: kueueleuleu.StepSucceeded,
+			StartedAt: step1StartedAt, FinishedAt: step1FinishedAt,
+		},
+		{Name: "aaa", State: kueueleuleu.StepRunning, StartedAt: step1FinishedAt},
+		{Name: "container3", State: kueueleuleu.StepWaiting, Reason: kueueleuleu.StepReasonWaitingForPreviousStep},
+	}, stepStatuses)
+
+	// the second step has failed, the last one is skipped
+	convertedPod.Status.ContainerStatuses[0].State = terminatedState(2,
+		`[{"key":"StartedAt","value":"2024-01-01T12:00:10.000Z","type":3}]`, step2FinishedAt)
+	convertedPod.Status.ContainerStatuses[2].State = terminatedState(1,
+		`[{"key":"StartedAt","value":"2024-01-01T12:00:20.000Z","type":3}]`, step2FinishedAt)
+
+	stepStatuses, err = kueueleuleu.GetStepStatuses(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, []kueueleuleu.StepStatus{
+		{
+			Name: "container1", State: kueueleuleu.StepSucceeded,
+			StartedAt: step1StartedAt, FinishedAt: step1FinishedAt,
+		},
+		{
+			Name: "aaa", State: kueueleuleu.StepFailed, ExitCode: 2, Reason: "Error",
+			StartedAt: step1FinishedAt, FinishedAt: step2FinishedAt,
+		},
+		{
+			Name: "container3", State: kueueleuleu.StepSkipped, ExitCode: 1,
+			Reason:    kueueleuleu.StepReasonPreviousStepFailed,
+			StartedAt: step2FinishedAt, FinishedAt: step2FinishedAt,
+		},
+	}, stepStatuses)
+
+	_, err = kueueleuleu.GetStepStatuses(pod)
+	require.ErrorIs(t, err, kueueleuleu.ErrNotAKueueleuleuPod)
+}
+
+func Test_GetStepResult(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	convertedPod, err := kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithStepOnError("container1", kueueleuleu.OnErrorContinue),
+		kueueleuleu.WithStepSuccessExitCodes("aaa", 1),
+	)
+	require.NoError(t, err)
+
+	finishedAt := metav1.Now()
+	terminated := func(exitCode int32, message string) corev1.ContainerState {
+		return terminatedState(exitCode, message, finishedAt)
+	}
+
+	convertedPod.Status.Phase = corev1.PodFailed
+	convertedPod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name:  "aaa",
+			State: terminated(0, `[{"key":"ExitCode","value":"1","type":3},{"key":"StartedAt","value":"x","type":3}]`),
+		},
+		{
+			Name:  "container1",
+			State: terminated(0, `[{"key":"ExitCode","value":"2","type":3},{"key":"StartedAt","value":"x","type":3}]`),
+		},
+		{
+			Name:  "container3",
+			State: terminated(3, `[{"key":"StartedAt","value":"x","type":3}]`),
+		},
+	}
+
+	_, err = kueueleuleu.GetTimedOutContainerName(convertedPod)
+	require.ErrorIs(t, err, kueueleuleu.ErrSentinelNoStepTimedOut)
+
+	stepResult, err := kueueleuleu.GetStepResult(convertedPod, "container1")
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.StepResult{
+		Name:     "container1",
+		State:    kueueleuleu.StepFailedContinued,
+		ExitCode: 2,
+	}, stepResult)
+
+	stepResult, err = kueueleuleu.GetStepResult(convertedPod, "aaa")
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.StepResult{
+		Name:     "aaa",
+		State:    kueueleuleu.StepSucceeded,
+		ExitCode: 1,
+	}, stepResult)
+
+	stepResult, err = kueueleuleu.GetStepResult(convertedPod, "container3")
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.StepResult{
+		Name:     "container3",
+		State:    kueueleuleu.StepFailed,
+		ExitCode: 3,
+	}, stepResult)
+
+	_, err = kueueleuleu.GetStepResult(convertedPod, "unknown")
+	require.ErrorIs(t, err, kueueleuleu.ErrStepNotFound)
+
+	convertedPod.Status.ContainerStatuses[2].State = terminated(1,
+		`[{"key":"Reason","value":"TimeoutExceeded","type":3},{"key":"StartedAt","value":"x","type":3}]`)
+
+	stepResult, err = kueueleuleu.GetStepResult(convertedPod, "container3")
+	require.NoError(t, err)
+	assert.Equal(t, kueueleuleu.StepResult{
+		Name:     "container3",
+		State:    kueueleuleu.StepTimedOut,
+		ExitCode: 1,
+	}, stepResult)
+
+	timedOutContainerName, err := kueueleuleu.GetTimedOutContainerName(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, "container3", timedOutContainerName)
+
+	convertedPod.Status.ContainerStatuses[2].State = corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{},
+	}
+
+	_, err = kueueleuleu.GetStepResult(convertedPod, "container3")
+	require.ErrorIs(t, err, kueueleuleu.ErrStepNotFinished)
+}
+
+// runningPod - a converted pod whose first step is finished, and second step is running.
+// Statuses are not in the order containers are declared, as returned by the API server.
+func runningPod(t *testing.T, name string, podLabels map[string]string) *corev1.Pod {
+	t.Helper()
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    podLabels,
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	startedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: startedAt}}
+
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "kueueleuleu-prepare", State: terminatedState(0, "", startedAt)},
+		{Name: "dummy-init-container", State: terminatedState(0, "", startedAt)},
+	}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container3", State: running},
+		{Name: "container1", State: terminatedState(0, "", startedAt)},
+		{Name: "aaa", State: running},
+	}
+
+	return &pod
+}
+
+// Test_statusHelpersDoNotModifyPods - status helpers are used with pods of informer caches, shared between
+// controllers: they must never modify them, even through slices sharing the same backing array.
+func Test_statusHelpersDoNotModifyPods(t *testing.T) {
+	t.Parallel()
+
+	pod := runningPod(t, "pod-a", nil)
+	// leave room in the backing arrays, so that appending to them would modify the pod
+	pod.Spec.InitContainers = append(make([]corev1.Container, 0, 10), pod.Spec.InitContainers...)
+	pod.Status.InitContainerStatuses = append(make([]corev1.ContainerStatus, 0, 10), pod.Status.InitContainerStatuses...)
+
+	originalPod := pod.DeepCopy()
+
+	_, err := kueueleuleu.GetRunningContainerName(*pod)
+	require.NoError(t, err)
+
+	_, err = kueueleuleu.GetWaitingContainerNames(*pod)
+	require.NoError(t, err)
+
+	_, err = kueueleuleu.GetStepStatuses(*pod)
+	require.NoError(t, err)
+
+	_, err = kueueleuleu.GetStepResult(*pod, "container1")
+	require.NoError(t, err)
+
+	_, err = kueueleuleu.GetTimedOutContainerName(*pod)
+	require.ErrorIs(t, err, kueueleuleu.ErrSentinelNoStepTimedOut)
+
+	assert.Equal(t, originalPod, pod)
+
+	for _, initContainer := range pod.Spec.InitContainers[len(pod.Spec.InitContainers):cap(pod.Spec.InitContainers)] {
+		assert.Empty(t, initContainer.Name)
+	}
+
+	for _, initContainerStatus := range pod.Status.InitContainerStatuses[len(pod.Status.InitContainerStatuses):cap(
+		pod.Status.InitContainerStatuses)] {
+		assert.Empty(t, initContainerStatus.Name)
+	}
+}
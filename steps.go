@@ -0,0 +1,354 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	onErrorAnnotationKey          = "norbjd.github.io/kueueleuleu-on-error"
+	successExitCodesAnnotationKey = "norbjd.github.io/kueueleuleu-success-exit-codes"
+	timeoutAnnotationKey          = "norbjd.github.io/kueueleuleu-timeout"
+
+	// the shell running commands of steps with success exit codes, and the name ($0) of its script,
+	// used to recognize it when reverting.
+	successExitCodesShell      = "/bin/sh"
+	successExitCodesScriptName = "kueueleuleu-success-exit-codes"
+)
+
+var (
+	ErrInvalidStepValues   = errors.New("invalid step values")
+	ErrInvalidStepSettings = errors.New("invalid step settings")
+)
+
+// OnError - what happens to the next steps when a step fails.
+type OnError string
+
+const (
+	// OnErrorStopAndFail - the next steps are skipped, and the pod fails (default).
+	OnErrorStopAndFail OnError = "stopAndFail"
+	// OnErrorContinue - the next steps run as if the step had succeeded. The step is reported as StepFailedContinued.
+	OnErrorContinue OnError = "continue"
+)
+
+// stepSettings - the settings of a step (a container), set by options or annotations.
+type stepSettings struct {
+	onError          OnError
+	successExitCodes []int32
+	timeout          time.Duration
+}
+
+// entrypointArgs - the tekton entrypoint flags implementing the settings.
+func (s stepSettings) entrypointArgs() []string {
+	var args []string
+
+	if s.onError == OnErrorContinue {
+		args = append(args, "-on_error", string(OnErrorContinue))
+	}
+
+	if s.timeout > 0 {
+		args = append(args, "-timeout", s.timeout.String())
+	}
+
+	return args
+}
+
+// wrapCommand - returns the command line (command and args) run by the tekton entrypoint. The tekton entrypoint
+// can't stop depending on the exit code: when the step stops on error and has success exit codes, the command
+// is run by a shell exiting with 0 on these exit codes, so other exit codes still make the pod fail.
+// The command exit code is written in the termination message, as the tekton entrypoint does when continuing
+// on error, so the status helpers report it.
+func (s stepSettings) wrapCommand(commandLine []string, terminationPath string) []string {
+	if s.onError == OnErrorContinue || len(s.successExitCodes) == 0 {
+		return commandLine
+	}
+
+	exitCodes := make([]string, 0, len(s.successExitCodes))
+	for _, exitCode := range s.successExitCodes {
+		exitCodes = append(exitCodes, strconv.Itoa(int(exitCode)))
+	}
+
+	script := fmt.Sprintf(`"$@"; exitCode=$?; case $exitCode in %s) `+
+		`printf '[{"key":"%s","value":"%%s","type":3}]' "$exitCode" > %s; exit 0;; esac; exit $exitCode`,
+		strings.Join(exitCodes, "|"), terminationMessageExitCode, quoteShell(terminationPath))
+
+	return append([]string{successExitCodesShell, "-c", script, successExitCodesScriptName}, commandLine...)
+}
+
+// unwrapCommand - returns the command line wrapped by wrapCommand, or the command line if it is not wrapped.
+func unwrapCommand(commandLine []string) []string {
+	if len(commandLine) > 4 && commandLine[0] == successExitCodesShell && commandLine[1] == "-c" &&
+		commandLine[3] == successExitCodesScriptName {
+		return commandLine[4:]
+	}
+
+	return commandLine
+}
+
+// quoteShell - quotes a string to be used as a single word in a shell script.
+func quoteShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseStepValues - parses a comma-separated list of <container>=<value>.
+func parseStepValues(s string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	if strings.TrimSpace(s) == "" {
+		return values, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		containerName, value, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found || containerName == "" {
+			return nil, fmt.Errorf("%w: %q is not <container>=<value>", ErrInvalidStepValues, item)
+		}
+
+		values[containerName] = value
+	}
+
+	return values, nil
+}
+
+// ParseStepOnErrors - parses a comma-separated list of <container>=<on error>, e.g. "cleanup=continue".
+// This is the format of the norbjd.github.io/kueueleuleu-on-error annotation.
+func ParseStepOnErrors(s string) (map[string]OnError, error) {
+	values, err := parseStepValues(s)
+	if err != nil {
+		return nil, err
+	}
+
+	onErrors := make(map[string]OnError, len(values))
+
+	for containerName, value := range values {
+		onError := OnError(value)
+
+		switch onError {
+		case OnErrorStopAndFail, OnErrorContinue:
+		default:
+			return nil, fmt.Errorf("%w: %s: on error must be %s or %s, got %q",
+				ErrInvalidStepValues, containerName, OnErrorStopAndFail, OnErrorContinue, value)
+		}
+
+		onErrors[containerName] = onError
+	}
+
+	return onErrors, nil
+}
+
+// ParseStepSuccessExitCodes - parses a comma-separated list of <container>=<exit codes>, exit codes being
+// separated by semicolons, e.g. "grep=1,diff=1;2".
+// This is the format of the norbjd.github.io/kueueleuleu-success-exit-codes annotation.
+func ParseStepSuccessExitCodes(s string) (map[string][]int32, error) {
+	values, err := parseStepValues(s)
+	if err != nil {
+		return nil, err
+	}
+
+	successExitCodes := make(map[string][]int32, len(values))
+
+	for containerName, value := range values {
+		for _, item := range strings.Split(value, ";") {
+			exitCode, err := strconv.ParseInt(strings.TrimSpace(item), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: invalid exit code %q", ErrInvalidStepValues, containerName, item)
+			}
+
+			successExitCodes[containerName] = append(successExitCodes[containerName], int32(exitCode))
+		}
+	}
+
+	return successExitCodes, nil
+}
+
+// ParseStepTimeouts - parses a comma-separated list of <container>=<duration>, e.g. "build=10m,test=1h30m".
+// This is the format of the norbjd.github.io/kueueleuleu-timeout annotation.
+func ParseStepTimeouts(s string) (map[string]time.Duration, error) {
+	values, err := parseStepValues(s)
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts := make(map[string]time.Duration, len(values))
+
+	for containerName, value := range values {
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: invalid timeout %q", ErrInvalidStepValues, containerName, value)
+		}
+
+		timeouts[containerName] = timeout
+	}
+
+	return timeouts, nil
+}
+
+func formatStepSuccessExitCodes(successExitCodes map[string][]int32) string {
+	items := make([]string, 0, len(successExitCodes))
+
+	for containerName, exitCodes := range successExitCodes {
+		formattedExitCodes := make([]string, 0, len(exitCodes))
+
+		for _, exitCode := range exitCodes {
+			formattedExitCodes = append(formattedExitCodes, strconv.Itoa(int(exitCode)))
+		}
+
+		items = append(items, containerName+"="+strings.Join(formattedExitCodes, ";"))
+	}
+
+	sort.Strings(items)
+
+	return strings.Join(items, ",")
+}
+
+// getStepSettings - computes the settings of each container: annotations of the object take precedence
+// over options, container by container.
+func getStepSettings(podSpec corev1.PodSpec, annotations map[string]string,
+	opts options,
+) (map[string]stepSettings, error) {
+	onErrors, errOnErrors := mergeStepValues(opts.stepOnErrors, annotations, onErrorAnnotationKey, ParseStepOnErrors)
+	successExitCodes, errSuccessExitCodes := mergeStepValues(opts.stepSuccessExitCodes, annotations,
+		successExitCodesAnnotationKey, ParseStepSuccessExitCodes)
+	timeouts, errTimeouts := mergeStepValues(opts.stepTimeouts, annotations, timeoutAnnotationKey, ParseStepTimeouts)
+
+	if err := errors.Join(errOnErrors, errSuccessExitCodes, errTimeouts); err != nil {
+		return nil, err
+	}
+
+	containerNames := make(map[string]bool)
+	for _, container := range podSpec.Containers {
+		containerNames[container.Name] = true
+	}
+
+	settings := make(map[string]stepSettings)
+
+	err := errors.Join(
+		applyStepValues(settings, containerNames, "on error", onErrors,
+			func(s *stepSettings, onError OnError) error {
+				s.onError = onError
+
+				return nil
+			}),
+		applyStepValues(settings, containerNames, "timeout", timeouts,
+			func(s *stepSettings, timeout time.Duration) error {
+				if timeout <= 0 {
+					return fmt.Errorf("timeout must be positive, got %s", timeout) //nolint:goerr113
+				}
+
+				s.timeout = timeout
+
+				return nil
+			}),
+		applyStepValues(settings, containerNames, "success exit codes", successExitCodes,
+			func(s *stepSettings, exitCodes []int32) error {
+				s.successExitCodes = exitCodes
+
+				return nil
+			}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// mergeStepValues - merges the values set by options with the ones of the annotation, which take precedence.
+func mergeStepValues[T any](optionValues map[string]T, annotations map[string]string, annotationKey string,
+	parse func(string) (map[string]T, error),
+) (map[string]T, error) {
+	values := make(map[string]T)
+
+	for containerName, value := range optionValues {
+		values[containerName] = value
+	}
+
+	annotation, isSet := annotations[annotationKey]
+	if !isSet {
+		return values, nil
+	}
+
+	annotationValues, err := parse(annotation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: annotation %s: %w", ErrInvalidStepSettings, annotationKey, err)
+	}
+
+	for containerName, value := range annotationValues {
+		values[containerName] = value
+	}
+
+	return values, nil
+}
+
+// applyStepValues - applies values to the settings of each container, checking containers exist.
+func applyStepValues[T any](settings map[string]stepSettings, containerNames map[string]bool, setting string,
+	values map[string]T, apply func(*stepSettings, T) error,
+) error {
+	var err error
+
+	for containerName, value := range values {
+		if !containerNames[containerName] {
+			err = errors.Join(err, fmt.Errorf("%w: %s set for unknown container %s",
+				ErrInvalidStepSettings, setting, containerName))
+
+			continue
+		}
+
+		containerSettings := settings[containerName]
+
+		if errApply := apply(&containerSettings, value); errApply != nil {
+			err = errors.Join(err, fmt.Errorf("%w: container %s: %w", ErrInvalidStepSettings, containerName, errApply))
+
+			continue
+		}
+
+		settings[containerName] = containerSettings
+	}
+
+	return err
+}
+
+// recordStepSettings - records the settings needed by the status helpers in the pod (or pod template) metadata,
+// as they might come from options, or from annotations of objects not propagated to pods (e.g. jobs).
+func recordStepSettings(podObjectMeta *metav1.ObjectMeta, settings map[string]stepSettings) {
+	successExitCodes := make(map[string][]int32)
+
+	for containerName, containerSettings := range settings {
+		if len(containerSettings.successExitCodes) > 0 {
+			successExitCodes[containerName] = containerSettings.successExitCodes
+		}
+	}
+
+	if len(successExitCodes) == 0 {
+		return
+	}
+
+	if podObjectMeta.Annotations == nil {
+		podObjectMeta.Annotations = make(map[string]string)
+	}
+
+	podObjectMeta.Annotations[successExitCodesAnnotationKey] = formatStepSuccessExitCodes(successExitCodes)
+}
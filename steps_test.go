@@ -0,0 +1,167 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ParseStepSuccessExitCodes(t *testing.T) {
+	t.Parallel()
+
+	successExitCodes, err := kueueleuleu.ParseStepSuccessExitCodes("grep=1, diff=1;2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]int32{
+		"grep": {1},
+		"diff": {1, 2},
+	}, successExitCodes)
+
+	_, err = kueueleuleu.ParseStepSuccessExitCodes("grep")
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidStepValues)
+
+	_, err = kueueleuleu.ParseStepSuccessExitCodes("grep=one")
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidStepValues)
+
+	timeouts, err := kueueleuleu.ParseStepTimeouts("build=10m, test=1h30m")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"build": 10 * time.Minute,
+		"test":  90 * time.Minute,
+	}, timeouts)
+
+	_, err = kueueleuleu.ParseStepTimeouts("build=10")
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidStepValues)
+
+	onErrors, err := kueueleuleu.ParseStepOnErrors("cleanup=continue")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]kueueleuleu.OnError{"cleanup": kueueleuleu.OnErrorContinue}, onErrors)
+
+	_, err = kueueleuleu.ParseStepOnErrors("cleanup=ignore")
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidStepValues)
+}
+
+func Test_ConvertPod_onError(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+			Annotations: map[string]string{
+				"norbjd.github.io/kueueleuleu-on-error": "aaa=continue",
+			},
+		},
+		Spec: podSpec,
+	}
+
+	convertedPod, err := kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithStepOnError("aaa", kueueleuleu.OnErrorStopAndFail),
+		kueueleuleu.WithStepSuccessExitCodes("container3", 1, 2),
+	)
+	require.NoError(t, err)
+
+	assert.NotContains(t, convertedPod.Spec.Containers[0].Args, "-on_error")
+	// the annotation takes precedence over options
+	assert.Contains(t, convertedPod.Spec.Containers[1].Args, "-on_error")
+	// success exit codes are checked by a shell, other exit codes still stop the next steps
+	assert.NotContains(t, convertedPod.Spec.Containers[2].Args, "-on_error")
+	assert.Subset(t, convertedPod.Spec.Containers[2].Args, []string{
+		"-entrypoint", "/bin/sh", "--", "-c", "kueueleuleu-success-exit-codes", "stat", "/tmp/volume2/test.txt",
+	})
+	script := convertedPod.Spec.Containers[2].Args[slices.Index(convertedPod.Spec.Containers[2].Args, "-c")+1]
+	assert.Contains(t, script, "case $exitCode in 1|2) ")
+	assert.Equal(t, "container3=1;2", convertedPod.Annotations["norbjd.github.io/kueueleuleu-success-exit-codes"])
+
+	revertedPod, err := kueueleuleu.RevertPod(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, podSpec, revertedPod.Spec)
+
+	_, err = kueueleuleu.ConvertPod(pod, kueueleuleu.WithStepOnError("unknown", kueueleuleu.OnErrorContinue))
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidStepSettings)
+
+	// when continuing on error, exit codes are only checked by the status helpers
+	convertedPod, err = kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithStepOnError("container3", kueueleuleu.OnErrorContinue),
+		kueueleuleu.WithStepSuccessExitCodes("container3", 1),
+	)
+	require.NoError(t, err)
+	assert.Contains(t, convertedPod.Spec.Containers[2].Args, "-on_error")
+	assert.NotContains(t, convertedPod.Spec.Containers[2].Args, "/bin/sh")
+}
+
+func Test_ConvertPod_timeout(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+			Annotations: map[string]string{
+				"norbjd.github.io/kueueleuleu-timeout": "aaa=90s",
+			},
+		},
+		Spec: podSpec,
+	}
+
+	convertedPod, err := kueueleuleu.ConvertPod(pod,
+		kueueleuleu.WithStepTimeout("aaa", time.Hour),
+		kueueleuleu.WithStepTimeout("container3", 10*time.Minute),
+	)
+	require.NoError(t, err)
+
+	assert.NotContains(t, convertedPod.Spec.Containers[0].Args, "-timeout")
+	assert.Subset(t, convertedPod.Spec.Containers[1].Args, []string{"-timeout", "1m30s"})
+	assert.Subset(t, convertedPod.Spec.Containers[2].Args, []string{"-timeout", "10m0s"})
+
+	revertedPod, err := kueueleuleu.RevertPod(convertedPod)
+	require.NoError(t, err)
+	assert.Equal(t, podSpec, revertedPod.Spec)
+
+	_, err = kueueleuleu.ConvertPod(pod, kueueleuleu.WithStepTimeout("container3", -time.Minute))
+	require.ErrorIs(t, err, kueueleuleu.ErrInvalidStepSettings)
+}
+
+func Test_ConvertJob_successExitCodes(t *testing.T) {
+	t.Parallel()
+
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+			Annotations: map[string]string{
+				"norbjd.github.io/kueueleuleu-success-exit-codes": "aaa=1",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: podSpec,
+			},
+		},
+	}
+
+	convertedJob, err := kueueleuleu.ConvertJob(job)
+	require.NoError(t, err)
+
+	// recorded in the pod template, as job annotations are not propagated to pods
+	assert.Equal(t, "aaa=1", convertedJob.Spec.Template.Annotations["norbjd.github.io/kueueleuleu-success-exit-codes"])
+}
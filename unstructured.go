@@ -0,0 +1,248 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/norbjd/kueueleuleu/internal/merge"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var ErrUnsupportedKind = errors.New("unsupported kind")
+
+// ConvertUnstructured - converts a Pod, a Job or a CronJob like ConvertPod, ConvertJob and ConvertCronJob, but only
+// edits the fields changed by the conversion: all other fields, including the ones unknown to the version
+// of the Kubernetes API kueueleuleu is built with (e.g. fields added by newer versions), are kept as is.
+func ConvertUnstructured(object *unstructured.Unstructured, opts ...Option) (*unstructured.Unstructured, error) {
+	return transformUnstructured(object, func(typedObject runtime.Object) (runtime.Object, error) {
+		switch typed := typedObject.(type) {
+		case *corev1.Pod:
+			converted, err := ConvertPod(*typed, opts...)
+
+			return &converted, err
+		case *batchv1.Job:
+			converted, err := ConvertJob(*typed, opts...)
+
+			return &converted, err
+		default:
+			converted, err := ConvertCronJob(*typedObject.(*batchv1.CronJob), opts...) //nolint:forcetypeassert
+
+			return &converted, err
+		}
+	})
+}
+
+// RevertUnstructured - reverts a Pod, a Job or a CronJob like RevertPod, RevertJob and RevertCronJob, but only
+// edits the fields changed by the conversion (see ConvertUnstructured).
+func RevertUnstructured(object *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return transformUnstructured(object, func(typedObject runtime.Object) (runtime.Object, error) {
+		switch typed := typedObject.(type) {
+		case *corev1.Pod:
+			reverted, err := RevertPod(*typed)
+
+			return &reverted, err
+		case *batchv1.Job:
+			reverted, err := RevertJob(*typed)
+
+			return &reverted, err
+		default:
+			reverted, err := RevertCronJob(*typedObject.(*batchv1.CronJob)) //nolint:forcetypeassert
+
+			return &reverted, err
+		}
+	})
+}
+
+func transformUnstructured(object *unstructured.Unstructured,
+	transform func(typedObject runtime.Object) (runtime.Object, error),
+) (*unstructured.Unstructured, error) {
+	var typedObject runtime.Object
+
+	switch gvk := object.GroupVersionKind(); gvk {
+	case corev1.SchemeGroupVersion.WithKind("Pod"):
+		typedObject = &corev1.Pod{}
+	case batchv1.SchemeGroupVersion.WithKind("Job"):
+		typedObject = &batchv1.Job{}
+	case batchv1.SchemeGroupVersion.WithKind("CronJob"):
+		typedObject = &batchv1.CronJob{}
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKind, gvk)
+	}
+
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typedObject)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read object: %w", err)
+	}
+
+	transformed, err := transform(typedObject)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := MergeUnstructured(object.Object, typedObject, transformed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unstructured.Unstructured{Object: merged}, nil
+}
+
+// MergeUnstructured - returns a copy of object, with the changes made between original and transformed (the typed
+// forms of object, before and after a conversion or a revert) applied. Fields of object that are not part
+// of the typed forms, and fields left unchanged, are kept as is.
+// Items of lists are matched by name (e.g. containers, volumes and volume mounts), other lists are replaced.
+func MergeUnstructured(object map[string]interface{}, original, transformed interface{}) (map[string]interface{},
+	error,
+) {
+	before, err := runtime.DefaultUnstructuredConverter.ToUnstructured(original)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read original object: %w", err)
+	}
+
+	after, err := runtime.DefaultUnstructuredConverter.ToUnstructured(transformed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read transformed object: %w", err)
+	}
+
+	merged, _ := deepCopyValue(object).(map[string]interface{})
+
+	err = merge.Merge(unstructuredValue{
+		get: func() interface{} { return merged },
+		set: func(value interface{}) { merged, _ = value.(map[string]interface{}) },
+	}, before, after)
+	if err != nil {
+		return nil, fmt.Errorf("cannot merge transformed object: %w", err)
+	}
+
+	return merged, nil
+}
+
+// unstructuredValue - a value of an unstructured object, edited by merge.Merge.
+type unstructuredValue struct {
+	get func() interface{}
+	set func(value interface{})
+}
+
+func (v unstructuredValue) Mapping() (merge.Mapping, bool) {
+	switch value := v.get().(type) {
+	case nil:
+		mapping := map[string]interface{}{}
+		v.set(mapping)
+
+		return unstructuredMapping(mapping), true
+	case map[string]interface{}:
+		return unstructuredMapping(value), true
+	default:
+		return nil, false
+	}
+}
+
+func (v unstructuredValue) Sequence() (merge.Sequence, bool) {
+	items, isList := v.get().([]interface{})
+	if !isList {
+		return nil, false
+	}
+
+	return unstructuredSequence{items: items, set: v.set}, true
+}
+
+func (v unstructuredValue) Replace(value interface{}) error {
+	v.set(value)
+
+	return nil
+}
+
+type unstructuredMapping map[string]interface{}
+
+func (m unstructuredMapping) Field(key string) merge.Value {
+	return unstructuredValue{
+		get: func() interface{} { return m[key] },
+		set: func(value interface{}) { m[key] = value },
+	}
+}
+
+func (m unstructuredMapping) Remove(key string) {
+	delete(m, key)
+}
+
+func (m unstructuredMapping) Len() int {
+	return len(m)
+}
+
+type unstructuredSequence struct {
+	items []interface{}
+	set   func(value interface{})
+}
+
+func (s unstructuredSequence) Len() int {
+	return len(s.items)
+}
+
+func (s unstructuredSequence) Item(index int) merge.Value {
+	return unstructuredValue{
+		get: func() interface{} { return s.items[index] },
+		set: func(value interface{}) { s.items[index] = value },
+	}
+}
+
+func (s unstructuredSequence) NewItem() merge.Value {
+	var item interface{}
+
+	return unstructuredValue{
+		get: func() interface{} { return item },
+		set: func(value interface{}) { item = value },
+	}
+}
+
+func (s unstructuredSequence) SetItems(items []merge.Value) {
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		values = append(values, item.(unstructuredValue).get()) //nolint:forcetypeassert
+	}
+
+	s.set(values)
+}
+
+// deepCopyValue - copies maps and lists of value. Unlike runtime.DeepCopyJSONValue, it accepts values that are not
+// produced by encoding/json (e.g. int values decoded from YAML).
+func deepCopyValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typedValue))
+
+		for key, field := range typedValue {
+			copied[key] = deepCopyValue(field)
+		}
+
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typedValue))
+
+		for index, item := range typedValue {
+			copied[index] = deepCopyValue(item)
+		}
+
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,147 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"testing"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newerAPIJob - a job with fields unknown to the Kubernetes API kueueleuleu is built with.
+func newerAPIJob() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": "dummy"},
+		"spec": map[string]interface{}{
+			"managedBy": "kueue.x-k8s.io/multikueue",
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "dummy"}},
+				"spec": map[string]interface{}{
+					"initContainers": []interface{}{
+						map[string]interface{}{
+							"name":          "sidecar",
+							"image":         "alpine",
+							"command":       []interface{}{"sleep", "infinity"},
+							"restartPolicy": "Always",
+						},
+					},
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":    "step1",
+							"image":   "alpine",
+							"command": []interface{}{"echo"},
+							"args":    []interface{}{"step1"},
+							"volumeMounts": []interface{}{
+								map[string]interface{}{
+									"name":              "data",
+									"mountPath":         "/data",
+									"readOnly":          true,
+									"recursiveReadOnly": "Enabled",
+								},
+							},
+						},
+						map[string]interface{}{
+							"name":    "step2",
+							"image":   "alpine",
+							"command": []interface{}{"echo"},
+							"args":    []interface{}{"step2"},
+						},
+					},
+					"volumes": []interface{}{
+						map[string]interface{}{
+							"name":  "data",
+							"image": map[string]interface{}{"reference": "registry.example.com/data:1.0.0"},
+						},
+					},
+					"restartPolicy": "Never",
+				},
+			},
+		},
+	}}
+}
+
+func Test_ConvertUnstructured(t *testing.T) {
+	t.Parallel()
+
+	job := newerAPIJob()
+
+	converted, err := kueueleuleu.ConvertUnstructured(job)
+	require.NoError(t, err)
+	assert.Equal(t, newerAPIJob(), job, "the object must not be modified")
+
+	// fields known to the typed form are converted like ConvertJob does
+	var typedJob, typedConverted batchv1.Job
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(job.Object, &typedJob))
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(converted.Object, &typedConverted))
+
+	expected, err := kueueleuleu.ConvertJob(typedJob)
+	require.NoError(t, err)
+	assert.Equal(t, expected, typedConverted)
+
+	// other fields are kept
+	managedBy, _, _ := unstructured.NestedString(converted.Object, "spec", "managedBy")
+	assert.Equal(t, "kueue.x-k8s.io/multikueue", managedBy)
+
+	initContainers, _, _ := unstructured.NestedSlice(converted.Object, "spec", "template", "spec", "initContainers")
+	require.Len(t, initContainers, 2)
+	assert.Equal(t, "Always", initContainers[1].(map[string]interface{})["restartPolicy"])
+
+	containers, _, _ := unstructured.NestedSlice(converted.Object, "spec", "template", "spec", "containers")
+	volumeMounts, _ := containers[0].(map[string]interface{})["volumeMounts"].([]interface{})
+	require.Len(t, volumeMounts, 4)
+	assert.Equal(t, "Enabled", volumeMounts[0].(map[string]interface{})["recursiveReadOnly"])
+
+	volumes, _, _ := unstructured.NestedSlice(converted.Object, "spec", "template", "spec", "volumes")
+	assert.Contains(t, volumes[0], "image")
+
+	_, hasCreationTimestamp := converted.Object["metadata"].(map[string]interface{})["creationTimestamp"]
+	assert.False(t, hasCreationTimestamp, "defaults of the typed form must not be added")
+}
+
+func Test_RevertUnstructured(t *testing.T) {
+	t.Parallel()
+
+	converted, err := kueueleuleu.ConvertUnstructured(newerAPIJob())
+	require.NoError(t, err)
+
+	reverted, err := kueueleuleu.RevertUnstructured(converted)
+	require.NoError(t, err)
+	assert.Equal(t, newerAPIJob(), reverted)
+}
+
+func Test_ConvertUnstructured_unsupportedKind(t *testing.T) {
+	t.Parallel()
+
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "dummy"},
+	}}
+
+	_, err := kueueleuleu.ConvertUnstructured(configMap)
+	require.ErrorIs(t, err, kueueleuleu.ErrUnsupportedKind)
+
+	_, err = kueueleuleu.RevertUnstructured(configMap)
+	require.ErrorIs(t, err, kueueleuleu.ErrUnsupportedKind)
+}
@@ -19,7 +19,6 @@ package kueueleuleu
 import (
 	"errors"
 	"fmt"
-	"sort"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,6 +30,7 @@ var (
 	ErrPodIsFailed                      = errors.New("pod is failed")
 	ErrPodIsNotRunning                  = errors.New("pod is not running")
 	ErrSentinelAllContainersAreFinished = errors.New("all containers are finished")
+	ErrSentinelNoContainerIsRunning     = errors.New("no container is running")
 )
 
 func IsKueueleuleu(meta metav1.ObjectMeta) bool {
@@ -40,6 +40,11 @@ func IsKueueleuleu(meta metav1.ObjectMeta) bool {
 		annotations[kueueleuleuAnnotationKey] == kueueleuleuAnnotationValue
 }
 
+// GetRunningContainerName - returns the name of the container really running: either a user init container,
+// or the step whose previous step has finished (see GetStepStatuses). Steps waiting for the previous step
+// are not considered running, even if their container is. If no container is running (e.g. the init container
+// copying the tekton entrypoint is running, or images are being pulled), ErrSentinelNoContainerIsRunning
+// is returned: previous versions returned the first step instead.
 func GetRunningContainerName(pod corev1.Pod) (string, error) {
 	if !IsKueueleuleu(pod.ObjectMeta) {
 		return "", ErrNotAKueueleuleuPod
@@ -50,21 +55,65 @@ func GetRunningContainerName(pod corev1.Pod) (string, error) {
 		return "", err
 	}
 
-	allContainerStatusesSorted := getContainerStatusesSorted(pod)
+	initContainerStatuses := make(map[string]corev1.ContainerStatus, len(pod.Status.InitContainerStatuses))
+	for _, initContainerStatus := range pod.Status.InitContainerStatuses {
+		initContainerStatuses[initContainerStatus.Name] = initContainerStatus
+	}
+
+	// init containers run one after the other, before steps
+	for _, initContainer := range pod.Spec.InitContainers {
+		initContainerStatus := initContainerStatuses[initContainer.Name]
 
-	for _, containerStatus := range allContainerStatusesSorted {
-		if containerStatus.Name == prepareInitContainerName {
+		if initContainerStatus.State.Terminated != nil && initContainerStatus.State.Terminated.ExitCode == 0 {
 			continue
 		}
 
-		containerName := containerStatus.Name
+		if initContainerStatus.State.Running != nil && initContainer.Name != prepareInitContainerName {
+			return initContainer.Name, nil
+		}
+
+		return "", ErrSentinelNoContainerIsRunning
+	}
 
-		if containerStatus.State.Terminated == nil || containerStatus.State.Terminated.FinishedAt.IsZero() {
-			return containerName, nil
+	stepStatuses, err := GetStepStatuses(pod)
+	if err != nil {
+		return "", err
+	}
+
+	allStepsAreFinished := true
+
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.State == StepRunning {
+			return stepStatus.Name, nil
 		}
+
+		allStepsAreFinished = allStepsAreFinished && stepStatus.State.IsFinished()
 	}
 
-	return "", ErrSentinelAllContainersAreFinished
+	if allStepsAreFinished {
+		return "", ErrSentinelAllContainersAreFinished
+	}
+
+	return "", ErrSentinelNoContainerIsRunning
+}
+
+// GetWaitingContainerNames - returns the names of the steps that have not started yet, in the order containers are
+// declared: steps waiting for the previous step to finish, or for the pod to start (see GetStepStatuses).
+func GetWaitingContainerNames(pod corev1.Pod) ([]string, error) {
+	stepStatuses, err := GetStepStatuses(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	waitingContainerNames := make([]string, 0, len(stepStatuses))
+
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.State == StepWaiting {
+			waitingContainerNames = append(waitingContainerNames, stepStatus.Name)
+		}
+	}
+
+	return waitingContainerNames, nil
 }
 
 func checkPodPhaseIsValid(podPhase corev1.PodPhase) error {
@@ -82,31 +131,3 @@ func checkPodPhaseIsValid(podPhase corev1.PodPhase) error {
 		return fmt.Errorf("%w: got phase %s", ErrPodIsNotRunning, podPhase)
 	}
 }
-
-// getContainerStatusesSorted - sort container statuses according to the containers orders
-// by default, containers statuses are sorted by name (alphabetically)
-// and not by the order containers are declared in the pod spec.
-func getContainerStatusesSorted(pod corev1.Pod) []corev1.ContainerStatus {
-	allContainers := pod.Spec.InitContainers
-	allContainers = append(allContainers, pod.Spec.Containers...)
-	allContainerNamesAndOrder := make(map[string]int)
-
-	for i, container := range allContainers {
-		allContainerNamesAndOrder[container.Name] = i
-	}
-
-	// unfortunately, container statuses are not sorted...
-	sort.Slice(pod.Status.InitContainerStatuses, func(i, j int) bool {
-		return allContainerNamesAndOrder[pod.Status.InitContainerStatuses[i].Name] <
-			allContainerNamesAndOrder[pod.Status.InitContainerStatuses[j].Name]
-	})
-	sort.Slice(pod.Status.ContainerStatuses, func(i, j int) bool {
-		return allContainerNamesAndOrder[pod.Status.ContainerStatuses[i].Name] <
-			allContainerNamesAndOrder[pod.Status.ContainerStatuses[j].Name]
-	})
-
-	allContainerStatusesSorted := pod.Status.InitContainerStatuses
-	allContainerStatusesSorted = append(allContainerStatusesSorted, pod.Status.ContainerStatuses...)
-
-	return allContainerStatusesSorted
-}
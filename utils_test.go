@@ -0,0 +1,155 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//nolint:funlen
+func Test_GetRunningContainerName(t *testing.T) {
+	t.Parallel()
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "dummy",
+		},
+		Spec: podSpec,
+	}
+
+	convertedPod, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	convertedPod.Status.Phase = corev1.PodPending
+
+	podStartedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	restartedAt := metav1.NewTime(time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC))
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: podStartedAt}}
+	podInitializing := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}
+	terminated := terminatedState(0, "", podStartedAt)
+
+	tests := []struct {
+		name                          string
+		initContainerStatuses         []corev1.ContainerStatus
+		containerStatuses             []corev1.ContainerStatus
+		expectedRunningContainerName  string
+		expectedError                 error
+		expectedWaitingContainerNames []string
+	}{
+		{
+			name: "prepare init container is running",
+			initContainerStatuses: []corev1.ContainerStatus{
+				{Name: "kueueleuleu-prepare", State: running},
+				{Name: "dummy-init-container", State: podInitializing},
+			},
+			expectedError:                 kueueleuleu.ErrSentinelNoContainerIsRunning,
+			expectedWaitingContainerNames: []string{"container1", "aaa", "container3"},
+		},
+		{
+			name: "user init container is running",
+			initContainerStatuses: []corev1.ContainerStatus{
+				{Name: "dummy-init-container", State: running},
+				{Name: "kueueleuleu-prepare", State: terminated},
+			},
+			containerStatuses: []corev1.ContainerStatus{
+				{Name: "container1", State: podInitializing},
+				{Name: "aaa", State: podInitializing},
+				{Name: "container3", State: podInitializing},
+			},
+			expectedRunningContainerName:  "dummy-init-container",
+			expectedWaitingContainerNames: []string{"container1", "aaa", "container3"},
+		},
+		{
+			name: "all containers are running, statuses are not in order",
+			initContainerStatuses: []corev1.ContainerStatus{
+				{Name: "dummy-init-container", State: terminated},
+				{Name: "kueueleuleu-prepare", State: terminated},
+			},
+			containerStatuses: []corev1.ContainerStatus{
+				{Name: "container3", State: running},
+				{Name: "aaa", State: running},
+				{Name: "container1", State: running},
+			},
+			expectedRunningContainerName:  "container1",
+			expectedWaitingContainerNames: []string{"aaa", "container3"},
+		},
+		{
+			name: "second step has restarted",
+			initContainerStatuses: []corev1.ContainerStatus{
+				{Name: "kueueleuleu-prepare", State: terminated},
+				{Name: "dummy-init-container", State: terminated},
+			},
+			containerStatuses: []corev1.ContainerStatus{
+				{Name: "container1", State: terminated},
+				{
+					Name:         "aaa",
+					State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: restartedAt}},
+					RestartCount: 1,
+				},
+				{Name: "container3", State: running},
+			},
+			expectedRunningContainerName:  "aaa",
+			expectedWaitingContainerNames: []string{"container3"},
+		},
+		{
+			name: "all steps are finished",
+			initContainerStatuses: []corev1.ContainerStatus{
+				{Name: "kueueleuleu-prepare", State: terminated},
+				{Name: "dummy-init-container", State: terminated},
+			},
+			containerStatuses: []corev1.ContainerStatus{
+				{Name: "container1", State: terminated},
+				{Name: "aaa", State: terminated},
+				{Name: "container3", State: terminated},
+			},
+			expectedError:                 kueueleuleu.ErrSentinelAllContainersAreFinished,
+			expectedWaitingContainerNames: []string{},
+		},
+	}
+
+	for _, testCase := range tests {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			pod := *convertedPod.DeepCopy()
+			pod.Status.InitContainerStatuses = testCase.initContainerStatuses
+			pod.Status.ContainerStatuses = testCase.containerStatuses
+
+			runningContainerName, err := kueueleuleu.GetRunningContainerName(pod)
+			if testCase.expectedError != nil {
+				require.ErrorIs(t, err, testCase.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, testCase.expectedRunningContainerName, runningContainerName)
+
+			waitingContainerNames, err := kueueleuleu.GetWaitingContainerNames(pod)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedWaitingContainerNames, waitingContainerNames)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WaitOption - customizes WaitForCompletion.
+type WaitOption func(*waitOptions)
+
+type waitOptions struct {
+	onStepEvent  func(StepEvent)
+	untilStep    string
+	watchOptions []WatchOption
+}
+
+// WithStepEventHandler - calls handler on each step transition (see WatchSteps), including the PodFinished event.
+// The handler is called synchronously: waiting goes on when it returns.
+func WithStepEventHandler(handler func(StepEvent)) WaitOption {
+	return func(o *waitOptions) {
+		o.onStepEvent = handler
+	}
+}
+
+// WithUntilStepFinished - stops waiting as soon as the step is finished (or skipped), instead of waiting
+// for the pod to finish.
+func WithUntilStepFinished(stepName string) WaitOption {
+	return func(o *waitOptions) {
+		o.untilStep = stepName
+	}
+}
+
+// WithWatchOptions - sets the options used to watch the pod (see WatchSteps).
+func WithWatchOptions(opts ...WatchOption) WaitOption {
+	return func(o *waitOptions) {
+		o.watchOptions = append(o.watchOptions, opts...)
+	}
+}
+
+// Completion - the outcome of a kueueleuleu pod, see WaitForCompletion.
+type Completion struct {
+	// Steps - the status of every step, when waiting stopped.
+	Steps []StepStatus
+	// FailedStep - the first step that has failed or timed out (stopping the next steps), nil if there is none.
+	// Steps failing with OnErrorContinue (StepFailedContinued) are not considered as failing.
+	FailedStep *StepStatus
+	// Pod - the pod when waiting stopped.
+	Pod *corev1.Pod
+}
+
+// Succeeded - whether the pod has succeeded.
+func (c Completion) Succeeded() bool {
+	return c.Pod != nil && c.Pod.Status.Phase == corev1.PodSucceeded
+}
+
+// WaitForCompletion - waits until the kueueleuleu pod namespace/name has succeeded or failed (or until the step
+// set with WithUntilStepFinished is finished), and returns the final status of its steps. An error is returned
+// if the pod is deleted, or when ctx is done: use context.WithTimeout to wait for a limited time.
+func WaitForCompletion(ctx context.Context, client kubernetes.Interface, namespace, name string,
+	opts ...WaitOption,
+) (Completion, error) {
+	options := waitOptions{}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for event := range WatchSteps(ctx, client, namespace, name, options.watchOptions...) {
+		if event.Type == StepEventError {
+			return Completion{}, fmt.Errorf("cannot wait for pod %s/%s: %w", namespace, name, event.Err)
+		}
+
+		if options.onStepEvent != nil {
+			options.onStepEvent(event)
+		}
+
+		completion, err := newCompletion(event.Pod)
+		if err != nil {
+			return Completion{}, err
+		}
+
+		if options.untilStep != "" && !hasStep(completion.Steps, options.untilStep) {
+			return Completion{}, fmt.Errorf("%w: %s", ErrStepNotFound, options.untilStep)
+		}
+
+		if event.Type == StepEventPodFinished ||
+			(event.Step.Name == options.untilStep && event.Step.State.IsFinished()) {
+			return completion, nil
+		}
+	}
+
+	return Completion{}, fmt.Errorf("cannot wait for pod %s/%s: %w", namespace, name, context.Cause(ctx))
+}
+
+func newCompletion(pod *corev1.Pod) (Completion, error) {
+	stepStatuses, err := GetStepStatuses(*pod)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	completion := Completion{
+		Steps: stepStatuses,
+		Pod:   pod,
+	}
+
+	for i, stepStatus := range stepStatuses {
+		if stepStatus.State == StepFailed || stepStatus.State == StepTimedOut {
+			completion.FailedStep = &completion.Steps[i]
+
+			break
+		}
+	}
+
+	return completion, nil
+}
+
+func hasStep(stepStatuses []StepStatus, name string) bool {
+	for _, stepStatus := range stepStatuses {
+		if stepStatus.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,198 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_WaitForCompletion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "waited",
+			Namespace: "default",
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: at}}
+
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container1", State: terminatedState(0, "", at)},
+		{Name: "aaa", State: running},
+		{Name: "container3", State: running},
+	}
+
+	client, watchStarted := newWatchedClientset(t, &pod)
+
+	eventTypes := make([]kueueleuleu.StepEventType, 0)
+
+	var (
+		completion    kueueleuleu.Completion
+		errCompletion error
+	)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		completion, errCompletion = kueueleuleu.WaitForCompletion(ctx, client, "default", "waited",
+			kueueleuleu.WithStepEventHandler(func(event kueueleuleu.StepEvent) {
+				eventTypes = append(eventTypes, event.Type)
+			}))
+	}()
+
+	waitFor(t, watchStarted)
+
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container1", State: terminatedState(0, "", at)},
+		{Name: "aaa", State: terminatedState(1, `[{"key":"Reason","value":"TimeoutExceeded","type":3}]`, at)},
+		{Name: "container3", State: terminatedState(1, "", at)},
+	}
+
+	_, err = client.CoreV1().Pods("default").UpdateStatus(ctx, &pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	waitFor(t, done)
+
+	require.NoError(t, errCompletion)
+	assert.False(t, completion.Succeeded())
+	require.NotNil(t, completion.FailedStep)
+	assert.Equal(t, "aaa", completion.FailedStep.Name)
+	assert.Equal(t, kueueleuleu.StepTimedOut, completion.FailedStep.State)
+	require.Len(t, completion.Steps, 3)
+	assert.Equal(t, kueueleuleu.StepSkipped, completion.Steps[2].State)
+	assert.Equal(t, []kueueleuleu.StepEventType{
+		kueueleuleu.StepEventStarted,
+		kueueleuleu.StepEventFinished,
+		kueueleuleu.StepEventStarted,
+		kueueleuleu.StepEventFinished,
+		kueueleuleu.StepEventSkipped,
+		kueueleuleu.StepEventPodFinished,
+	}, eventTypes)
+}
+
+func Test_WaitForCompletion_succeeded(t *testing.T) {
+	t.Parallel()
+
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "succeeded",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"norbjd.github.io/kueueleuleu-on-error": "container1=continue",
+			},
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container1", State: terminatedState(0, `[{"key":"ExitCode","value":"3","type":3}]`, at)},
+		{Name: "aaa", State: terminatedState(0, "", at)},
+		{Name: "container3", State: terminatedState(0, "", at)},
+	}
+
+	client, _ := newWatchedClientset(t, &pod)
+
+	completion, err := kueueleuleu.WaitForCompletion(context.Background(), client, "default", "succeeded")
+	require.NoError(t, err)
+
+	assert.True(t, completion.Succeeded())
+	// failing steps continued are not considered as failing
+	assert.Nil(t, completion.FailedStep)
+	assert.Equal(t, kueueleuleu.StepFailedContinued, completion.Steps[0].State)
+}
+
+func Test_WaitForCompletion_untilStepFinished(t *testing.T) {
+	t.Parallel()
+
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	pod := runningPod(t, "until", nil)
+
+	client, _ := newWatchedClientset(t, pod)
+
+	completion, err := kueueleuleu.WaitForCompletion(context.Background(), client, "default", "until",
+		kueueleuleu.WithUntilStepFinished("container1"))
+	require.NoError(t, err)
+
+	assert.False(t, completion.Succeeded())
+	assert.Nil(t, completion.FailedStep)
+	assert.Equal(t, kueueleuleu.StepStatus{
+		Name:       "container1",
+		State:      kueueleuleu.StepSucceeded,
+		StartedAt:  metav1.Time{},
+		FinishedAt: at,
+	}, completion.Steps[0])
+	assert.Equal(t, kueueleuleu.StepRunning, completion.Steps[1].State)
+
+	_, err = kueueleuleu.WaitForCompletion(context.Background(), client, "default", "until",
+		kueueleuleu.WithUntilStepFinished("unknown"))
+	require.ErrorIs(t, err, kueueleuleu.ErrStepNotFound)
+}
+
+func Test_WaitForCompletion_errors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+
+		client, _ := newWatchedClientset(t, runningPod(t, "running", nil))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := kueueleuleu.WaitForCompletion(ctx, client, "default", "running")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("not a kueueleuleu pod", func(t *testing.T) {
+		t.Parallel()
+
+		client, _ := newWatchedClientset(t, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "not-kueueleuleu",
+				Namespace: "default",
+			},
+			Spec: podSpec,
+		})
+
+		_, err := kueueleuleu.WaitForCompletion(context.Background(), client, "default", "not-kueueleuleu")
+		require.ErrorIs(t, err, kueueleuleu.ErrNotAKueueleuleuPod)
+	})
+}
@@ -0,0 +1,232 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const defaultWatchResyncPeriod = 30 * time.Second
+
+var ErrPodDeleted = errors.New("pod was deleted")
+
+// StepEventType - the type of a StepEvent.
+type StepEventType string
+
+const (
+	// StepEventStarted - a step has started.
+	StepEventStarted StepEventType = "Started"
+	// StepEventFinished - a step has finished (succeeded, failed, failed but continued, or timed out).
+	StepEventFinished StepEventType = "Finished"
+	// StepEventSkipped - a step was skipped because a previous step has failed.
+	StepEventSkipped StepEventType = "Skipped"
+	// StepEventPodFinished - the pod has succeeded or failed. This is the last event.
+	StepEventPodFinished StepEventType = "PodFinished"
+	// StepEventError - watching the pod failed (e.g. it was deleted, or it is not a kueueleuleu pod).
+	// This is the last event.
+	StepEventError StepEventType = "Error"
+)
+
+// StepEvent - a step transition, see WatchSteps.
+type StepEvent struct {
+	Type StepEventType
+	// Step - the status of the step, for Started, Finished and Skipped events.
+	Step StepStatus
+	// Pod - the pod when the event happened. It must not be modified.
+	Pod *corev1.Pod
+	// Err - the error, for Error events.
+	Err error
+}
+
+// WatchOption - customizes WatchSteps.
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	resyncPeriod time.Duration
+}
+
+// WithResyncPeriod - sets how often the pod is checked again, even without changes (default: 30 seconds).
+func WithResyncPeriod(resyncPeriod time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.resyncPeriod = resyncPeriod
+	}
+}
+
+// podUpdate - a pod received by the informer, or nil if it was deleted.
+type podUpdate struct {
+	pod *corev1.Pod
+}
+
+// WatchSteps - watches the kueueleuleu pod namespace/name, and streams its steps transitions, in the order
+// containers are declared, until the pod finishes. If the pod does not exist yet, events start when it is created.
+// If steps already started or finished when watching starts, the corresponding events are sent first.
+// Reconnections are handled transparently. The channel is closed after a PodFinished or an Error event,
+// or when ctx is done.
+func WatchSteps(ctx context.Context, client kubernetes.Interface, namespace, name string,
+	opts ...WatchOption,
+) <-chan StepEvent {
+	options := watchOptions{
+		resyncPeriod: defaultWatchResyncPeriod,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	informer := coreinformers.NewFilteredPodInformer(client, namespace, options.resyncPeriod, cache.Indexers{},
+		func(listOptions *metav1.ListOptions) {
+			listOptions.FieldSelector = fields.OneTermEqualSelector(metav1.ObjectNameField, name).String()
+		})
+
+	updates := make(chan podUpdate)
+	stop := make(chan struct{})
+
+	send := func(update podUpdate) {
+		select {
+		case updates <- update:
+		case <-stop:
+		}
+	}
+
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, isPod := obj.(*corev1.Pod); isPod && pod.Name == name {
+				send(podUpdate{pod: pod})
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if pod, isPod := obj.(*corev1.Pod); isPod && pod.Name == name {
+				send(podUpdate{pod: pod})
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown); isTombstone {
+				obj = tombstone.Obj
+			}
+
+			if pod, isPod := obj.(*corev1.Pod); isPod && pod.Name == name {
+				send(podUpdate{pod: nil})
+			}
+		},
+	})
+
+	events := make(chan StepEvent)
+
+	go informer.Run(stop)
+
+	go func() {
+		defer close(events)
+		defer close(stop)
+
+		watcher := stepsWatcher{}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updates:
+				for _, event := range watcher.next(update) {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+
+					if event.Type == StepEventPodFinished || event.Type == StepEventError {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+// stepsWatcher - computes steps transitions between successive versions of a pod.
+type stepsWatcher struct {
+	lastStepStatuses map[string]StepStatus
+}
+
+func (w *stepsWatcher) next(update podUpdate) []StepEvent {
+	if update.pod == nil {
+		return []StepEvent{{Type: StepEventError, Err: ErrPodDeleted}}
+	}
+
+	pod := update.pod
+
+	stepStatuses, err := GetStepStatuses(*pod)
+	if err != nil {
+		return []StepEvent{{Type: StepEventError, Pod: pod, Err: fmt.Errorf("cannot get steps statuses: %w", err)}}
+	}
+
+	if w.lastStepStatuses == nil {
+		w.lastStepStatuses = make(map[string]StepStatus)
+	}
+
+	events := make([]StepEvent, 0)
+
+	for _, stepStatus := range stepStatuses {
+		lastState := w.lastStepStatuses[stepStatus.Name].State
+		if lastState == "" {
+			lastState = StepWaiting
+		}
+
+		w.lastStepStatuses[stepStatus.Name] = stepStatus
+
+		if lastState == stepStatus.State || lastState.IsFinished() {
+			continue
+		}
+
+		if stepStatus.State == StepSkipped {
+			events = append(events, StepEvent{Type: StepEventSkipped, Step: stepStatus, Pod: pod})
+
+			continue
+		}
+
+		// steps might finish between two versions of the pod: they have started anyway
+		if lastState == StepWaiting && stepStatus.State != StepWaiting {
+			startedStepStatus := stepStatus
+			startedStepStatus.State = StepRunning
+			startedStepStatus.ExitCode = 0
+			startedStepStatus.FinishedAt = metav1.Time{}
+			startedStepStatus.Reason = ""
+
+			events = append(events, StepEvent{Type: StepEventStarted, Step: startedStepStatus, Pod: pod})
+		}
+
+		if stepStatus.State.IsFinished() {
+			events = append(events, StepEvent{Type: StepEventFinished, Step: stepStatus, Pod: pod})
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		events = append(events, StepEvent{Type: StepEventPodFinished, Pod: pod})
+	}
+
+	return events
+}
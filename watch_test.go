@@ -0,0 +1,300 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kueueleuleu_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const watchTestTimeout = 5 * time.Second
+
+// newWatchedClientset - a fake clientset, and a channel closed when the pods watch is established.
+// The fake clientset does not replay changes done between the list and the watch, so tests must wait
+// for the watch before updating pods.
+func newWatchedClientset(t *testing.T, pods ...*corev1.Pod) (*fake.Clientset, <-chan struct{}) {
+	t.Helper()
+
+	objects := make([]runtime.Object, 0, len(pods))
+	for _, pod := range pods {
+		objects = append(objects, pod)
+	}
+
+	client := fake.NewSimpleClientset(objects...)
+
+	watchStarted := make(chan struct{})
+
+	var once sync.Once
+
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		watcher, err := client.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return false, nil, err //nolint:wrapcheck
+		}
+
+		once.Do(func() { close(watchStarted) })
+
+		return true, watcher, nil
+	})
+
+	return client, watchStarted
+}
+
+func waitFor(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-done:
+	case <-time.After(watchTestTimeout):
+		require.FailNow(t, "timed out")
+	}
+}
+
+// receiveEvents - receives n events, and returns a summary of each one: "<type> <step> <state> <exit code>".
+func receiveEvents(t *testing.T, events <-chan kueueleuleu.StepEvent, n int) []string {
+	t.Helper()
+
+	received := make([]string, 0, n)
+
+	for len(received) < n {
+		select {
+		case event, open := <-events:
+			require.True(t, open, "channel closed, received: %v", received)
+
+			if event.Type == kueueleuleu.StepEventError {
+				received = append(received, string(event.Type)+" "+event.Err.Error())
+
+				continue
+			}
+
+			received = append(received, fmt.Sprintf("%s %s %s %d",
+				event.Type, event.Step.Name, event.Step.State, event.Step.ExitCode))
+		case <-time.After(watchTestTimeout):
+			require.FailNow(t, "timed out", "received: %v", received)
+		}
+	}
+
+	return received
+}
+
+func requireClosed(t *testing.T, events <-chan kueueleuleu.StepEvent) {
+	t.Helper()
+
+	select {
+	case event, open := <-events:
+		require.False(t, open, "unexpected event %+v", event)
+	case <-time.After(watchTestTimeout):
+		require.FailNow(t, "timed out")
+	}
+}
+
+func Test_WatchSteps(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watched",
+			Namespace: "default",
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	otherPod := pod.DeepCopy()
+	otherPod.Name = "other"
+
+	client, watchStarted := newWatchedClientset(t, &pod, otherPod)
+
+	events := kueueleuleu.WatchSteps(ctx, client, "default", "watched")
+
+	waitFor(t, watchStarted)
+
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: at}}
+
+	updateStatus := func(pod *corev1.Pod, phase corev1.PodPhase, containerStatuses ...corev1.ContainerStatus) {
+		t.Helper()
+
+		pod.Status.Phase = phase
+		pod.Status.ContainerStatuses = containerStatuses
+
+		_, err := client.CoreV1().Pods("default").UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	updateStatus(&pod, corev1.PodRunning,
+		corev1.ContainerStatus{Name: "container1", State: running},
+		corev1.ContainerStatus{Name: "aaa", State: running},
+		corev1.ContainerStatus{Name: "container3", State: running},
+	)
+
+	assert.Equal(t, []string{
+		"Started container1 Running 0",
+	}, receiveEvents(t, events, 1))
+
+	// changes of other pods are ignored
+	updateStatus(otherPod, corev1.PodFailed,
+		corev1.ContainerStatus{Name: "container1", State: terminatedState(1, "", at)},
+	)
+
+	updateStatus(&pod, corev1.PodRunning,
+		corev1.ContainerStatus{Name: "container1", State: terminatedState(0, "", at)},
+		corev1.ContainerStatus{Name: "aaa", State: running},
+		corev1.ContainerStatus{Name: "container3", State: running},
+	)
+
+	assert.Equal(t, []string{
+		"Finished container1 Succeeded 0",
+		"Started aaa Running 0",
+	}, receiveEvents(t, events, 2))
+
+	updateStatus(&pod, corev1.PodFailed,
+		corev1.ContainerStatus{Name: "container1", State: terminatedState(0, "", at)},
+		corev1.ContainerStatus{Name: "aaa", State: terminatedState(2, "", at)},
+		corev1.ContainerStatus{Name: "container3", State: terminatedState(1, "", at)},
+	)
+
+	assert.Equal(t, []string{
+		"Finished aaa Failed 2",
+		"Skipped container3 Skipped 1",
+		"PodFinished   0",
+	}, receiveEvents(t, events, 3))
+
+	requireClosed(t, events)
+}
+
+func Test_WatchSteps_alreadyFinished(t *testing.T) {
+	t.Parallel()
+
+	at := metav1.NewTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "finished",
+			Namespace: "default",
+		},
+		Spec: podSpec,
+	})
+	require.NoError(t, err)
+
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "container1", State: terminatedState(0, "", at)},
+		{Name: "aaa", State: terminatedState(0, "", at)},
+		{Name: "container3", State: terminatedState(0, "", at)},
+	}
+
+	client, _ := newWatchedClientset(t, &pod)
+
+	events := kueueleuleu.WatchSteps(context.Background(), client, "default", "finished")
+
+	// steps finished before watching starts are reported as started, then finished
+	assert.Equal(t, []string{
+		"Started container1 Running 0",
+		"Finished container1 Succeeded 0",
+		"Started aaa Running 0",
+		"Finished aaa Succeeded 0",
+		"Started container3 Running 0",
+		"Finished container3 Succeeded 0",
+		"PodFinished   0",
+	}, receiveEvents(t, events, 7))
+
+	requireClosed(t, events)
+}
+
+func Test_WatchSteps_errors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("pod deleted", func(t *testing.T) {
+		t.Parallel()
+
+		pod, err := kueueleuleu.ConvertPod(corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "deleted",
+				Namespace: "default",
+			},
+			Spec: podSpec,
+		})
+		require.NoError(t, err)
+
+		client, watchStarted := newWatchedClientset(t, &pod)
+
+		events := kueueleuleu.WatchSteps(ctx, client, "default", "deleted")
+
+		waitFor(t, watchStarted)
+
+		require.NoError(t, client.CoreV1().Pods("default").Delete(ctx, "deleted", metav1.DeleteOptions{}))
+
+		assert.Equal(t, []string{
+			"Error " + kueueleuleu.ErrPodDeleted.Error(),
+		}, receiveEvents(t, events, 1))
+
+		requireClosed(t, events)
+	})
+
+	t.Run("not a kueueleuleu pod", func(t *testing.T) {
+		t.Parallel()
+
+		client, _ := newWatchedClientset(t, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "not-kueueleuleu",
+				Namespace: "default",
+			},
+			Spec: podSpec,
+		})
+
+		events := kueueleuleu.WatchSteps(ctx, client, "default", "not-kueueleuleu")
+
+		assert.Equal(t, []string{
+			"Error cannot get steps statuses: " + kueueleuleu.ErrNotAKueueleuleuPod.Error(),
+		}, receiveEvents(t, events, 1))
+
+		requireClosed(t, events)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		t.Parallel()
+
+		client, watchStarted := newWatchedClientset(t)
+
+		ctx, cancel := context.WithCancel(ctx)
+
+		events := kueueleuleu.WatchSteps(ctx, client, "default", "not-created-yet")
+
+		waitFor(t, watchStarted)
+		cancel()
+
+		requireClosed(t, events)
+	})
+}
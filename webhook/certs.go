@@ -0,0 +1,186 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// clockSkew - certificates are valid a bit before they are generated, in case clocks are not synchronized.
+const clockSkew = time.Hour
+
+var ErrInvalidCertificates = errors.New("invalid certificates")
+
+// certificates - a self-signed CA bundle (the current CA first, possibly followed by the previous one), and
+// the webhook server certificate and key signed by the current CA, PEM-encoded.
+type certificates struct {
+	caBundle []byte
+	cert     []byte
+	key      []byte
+}
+
+// dnsNames - the names of the webhook service, used by the API server to reach the webhook.
+func dnsNames(serviceName, namespace string) []string {
+	return []string{
+		serviceName,
+		serviceName + "." + namespace,
+		serviceName + "." + namespace + ".svc",
+		serviceName + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// generateCertificates - generates a CA and a server certificate for the webhook service, valid from now
+// for the given duration. previousCABundle, if any, is kept in the CA bundle: the API server can still reach
+// webhook replicas serving the previous certificate until they load the new one.
+func generateCertificates(serviceName, namespace string, now time.Time, validity time.Duration,
+	previousCABundle []byte,
+) (certificates, error) {
+	notBefore := now.Add(-clockSkew)
+	notAfter := now.Add(validity)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return certificates{}, fmt.Errorf("cannot generate CA key: %w", err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          randomSerialNumber(),
+		Subject:               pkix.Name{CommonName: "kueueleuleu-webhook-ca"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return certificates{}, fmt.Errorf("cannot create CA certificate: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return certificates{}, fmt.Errorf("cannot generate server key: %w", err)
+	}
+
+	names := dnsNames(serviceName, namespace)
+
+	template := &x509.Certificate{
+		SerialNumber: randomSerialNumber(),
+		Subject:      pkix.Name{CommonName: names[2]},
+		DNSNames:     names,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return certificates{}, fmt.Errorf("cannot parse CA certificate: %w", err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return certificates{}, fmt.Errorf("cannot create server certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return certificates{}, fmt.Errorf("cannot marshal server key: %w", err)
+	}
+
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	if previousCA := firstPEMBlock(previousCABundle); previousCA != nil {
+		caBundle = append(caBundle, pem.EncodeToMemory(previousCA)...)
+	}
+
+	return certificates{
+		caBundle: caBundle,
+		cert:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+func randomSerialNumber() *big.Int {
+	//nolint:gomnd
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+
+	return serialNumber
+}
+
+func firstPEMBlock(data []byte) *pem.Block {
+	block, _ := pem.Decode(data)
+
+	return block
+}
+
+// check - returns the server certificate, or an error if the certificates are invalid at now, or if the server
+// certificate expires within renewBefore, or was not issued for the webhook service.
+func (c certificates) check(serviceName, namespace string, now time.Time, renewBefore time.Duration,
+) (*tls.Certificate, error) {
+	certificate, err := tls.X509KeyPair(c.cert, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificates, err)
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificates, err)
+	}
+
+	if leaf.NotAfter.Before(now.Add(renewBefore)) {
+		return nil, fmt.Errorf("%w: certificate expires at %s", ErrInvalidCertificates, leaf.NotAfter)
+	}
+
+	if !slices.Equal(leaf.DNSNames, dnsNames(serviceName, namespace)) {
+		return nil, fmt.Errorf("%w: certificate was issued for %v", ErrInvalidCertificates, leaf.DNSNames)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(c.caBundle) {
+		return nil, fmt.Errorf("%w: invalid CA bundle", ErrInvalidCertificates)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		DNSName:     dnsNames(serviceName, namespace)[2],
+		CurrentTime: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificates, err)
+	}
+
+	certificate.Leaf = leaf
+
+	return &certificate, nil
+}
@@ -0,0 +1,274 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/norbjd/kueueleuleu"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PolicyConfigMapKey - the key of the policy in the ConfigMaps read by a ConfigMapPolicySource.
+const PolicyConfigMapKey = "policy.yaml"
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// PolicyMode - which objects are converted.
+type PolicyMode string
+
+const (
+	// PolicyModeOptIn - only objects labelled with OptInKey: "true" are converted (default).
+	PolicyModeOptIn PolicyMode = "opt-in"
+	// PolicyModeOptOut - all objects are converted, except those labelled with OptInKey: "false".
+	// Note that the MutatingWebhookConfiguration must send objects that are not labelled to the webhook.
+	PolicyModeOptOut PolicyMode = "opt-out"
+	// PolicyModeDisabled - no object is converted.
+	PolicyModeDisabled PolicyMode = "disabled"
+)
+
+// Policy - decides whether and how the webhook converts objects of a namespace. Empty fields inherit the value
+// of the policy they override (see Override), and eventually the options of the Handler.
+type Policy struct {
+	Mode PolicyMode `json:"mode,omitempty"`
+	// AuditOnly - when true, objects are not converted: an annotation (see AuditAnnotationKey), a warning and
+	// an audit annotation describe what would have changed (or why the object would have been rejected).
+	AuditOnly                 *bool               `json:"auditOnly,omitempty"`
+	EntrypointImage           string              `json:"entrypointImage,omitempty"`
+	EntrypointImagePullPolicy corev1.PullPolicy   `json:"entrypointImagePullPolicy,omitempty"`
+	ImagePullSecrets          []string            `json:"imagePullSecrets,omitempty"`
+	PrepareRequests           corev1.ResourceList `json:"prepareRequests,omitempty"`
+	PrepareLimits             corev1.ResourceList `json:"prepareLimits,omitempty"`
+}
+
+// ParsePolicy - parses and validates a policy, in YAML or JSON, e.g.:
+//
+//	mode: opt-out
+//	entrypointImage: registry.example.com/tekton/entrypoint:v0.55.0
+//	prepareRequests: {cpu: 10m, memory: 32Mi}
+func ParsePolicy(data []byte) (Policy, error) {
+	var policy Policy
+
+	err := yaml.UnmarshalStrict(data, &policy)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+
+	return policy, policy.Validate()
+}
+
+// Validate - checks the mode and the entrypoint image pull policy.
+func (p Policy) Validate() error {
+	switch p.Mode {
+	case "", PolicyModeOptIn, PolicyModeOptOut, PolicyModeDisabled:
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidPolicy, p.Mode)
+	}
+
+	switch p.EntrypointImagePullPolicy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		return fmt.Errorf("%w: unknown entrypoint image pull policy %q", ErrInvalidPolicy,
+			p.EntrypointImagePullPolicy)
+	}
+
+	return nil
+}
+
+// Override - returns the policy, with the fields set in other replacing its own. Image pull secrets are added.
+// An empty (but not nil) resource list replaces the prepare container resources by none.
+func (p Policy) Override(other Policy) Policy {
+	if other.Mode != "" {
+		p.Mode = other.Mode
+	}
+
+	if other.AuditOnly != nil {
+		p.AuditOnly = other.AuditOnly
+	}
+
+	if other.EntrypointImage != "" {
+		p.EntrypointImage = other.EntrypointImage
+	}
+
+	if other.EntrypointImagePullPolicy != "" {
+		p.EntrypointImagePullPolicy = other.EntrypointImagePullPolicy
+	}
+
+	if len(other.ImagePullSecrets) > 0 {
+		p.ImagePullSecrets = append(append([]string{}, p.ImagePullSecrets...), other.ImagePullSecrets...)
+	}
+
+	if other.PrepareRequests != nil {
+		p.PrepareRequests = other.PrepareRequests
+	}
+
+	if other.PrepareLimits != nil {
+		p.PrepareLimits = other.PrepareLimits
+	}
+
+	return p
+}
+
+// selects - returns whether the object must be converted (or audited).
+func (p Policy) selects(objectMeta metav1.ObjectMeta) bool {
+	switch p.Mode {
+	case PolicyModeOptOut:
+		return objectMeta.Labels[OptInKey] != optOutValue
+	case PolicyModeDisabled:
+		return false
+	case "", PolicyModeOptIn:
+	}
+
+	return isOptedIn(objectMeta)
+}
+
+func (p Policy) isAuditOnly() bool {
+	return p.AuditOnly != nil && *p.AuditOnly
+}
+
+// convertOptions - returns the options of the fields set, to use after the options of the Handler.
+func (p Policy) convertOptions() []kueueleuleu.Option {
+	var opts []kueueleuleu.Option
+
+	if p.EntrypointImage != "" {
+		opts = append(opts, kueueleuleu.WithEntrypointImage(p.EntrypointImage))
+	}
+
+	if p.EntrypointImagePullPolicy != "" {
+		opts = append(opts, kueueleuleu.WithEntrypointImagePullPolicy(p.EntrypointImagePullPolicy))
+	}
+
+	if len(p.ImagePullSecrets) > 0 {
+		opts = append(opts, kueueleuleu.WithImagePullSecrets(p.ImagePullSecrets...))
+	}
+
+	if p.PrepareRequests != nil {
+		opts = append(opts, kueueleuleu.WithPrepareContainerRequests(p.PrepareRequests))
+	}
+
+	if p.PrepareLimits != nil {
+		opts = append(opts, kueueleuleu.WithPrepareContainerLimits(p.PrepareLimits))
+	}
+
+	return opts
+}
+
+// PolicySource - returns the policy of a namespace.
+type PolicySource interface {
+	Policy(namespace string) (Policy, error)
+}
+
+// ClusterPolicy - a cluster-wide policy, with a default policy overridden per namespace.
+type ClusterPolicy struct {
+	Default    Policy            `json:"default,omitempty"`
+	Namespaces map[string]Policy `json:"namespaces,omitempty"`
+}
+
+// LoadClusterPolicyFile - reads a cluster-wide policy from a YAML (or JSON) file, e.g.:
+//
+//	default:
+//	  entrypointImage: registry.example.com/tekton/entrypoint:v0.55.0
+//	namespaces:
+//	  team-a:
+//	    mode: opt-out
+//	  team-b:
+//	    auditOnly: true
+func LoadClusterPolicyFile(path string) (ClusterPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ClusterPolicy{}, fmt.Errorf("cannot read policy file: %w", err)
+	}
+
+	var clusterPolicy ClusterPolicy
+
+	err = yaml.UnmarshalStrict(content, &clusterPolicy)
+	if err != nil {
+		return ClusterPolicy{}, fmt.Errorf("%w: %s: %w", ErrInvalidPolicy, path, err)
+	}
+
+	err = clusterPolicy.Default.Validate()
+	if err != nil {
+		return ClusterPolicy{}, fmt.Errorf("%s: default: %w", path, err)
+	}
+
+	for namespace, policy := range clusterPolicy.Namespaces {
+		err = policy.Validate()
+		if err != nil {
+			return ClusterPolicy{}, fmt.Errorf("%s: namespace %s: %w", path, namespace, err)
+		}
+	}
+
+	return clusterPolicy, nil
+}
+
+// Policy - implements PolicySource.
+func (c ClusterPolicy) Policy(namespace string) (Policy, error) {
+	return c.Default.Override(c.Namespaces[namespace]), nil
+}
+
+// ConfigMapPolicySource - reads the policy of a namespace from a ConfigMap of this namespace (under the
+// PolicyConfigMapKey key), overriding the policy of a base source (e.g. a ClusterPolicy). Namespaces without
+// this ConfigMap get the policy of the base source.
+type ConfigMapPolicySource struct {
+	lister corev1listers.ConfigMapLister
+	name   string
+	base   PolicySource
+}
+
+// NewConfigMapPolicySource - creates a source reading name ConfigMaps from lister (e.g. from an informer),
+// overriding the policies of base (nil for none).
+func NewConfigMapPolicySource(lister corev1listers.ConfigMapLister, name string,
+	base PolicySource,
+) *ConfigMapPolicySource {
+	return &ConfigMapPolicySource{lister: lister, name: name, base: base}
+}
+
+// Policy - implements PolicySource.
+func (s *ConfigMapPolicySource) Policy(namespace string) (Policy, error) {
+	var policy Policy
+
+	if s.base != nil {
+		var err error
+
+		policy, err = s.base.Policy(namespace)
+		if err != nil {
+			return Policy{}, err //nolint:wrapcheck
+		}
+	}
+
+	configMap, err := s.lister.ConfigMaps(namespace).Get(s.name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return policy, nil
+		}
+
+		return Policy{}, fmt.Errorf("cannot get policy configmap %s/%s: %w", namespace, s.name, err)
+	}
+
+	namespacePolicy, err := ParsePolicy([]byte(configMap.Data[PolicyConfigMapKey]))
+	if err != nil {
+		return Policy{}, fmt.Errorf("configmap %s/%s: %w", namespace, s.name, err)
+	}
+
+	return policy.Override(namespacePolicy), nil
+}
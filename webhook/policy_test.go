@@ -0,0 +1,264 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webhook_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/norbjd/kueueleuleu/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func toPtr[T any](v T) *T {
+	return &v
+}
+
+func Test_ParsePolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := webhook.ParsePolicy([]byte(`
+mode: opt-out
+auditOnly: false
+entrypointImagePullPolicy: IfNotPresent
+prepareLimits: {memory: 64Mi}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{
+		Mode:                      webhook.PolicyModeOptOut,
+		AuditOnly:                 toPtr(false),
+		EntrypointImagePullPolicy: corev1.PullIfNotPresent,
+		PrepareLimits:             corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+	}, policy)
+
+	for _, invalid := range []string{"mode: opt-maybe", "entrypointImagePullPolicy: Sometimes", "unknown: field"} {
+		_, err = webhook.ParsePolicy([]byte(invalid))
+		require.ErrorIs(t, err, webhook.ErrInvalidPolicy, invalid)
+	}
+}
+
+func Test_LoadClusterPolicyFile(t *testing.T) {
+	t.Parallel()
+
+	clusterPolicy, err := webhook.LoadClusterPolicyFile(filepath.Join("testdata", "cluster_policy.yaml"))
+	require.NoError(t, err)
+
+	policy, err := clusterPolicy.Policy("other")
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{
+		EntrypointImage:  "registry.example.com/tekton/entrypoint:v0.55.0",
+		ImagePullSecrets: []string{"registry"},
+	}, policy)
+
+	// an empty resource list overrides the default one
+	policy, err = clusterPolicy.Policy("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{
+		Mode:             webhook.PolicyModeOptOut,
+		EntrypointImage:  "registry.example.com/tekton/entrypoint:v0.55.0",
+		ImagePullSecrets: []string{"registry"},
+		PrepareRequests:  corev1.ResourceList{},
+	}, policy)
+
+	// image pull secrets are added
+	policy, err = clusterPolicy.Policy("team-b")
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{
+		AuditOnly:        toPtr(true),
+		EntrypointImage:  "registry.example.com/tekton/entrypoint:v0.55.0",
+		ImagePullSecrets: []string{"registry", "team-b-registry"},
+	}, policy)
+
+	// the default policy is not modified
+	policy, err = clusterPolicy.Policy("other")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry"}, policy.ImagePullSecrets)
+
+	_, err = webhook.LoadClusterPolicyFile(filepath.Join("testdata", "does_not_exist.yaml"))
+	require.Error(t, err)
+}
+
+func newConfigMapLister(t *testing.T, configMaps ...*corev1.ConfigMap) corev1listers.ConfigMapLister {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+
+	for _, configMap := range configMaps {
+		require.NoError(t, indexer.Add(configMap))
+	}
+
+	return corev1listers.NewConfigMapLister(indexer)
+}
+
+func policyConfigMap(namespace, policy string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kueueleuleu-policy", Namespace: namespace},
+		Data:       map[string]string{webhook.PolicyConfigMapKey: policy},
+	}
+}
+
+func Test_ConfigMapPolicySource(t *testing.T) {
+	t.Parallel()
+
+	base := webhook.ClusterPolicy{Default: webhook.Policy{EntrypointImage: "mirror/entrypoint", AuditOnly: toPtr(true)}}
+	source := webhook.NewConfigMapPolicySource(newConfigMapLister(t,
+		policyConfigMap("team-a", "mode: opt-out\nauditOnly: false"),
+		policyConfigMap("team-b", "mode: sometimes"),
+	), "kueueleuleu-policy", base)
+
+	policy, err := source.Policy("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, webhook.Policy{
+		Mode:            webhook.PolicyModeOptOut,
+		AuditOnly:       toPtr(false),
+		EntrypointImage: "mirror/entrypoint",
+	}, policy)
+
+	policy, err = source.Policy("without-configmap")
+	require.NoError(t, err)
+	assert.Equal(t, base.Default, policy)
+
+	_, err = source.Policy("team-b")
+	require.ErrorIs(t, err, webhook.ErrInvalidPolicy)
+	require.ErrorContains(t, err, "configmap team-b/kueueleuleu-policy")
+}
+
+func Test_Handler_policy(t *testing.T) {
+	t.Parallel()
+
+	newServer := func(policy webhook.Policy) string {
+		server := httptest.NewServer(webhook.NewHandler(
+			webhook.WithPolicySource(webhook.ClusterPolicy{Namespaces: map[string]webhook.Policy{"default": policy}}),
+		))
+		t.Cleanup(server.Close)
+
+		return server.URL
+	}
+
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+
+		request, response := review(t, newServer(webhook.Policy{
+			EntrypointImage: "registry.example.com/entrypoint:v0.55.0",
+			PrepareRequests: corev1.ResourceList{},
+		}), "pod_create.json")
+		require.True(t, response.Allowed)
+
+		var patched corev1.Pod
+		applyPatch(t, request, response, &patched)
+
+		require.Len(t, patched.Spec.InitContainers, 1)
+		assert.Equal(t, "registry.example.com/entrypoint:v0.55.0", patched.Spec.InitContainers[0].Image)
+		assert.Empty(t, patched.Spec.InitContainers[0].Resources.Requests)
+	})
+
+	t.Run("opt-out", func(t *testing.T) {
+		t.Parallel()
+
+		request, response := review(t, newServer(webhook.Policy{Mode: webhook.PolicyModeOptOut}),
+			"pod_not_opted_in.json")
+		require.True(t, response.Allowed)
+
+		var patched corev1.Pod
+		applyPatch(t, request, response, &patched)
+		assert.Len(t, patched.Spec.InitContainers, 1)
+
+		_, response = review(t, newServer(webhook.Policy{Mode: webhook.PolicyModeOptOut}), "pod_without_command.json")
+		require.False(t, response.Allowed)
+		assert.Contains(t, response.Result.Message,
+			`or set the norbjd.github.io/kueueleuleu-inject label to "false"`)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		_, response := review(t, newServer(webhook.Policy{Mode: webhook.PolicyModeDisabled}), "pod_create.json")
+		assert.True(t, response.Allowed)
+		assert.Nil(t, response.Patch)
+	})
+
+	t.Run("audit only", func(t *testing.T) {
+		t.Parallel()
+
+		serverURL := newServer(webhook.Policy{AuditOnly: toPtr(true)})
+
+		request, response := review(t, serverURL, "job_create.json")
+		require.True(t, response.Allowed)
+
+		var original, patched map[string]interface{}
+		require.NoError(t, json.Unmarshal(request.Object.Raw, &original))
+		applyPatch(t, request, response, &patched)
+
+		message := "would convert, changing /metadata/annotations, /spec/template/metadata/annotations, " +
+			"/spec/template/spec/containers, /spec/template/spec/initContainers, /spec/template/spec/volumes"
+		assert.Equal(t, map[string]string{"kueueleuleu-audit": message}, response.AuditAnnotations)
+		assert.Equal(t, []string{"kueueleuleu (audit only): " + message}, response.Warnings)
+
+		// only the audit annotation is added
+		annotations := patched["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+		assert.Equal(t, message, annotations[webhook.AuditAnnotationKey])
+		delete(annotations, webhook.AuditAnnotationKey)
+
+		if len(annotations) == 0 {
+			delete(patched["metadata"].(map[string]interface{}), "annotations")
+		}
+
+		assert.Equal(t, original, patched)
+
+		// objects that can't be converted are allowed
+		request, response = review(t, serverURL, "pod_without_command.json")
+		require.True(t, response.Allowed)
+
+		var patchedPod corev1.Pod
+		applyPatch(t, request, response, &patchedPod)
+		assert.Contains(t, patchedPod.Annotations[webhook.AuditAnnotationKey],
+			"would reject: pod spec is invalid: container does not have a command")
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(webhook.NewHandler(webhook.WithPolicySource(webhook.NewConfigMapPolicySource(
+			newConfigMapLister(t, policyConfigMap("default", "mode: sometimes")), "kueueleuleu-policy", nil))))
+		t.Cleanup(server.Close)
+
+		_, response := review(t, server.URL, "pod_create.json")
+		assert.False(t, response.Allowed)
+		assert.Equal(t, int32(http.StatusInternalServerError), response.Result.Code)
+	})
+
+	t.Run("not a create", func(t *testing.T) {
+		t.Parallel()
+
+		response := webhook.NewHandler(webhook.WithPolicySource(webhook.ClusterPolicy{
+			Default: webhook.Policy{Mode: webhook.PolicyModeOptOut},
+		})).Review(&admissionv1.AdmissionRequest{Operation: admissionv1.Delete})
+		assert.True(t, response.Allowed)
+	})
+}
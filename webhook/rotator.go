@@ -0,0 +1,267 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultCertificateValidity - how long certificates generated by a CertificateRotator are valid.
+	DefaultCertificateValidity = 365 * 24 * time.Hour
+	// DefaultCertificateRenewBefore - how long before their expiration certificates are renewed.
+	DefaultCertificateRenewBefore = 30 * 24 * time.Hour
+
+	// CABundleKey - the key of the CA bundle in the Secret managed by a CertificateRotator (alongside
+	// corev1.TLSCertKey and corev1.TLSPrivateKeyKey).
+	CABundleKey = "ca.crt"
+)
+
+var ErrNoCertificate = errors.New("no certificate loaded yet")
+
+// CertificateRotator - serves the webhook with a self-signed certificate, without depending on cert-manager.
+// The CA and the server certificate are generated in-process, stored in a Secret (shared by all webhook replicas),
+// renewed before they expire, and the CA bundle is patched into the MutatingWebhookConfiguration so the API server
+// trusts the webhook.
+type CertificateRotator struct {
+	client                   kubernetes.Interface
+	namespace                string
+	secretName               string
+	serviceName              string
+	webhookConfigurationName string
+	validity                 time.Duration
+	renewBefore              time.Duration
+	now                      func() time.Time
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+}
+
+// RotatorOption - customizes a CertificateRotator.
+type RotatorOption func(*CertificateRotator)
+
+// NewCertificateRotator - creates a rotator storing certificates in the secretName Secret of namespace,
+// issued for the serviceName Service (in the same namespace), and patching the CA bundle of all webhooks
+// of the webhookConfigurationName MutatingWebhookConfiguration.
+func NewCertificateRotator(client kubernetes.Interface, namespace, secretName, serviceName,
+	webhookConfigurationName string, opts ...RotatorOption,
+) *CertificateRotator {
+	rotator := &CertificateRotator{
+		client:                   client,
+		namespace:                namespace,
+		secretName:               secretName,
+		serviceName:              serviceName,
+		webhookConfigurationName: webhookConfigurationName,
+		validity:                 DefaultCertificateValidity,
+		renewBefore:              DefaultCertificateRenewBefore,
+		now:                      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(rotator)
+	}
+
+	return rotator
+}
+
+// WithCertificateValidity - sets how long generated certificates are valid (default: DefaultCertificateValidity),
+// and how long before their expiration they are renewed (default: DefaultCertificateRenewBefore).
+func WithCertificateValidity(validity, renewBefore time.Duration) RotatorOption {
+	return func(r *CertificateRotator) {
+		r.validity = validity
+		r.renewBefore = renewBefore
+	}
+}
+
+// WithClock - sets the function returning the current time, used to generate and renew certificates.
+func WithClock(now func() time.Time) RotatorOption {
+	return func(r *CertificateRotator) {
+		r.now = now
+	}
+}
+
+// GetCertificate - returns the current server certificate. Use it as tls.Config.GetCertificate,
+// so the server picks up renewed certificates without restarting.
+func (r *CertificateRotator) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.certificate == nil {
+		return nil, ErrNoCertificate
+	}
+
+	return r.certificate, nil
+}
+
+// Run - calls Rotate every interval until ctx is done. Errors are logged, and retried at the next interval.
+func (r *CertificateRotator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.Rotate(ctx)
+			if err != nil {
+				log.Printf("cannot rotate webhook certificates: %v", err)
+			}
+		}
+	}
+}
+
+// Rotate - loads certificates from the Secret, or generates new ones if there are none or if they are invalid
+// or about to expire, then makes sure the MutatingWebhookConfiguration trusts them before serving them
+// (see GetCertificate). When several replicas rotate at the same time, only one of them updates the Secret,
+// others get a conflict and load the certificates of the winner.
+func (r *CertificateRotator) Rotate(ctx context.Context) error {
+	err := r.rotate(ctx)
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		err = r.rotate(ctx)
+	}
+
+	return err
+}
+
+func (r *CertificateRotator) rotate(ctx context.Context) error {
+	secret, err := r.client.CoreV1().Secrets(r.namespace).Get(ctx, r.secretName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("cannot get secret %s/%s: %w", r.namespace, r.secretName, err)
+		}
+
+		secret = nil
+	}
+
+	var current certificates
+	if secret != nil {
+		current = certificates{
+			caBundle: secret.Data[CABundleKey],
+			cert:     secret.Data[corev1.TLSCertKey],
+			key:      secret.Data[corev1.TLSPrivateKeyKey],
+		}
+	}
+
+	now := r.now()
+
+	certificate, err := current.check(r.serviceName, r.namespace, now, r.renewBefore)
+	if err != nil {
+		current, err = generateCertificates(r.serviceName, r.namespace, now, r.validity, current.caBundle)
+		if err != nil {
+			return err
+		}
+
+		err = r.saveCertificates(ctx, secret, current)
+		if err != nil {
+			return err
+		}
+
+		certificate, err = current.check(r.serviceName, r.namespace, now, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the API server must trust the new CA before the new certificate is served, otherwise it can't call the
+	// webhook until the next rotation: on error, the previous certificate is still served, and the new one
+	// (stored in the secret) is loaded again at the next rotation
+	err = r.patchCABundle(ctx, current.caBundle)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.certificate = certificate
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *CertificateRotator) saveCertificates(ctx context.Context, secret *corev1.Secret, certs certificates) error {
+	data := map[string][]byte{
+		CABundleKey:             certs.caBundle,
+		corev1.TLSCertKey:       certs.cert,
+		corev1.TLSPrivateKeyKey: certs.key,
+	}
+
+	if secret == nil {
+		_, err := r.client.CoreV1().Secrets(r.namespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: r.secretName, Namespace: r.namespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("cannot create secret %s/%s: %w", r.namespace, r.secretName, err)
+		}
+
+		return nil
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data = data
+
+	// the resourceVersion of the secret we read is kept, so the update fails if another replica updated it
+	_, err := r.client.CoreV1().Secrets(r.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot update secret %s/%s: %w", r.namespace, r.secretName, err)
+	}
+
+	return nil
+}
+
+func (r *CertificateRotator) patchCABundle(ctx context.Context, caBundle []byte) error {
+	configurations := r.client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+
+	configuration, err := configurations.Get(ctx, r.webhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot get mutating webhook configuration %s: %w", r.webhookConfigurationName, err)
+	}
+
+	configuration = configuration.DeepCopy()
+	changed := false
+
+	for i := range configuration.Webhooks {
+		if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			configuration.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	_, err = configurations.Update(ctx, configuration, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot update mutating webhook configuration %s: %w", r.webhookConfigurationName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,265 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webhook_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/norbjd/kueueleuleu/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	rotatorNamespace     = "kueueleuleu-system"
+	rotatorSecret        = "kueueleuleu-webhook-tls"
+	rotatorService       = "kueueleuleu-webhook"
+	rotatorConfiguration = "kueueleuleu"
+)
+
+func newRotatorClientset() *fake.Clientset {
+	return fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: rotatorConfiguration},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{Name: "pods.kueueleuleu.norbjd.github.io"},
+			{Name: "jobs.kueueleuleu.norbjd.github.io"},
+		},
+	})
+}
+
+func getCertificates(t *testing.T, client *fake.Clientset) (*corev1.Secret, [][]byte) {
+	t.Helper()
+
+	secret, err := client.CoreV1().Secrets(rotatorNamespace).Get(context.Background(), rotatorSecret, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	configuration, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(
+		context.Background(), rotatorConfiguration, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	caBundles := make([][]byte, 0, len(configuration.Webhooks))
+	for _, mutatingWebhook := range configuration.Webhooks {
+		caBundles = append(caBundles, mutatingWebhook.ClientConfig.CABundle)
+	}
+
+	return secret, caBundles
+}
+
+func countCertificates(t *testing.T, caBundle []byte) int {
+	t.Helper()
+
+	count := 0
+
+	for block, rest := pem.Decode(caBundle); block != nil; block, rest = pem.Decode(rest) {
+		count++
+	}
+
+	return count
+}
+
+// requireTrusted - checks that a TLS client trusting caBundle can reach a server using the certificate,
+// like the API server calling the webhook through its Service.
+func requireTrusted(t *testing.T, caBundle []byte, certificate *tls.Certificate, now time.Time) {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{*certificate}, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caBundle))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:    roots,
+		ServerName: rotatorService + "." + rotatorNamespace + ".svc",
+		MinVersion: tls.VersionTLS12,
+		Time:       func() time.Time { return now },
+	}}}
+
+	response, err := client.Get(server.URL) //nolint:noctx
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func Test_CertificateRotator(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newRotatorClientset()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	rotator := webhook.NewCertificateRotator(client, rotatorNamespace, rotatorSecret, rotatorService,
+		rotatorConfiguration, webhook.WithClock(func() time.Time { return now }))
+
+	_, err := rotator.GetCertificate(nil)
+	require.ErrorIs(t, err, webhook.ErrNoCertificate)
+
+	// certificates are generated, stored in the secret, and the CA bundle is patched into the configuration
+	require.NoError(t, rotator.Rotate(ctx))
+
+	secret, caBundles := getCertificates(t, client)
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, [][]byte{secret.Data[webhook.CABundleKey], secret.Data[webhook.CABundleKey]}, caBundles)
+	assert.Equal(t, 1, countCertificates(t, caBundles[0]))
+
+	firstCertificate, err := rotator.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(webhook.DefaultCertificateValidity), firstCertificate.Leaf.NotAfter)
+	requireTrusted(t, caBundles[0], firstCertificate, now)
+
+	// certificates still valid are kept, e.g. when the webhook restarts, or for other replicas
+	replica := webhook.NewCertificateRotator(client, rotatorNamespace, rotatorSecret, rotatorService,
+		rotatorConfiguration, webhook.WithClock(func() time.Time { return now }))
+	require.NoError(t, replica.Rotate(ctx))
+
+	replicaCertificate, err := replica.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, firstCertificate.Certificate, replicaCertificate.Certificate)
+
+	secretAfterRestart, _ := getCertificates(t, client)
+	assert.Equal(t, secret.Data, secretAfterRestart.Data)
+
+	// certificates are renewed before they expire, the previous CA is still trusted until the next renewal,
+	// so that replicas still serving the previous certificate can be reached
+	now = now.Add(webhook.DefaultCertificateValidity - webhook.DefaultCertificateRenewBefore + time.Hour)
+	require.NoError(t, rotator.Rotate(ctx))
+
+	_, caBundles = getCertificates(t, client)
+	assert.Equal(t, 2, countCertificates(t, caBundles[0]))
+
+	renewedCertificate, err := rotator.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, firstCertificate.Certificate, renewedCertificate.Certificate)
+	requireTrusted(t, caBundles[0], renewedCertificate, now)
+	requireTrusted(t, caBundles[0], firstCertificate, now)
+
+	// only the previous CA is kept
+	now = now.Add(webhook.DefaultCertificateValidity)
+	require.NoError(t, rotator.Rotate(ctx))
+
+	_, caBundles = getCertificates(t, client)
+	assert.Equal(t, 2, countCertificates(t, caBundles[0]))
+}
+
+func Test_CertificateRotator_serviceRenamed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newRotatorClientset()
+
+	require.NoError(t, webhook.NewCertificateRotator(client, rotatorNamespace, rotatorSecret, "old-service",
+		rotatorConfiguration).Rotate(ctx))
+
+	rotator := webhook.NewCertificateRotator(client, rotatorNamespace, rotatorSecret, rotatorService,
+		rotatorConfiguration, webhook.WithCertificateValidity(time.Hour, time.Minute))
+	require.NoError(t, rotator.Rotate(ctx))
+
+	certificate, err := rotator.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Contains(t, certificate.Leaf.DNSNames, rotatorService+"."+rotatorNamespace+".svc")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), certificate.Leaf.NotAfter, time.Minute)
+
+	_, caBundles := getCertificates(t, client)
+	requireTrusted(t, caBundles[0], certificate, time.Now())
+}
+
+func Test_CertificateRotator_missingConfiguration(t *testing.T) {
+	t.Parallel()
+
+	rotator := webhook.NewCertificateRotator(fake.NewSimpleClientset(), rotatorNamespace, rotatorSecret,
+		rotatorService, rotatorConfiguration)
+
+	err := rotator.Rotate(context.Background())
+	require.ErrorContains(t, err, "cannot get mutating webhook configuration kueueleuleu")
+
+	// the certificate is not served, as the API server would not trust it
+	_, err = rotator.GetCertificate(nil)
+	require.ErrorIs(t, err, webhook.ErrNoCertificate)
+}
+
+func Test_CertificateRotator_caBundleNotPatched(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := newRotatorClientset()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	rotator := webhook.NewCertificateRotator(client, rotatorNamespace, rotatorSecret, rotatorService,
+		rotatorConfiguration, webhook.WithClock(func() time.Time { return now }))
+	require.NoError(t, rotator.Rotate(ctx))
+
+	firstCertificate, err := rotator.GetCertificate(nil)
+	require.NoError(t, err)
+
+	var failUpdates atomic.Bool
+
+	client.PrependReactor("update", "mutatingwebhookconfigurations",
+		func(k8stesting.Action) (bool, runtime.Object, error) {
+			if failUpdates.Load() {
+				return true, nil, apierrors.NewInternalError(errors.New("etcd is unavailable"))
+			}
+
+			return false, nil, nil
+		})
+
+	// the renewed certificate is not served until its CA is in the caBundle of the configuration
+	failUpdates.Store(true)
+
+	now = now.Add(webhook.DefaultCertificateValidity - webhook.DefaultCertificateRenewBefore + time.Hour)
+	require.ErrorContains(t, rotator.Rotate(ctx), "cannot update mutating webhook configuration kueueleuleu")
+
+	certificate, err := rotator.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, firstCertificate.Certificate, certificate.Certificate)
+
+	secret, caBundles := getCertificates(t, client)
+	assert.Equal(t, 1, countCertificates(t, caBundles[0]))
+	requireTrusted(t, caBundles[0], certificate, now)
+
+	// the renewed certificate, stored in the secret, is served at the next rotation
+	failUpdates.Store(false)
+	require.NoError(t, rotator.Rotate(ctx))
+
+	renewedCertificate, err := rotator.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, firstCertificate.Certificate, renewedCertificate.Certificate)
+
+	secretAfterRotation, caBundles := getCertificates(t, client)
+	assert.Equal(t, secret.Data, secretAfterRotation.Data)
+	assert.Equal(t, 2, countCertificates(t, caBundles[0]))
+	requireTrusted(t, caBundles[0], renewedCertificate, now)
+}
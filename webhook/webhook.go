@@ -0,0 +1,429 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package webhook provides a mutating admission webhook converting Pods, Jobs and CronJobs with kueueleuleu
+// when they are created, so users don't have to convert their manifests themselves.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/norbjd/kueueleuleu"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+const (
+	// OptInKey - the label to set to "true" on Pods, Jobs and CronJobs to convert. Annotations are ignored, so the
+	// MutatingWebhookConfiguration can only send labelled objects to the webhook (objectSelector).
+	OptInKey    = "norbjd.github.io/kueueleuleu-inject"
+	optInValue  = "true"
+	optOutValue = "false"
+
+	// AuditAnnotationKey - the annotation describing what would have changed, set on objects when the policy
+	// is audit only.
+	AuditAnnotationKey = "norbjd.github.io/kueueleuleu-audit"
+	// auditAnnotationName - the name of the audit annotation in the API server audit log (prefixed by
+	// the name of the webhook).
+	auditAnnotationName = "kueueleuleu-audit"
+
+	maxRequestSize = 3 * 1024 * 1024
+)
+
+var (
+	ErrInvalidAdmissionReview = errors.New("invalid admission review")
+
+	//nolint:gochecknoglobals
+	podKind = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}
+	//nolint:gochecknoglobals
+	jobKind = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+	//nolint:gochecknoglobals
+	cronJobKind = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}
+)
+
+// Handler - an http.Handler answering AdmissionReview requests (admission.k8s.io/v1) sent to a mutating webhook.
+// Pods, Jobs and CronJobs opted in (see OptInKey) are converted when they are created, other requests are allowed
+// without changes. Objects that can't be converted (e.g. a container without a command) are rejected.
+// A PolicySource can change this per namespace (see WithPolicySource).
+type Handler struct {
+	convertOptions []kueueleuleu.Option
+	policySource   PolicySource
+}
+
+// Option - customizes a Handler.
+type Option func(*Handler)
+
+// NewHandler - creates a webhook handler.
+func NewHandler(opts ...Option) *Handler {
+	handler := &Handler{}
+
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	return handler
+}
+
+// WithConvertOptions - sets the options used to convert objects (e.g. kueueleuleu.WithEntrypointImage).
+func WithConvertOptions(opts ...kueueleuleu.Option) Option {
+	return func(h *Handler) {
+		h.convertOptions = append(h.convertOptions, opts...)
+	}
+}
+
+// WithPolicySource - sets the source of the policies deciding whether and how objects are converted, depending on
+// their namespace. Options of the policy take precedence over the ones of WithConvertOptions.
+func WithPolicySource(source PolicySource) Option {
+	return func(h *Handler) {
+		h.policySource = source
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	review, err := readAdmissionReview(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	review.Response = h.review(r.Context(), review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func readAdmissionReview(body io.Reader) (*admissionv1.AdmissionReview, error) {
+	var review admissionv1.AdmissionReview
+
+	err := json.NewDecoder(io.LimitReader(body, maxRequestSize)).Decode(&review)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAdmissionReview, err)
+	}
+
+	if review.Request == nil {
+		return nil, fmt.Errorf("%w: request is missing", ErrInvalidAdmissionReview)
+	}
+
+	return &review, nil
+}
+
+// Review - returns the response to an admission request: allowed, with a JSON patch converting the object if needed.
+func (h *Handler) Review(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	return h.review(context.Background(), request)
+}
+
+// review - like Review, resolving missing commands (see kueueleuleu.WithCommandResolver) until the context is done,
+// e.g. when the API server stops waiting for the response.
+func (h *Handler) review(ctx context.Context, request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{
+		UID:     request.UID,
+		Allowed: true,
+	}
+
+	if request.Operation != admissionv1.Create {
+		return response
+	}
+
+	policy, err := h.policy(request.Namespace)
+	if err != nil {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusInternalServerError,
+			Message: fmt.Sprintf("kueueleuleu: cannot get the policy of namespace %s: %s", request.Namespace, err),
+		}
+
+		return response
+	}
+
+	converted, err := h.convert(ctx, request.Kind, request.Object.Raw, policy)
+	if err != nil {
+		if policy.isAuditOnly() && !errors.Is(err, ErrInvalidAdmissionReview) {
+			message := strings.TrimPrefix(rejection(err, policy).Message, "kueueleuleu: ")
+
+			return h.audit(response, request.Object.Raw, "would reject: "+message)
+		}
+
+		response.Allowed = false
+		response.Result = rejection(err, policy)
+
+		return response
+	}
+
+	if converted == nil {
+		return response
+	}
+
+	patch, err := jsonpatch.CreatePatch(request.Object.Raw, converted)
+	if err != nil {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusInternalServerError,
+			Message: fmt.Sprintf("kueueleuleu: cannot compute patch: %s", err),
+		}
+
+		return response
+	}
+
+	if len(patch) == 0 {
+		return response
+	}
+
+	if policy.isAuditOnly() {
+		return h.audit(response, request.Object.Raw, "would convert, changing "+changedPaths(patch))
+	}
+
+	return withPatch(response, patch)
+}
+
+// withPatch - returns the response, allowed with the patch.
+func withPatch(response *admissionv1.AdmissionResponse, patch []jsonpatch.Operation) *admissionv1.AdmissionResponse {
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusInternalServerError,
+			Message: fmt.Sprintf("kueueleuleu: cannot marshal patch: %s", err),
+		}
+
+		return response
+	}
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	response.Patch = patchJSON
+	response.PatchType = &patchType
+
+	return response
+}
+
+// audit - returns the response, allowed, with a patch only adding the audit annotation to the object.
+// The message is also returned as a warning to the client, and as an audit annotation for the API server audit log.
+func (h *Handler) audit(response *admissionv1.AdmissionResponse, raw []byte,
+	message string,
+) *admissionv1.AdmissionResponse {
+	response.Warnings = append(response.Warnings, "kueueleuleu (audit only): "+message)
+	response.AuditAnnotations = map[string]string{auditAnnotationName: message}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return response
+	}
+
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		object["metadata"] = metadata
+	}
+
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+
+	annotations[AuditAnnotationKey] = message
+
+	annotated, err := json.Marshal(object)
+	if err != nil {
+		return response
+	}
+
+	patch, err := jsonpatch.CreatePatch(raw, annotated)
+	if err != nil {
+		return response
+	}
+
+	return withPatch(response, patch)
+}
+
+// changedPaths - summarizes the paths changed by the patch, without indexes and annotation keys,
+// e.g. "/spec/containers, /spec/initContainers".
+func changedPaths(patch []jsonpatch.Operation) string {
+	var paths []string
+
+	seen := map[string]bool{}
+
+	for _, operation := range patch {
+		var segments []string
+
+		for _, segment := range strings.Split(strings.TrimPrefix(operation.Path, "/"), "/") {
+			if _, err := strconv.Atoi(segment); err == nil || segment == "-" {
+				break
+			}
+
+			segments = append(segments, segment)
+
+			if segment == "annotations" || segment == "labels" {
+				break
+			}
+		}
+
+		path := "/" + strings.Join(segments, "/")
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return strings.Join(paths, ", ")
+}
+
+func (h *Handler) policy(namespace string) (Policy, error) {
+	if h.policySource == nil {
+		return Policy{}, nil
+	}
+
+	return h.policySource.Policy(namespace) //nolint:wrapcheck
+}
+
+// convert - returns the JSON of the converted object, or nil if the object must not be converted.
+// Only the changes made by the conversion are applied to the object, so fields unknown to the typed
+// form (e.g. fields added by newer versions of Kubernetes) are kept instead of being removed by the patch.
+func (h *Handler) convert(ctx context.Context, kind metav1.GroupVersionKind, raw []byte,
+	policy Policy,
+) ([]byte, error) {
+	var (
+		original, converted interface{}
+		err                 error
+	)
+
+	opts := append(append([]kueueleuleu.Option{}, h.convertOptions...), policy.convertOptions()...)
+	opts = append(opts, kueueleuleu.WithContext(ctx))
+
+	switch schema.GroupVersionKind(kind) {
+	case podKind:
+		var pod corev1.Pod
+		if err = json.Unmarshal(raw, &pod); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAdmissionReview, err)
+		}
+
+		if !policy.selects(pod.ObjectMeta) {
+			return nil, nil
+		}
+
+		convertedPod, convertErr := kueueleuleu.ConvertPod(pod, opts...)
+		original, converted, err = &pod, &convertedPod, convertErr
+	case jobKind:
+		var job batchv1.Job
+		if err = json.Unmarshal(raw, &job); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAdmissionReview, err)
+		}
+
+		if !policy.selects(job.ObjectMeta) {
+			return nil, nil
+		}
+
+		convertedJob, convertErr := kueueleuleu.ConvertJob(job, opts...)
+		original, converted, err = &job, &convertedJob, convertErr
+	case cronJobKind:
+		var cronJob batchv1.CronJob
+		if err = json.Unmarshal(raw, &cronJob); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAdmissionReview, err)
+		}
+
+		if !policy.selects(cronJob.ObjectMeta) {
+			return nil, nil
+		}
+
+		convertedCronJob, convertErr := kueueleuleu.ConvertCronJob(cronJob, opts...)
+		original, converted, err = &cronJob, &convertedCronJob, convertErr
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var object map[string]interface{}
+	// unlike encoding/json, integers are decoded as int64, like in the typed forms
+	if err = utiljson.Unmarshal(raw, &object); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAdmissionReview, err)
+	}
+
+	merged, err := kueueleuleu.MergeUnstructured(object, original, converted)
+	if err != nil {
+		return nil, fmt.Errorf("cannot merge converted object: %w", err)
+	}
+
+	convertedJSON, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal converted object: %w", err)
+	}
+
+	return convertedJSON, nil
+}
+
+func isOptedIn(objectMeta metav1.ObjectMeta) bool {
+	return objectMeta.Labels[OptInKey] == optInValue
+}
+
+// rejection - returns the status explaining why the object can't be converted.
+func rejection(err error, policy Policy) *metav1.Status {
+	status := &metav1.Status{
+		Status: metav1.StatusFailure,
+		Code:   http.StatusUnprocessableEntity,
+		Reason: metav1.StatusReasonInvalid,
+	}
+
+	switch {
+	case errors.Is(err, ErrInvalidAdmissionReview):
+		status.Code = http.StatusBadRequest
+		status.Reason = metav1.StatusReasonBadRequest
+		status.Message = fmt.Sprintf("kueueleuleu: %s", err)
+	case errors.Is(err, kueueleuleu.ErrContainerDoesNotHaveACommand) && policy.Mode == PolicyModeOptOut:
+		status.Message = fmt.Sprintf("kueueleuleu: %s. Set the command of these containers (it is required "+
+			"to run them sequentially), or set the %s label to \"%s\" to run them at the same time",
+			strings.ReplaceAll(err.Error(), "\n", "; "), OptInKey, optOutValue)
+	case errors.Is(err, kueueleuleu.ErrContainerDoesNotHaveACommand):
+		status.Message = fmt.Sprintf("kueueleuleu: %s. Set the command of these containers (it is required "+
+			"to run them sequentially), or remove the %s label to run them at the same time",
+			strings.ReplaceAll(err.Error(), "\n", "; "), OptInKey)
+	default:
+		status.Message = fmt.Sprintf("kueueleuleu: cannot convert object: %s", err)
+	}
+
+	return status
+}
@@ -0,0 +1,260 @@
+// This file is part of kueueleuleu (https://github.com/norbjd/kueueleuleu).
+//
+// Copyright (C) 2023 norbjd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3 of the License.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/norbjd/kueueleuleu"
+	"github.com/norbjd/kueueleuleu/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// review - sends the recorded AdmissionReview fixture to the webhook, and returns the request and the response.
+func review(t *testing.T, serverURL, fixture string) (*admissionv1.AdmissionRequest, *admissionv1.AdmissionResponse) {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+
+	var request admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(body, &request))
+
+	httpResponse, err := http.Post(serverURL, "application/json", bytes.NewReader(body)) //nolint:noctx
+	require.NoError(t, err)
+
+	defer httpResponse.Body.Close()
+
+	require.Equal(t, http.StatusOK, httpResponse.StatusCode)
+
+	var response admissionv1.AdmissionReview
+	require.NoError(t, json.NewDecoder(httpResponse.Body).Decode(&response))
+
+	assert.Equal(t, "AdmissionReview", response.Kind)
+	assert.Equal(t, "admission.k8s.io/v1", response.APIVersion)
+	require.NotNil(t, response.Response)
+	assert.Equal(t, request.Request.UID, response.Response.UID)
+
+	return request.Request, response.Response
+}
+
+// applyPatch - applies the patch of the response to the object of the request, and unmarshals the result into out.
+func applyPatch(t *testing.T, request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionResponse,
+	out interface{},
+) {
+	t.Helper()
+
+	require.NotNil(t, response.PatchType)
+	assert.Equal(t, admissionv1.PatchTypeJSONPatch, *response.PatchType)
+
+	patch, err := jsonpatch.DecodePatch(response.Patch)
+	require.NoError(t, err)
+
+	patched, err := patch.Apply(request.Object.Raw)
+	require.NoError(t, err)
+
+	require.NoError(t, json.Unmarshal(patched, out))
+}
+
+func Test_Handler(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(webhook.NewHandler())
+	t.Cleanup(server.Close)
+
+	t.Run("pod", func(t *testing.T) {
+		t.Parallel()
+
+		request, response := review(t, server.URL, "pod_create.json")
+		require.True(t, response.Allowed)
+
+		var original, patched corev1.Pod
+		require.NoError(t, json.Unmarshal(request.Object.Raw, &original))
+		applyPatch(t, request, response, &patched)
+
+		expected, err := kueueleuleu.ConvertPod(original)
+		require.NoError(t, err)
+		assert.Equal(t, expected, patched)
+	})
+
+	t.Run("job", func(t *testing.T) {
+		t.Parallel()
+
+		request, response := review(t, server.URL, "job_create.json")
+		require.True(t, response.Allowed)
+
+		var original, patched batchv1.Job
+		require.NoError(t, json.Unmarshal(request.Object.Raw, &original))
+		applyPatch(t, request, response, &patched)
+
+		expected, err := kueueleuleu.ConvertJob(original)
+		require.NoError(t, err)
+		assert.Equal(t, expected, patched)
+	})
+
+	t.Run("cronjob", func(t *testing.T) {
+		t.Parallel()
+
+		request, response := review(t, server.URL, "cronjob_create.json")
+		require.True(t, response.Allowed)
+
+		var original, patched batchv1.CronJob
+		require.NoError(t, json.Unmarshal(request.Object.Raw, &original))
+		applyPatch(t, request, response, &patched)
+
+		expected, err := kueueleuleu.ConvertCronJob(original)
+		require.NoError(t, err)
+		assert.Equal(t, expected, patched)
+	})
+
+	t.Run("pod with fields of a newer API", func(t *testing.T) {
+		t.Parallel()
+
+		// restartPolicy of init containers (sidecars) and newerField are unknown to the typed form
+		request, response := review(t, server.URL, "pod_newer_api.json")
+		require.True(t, response.Allowed)
+
+		var original, patched corev1.Pod
+		require.NoError(t, json.Unmarshal(request.Object.Raw, &original))
+		applyPatch(t, request, response, &patched)
+
+		expected, err := kueueleuleu.ConvertPod(original)
+		require.NoError(t, err)
+		assert.Equal(t, expected, patched)
+
+		var patchedObject map[string]interface{}
+		applyPatch(t, request, response, &patchedObject)
+
+		spec, _ := patchedObject["spec"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"enabled": true}, spec["newerField"])
+
+		initContainers, _ := spec["initContainers"].([]interface{})
+		require.Len(t, initContainers, 2)
+		assert.Contains(t, initContainers, map[string]interface{}{
+			"name":                     "proxy",
+			"image":                    "envoyproxy/envoy:v1.29.0",
+			"resources":                map[string]interface{}{},
+			"restartPolicy":            "Always",
+			"terminationMessagePath":   "/dev/termination-log",
+			"terminationMessagePolicy": "File",
+			"imagePullPolicy":          "IfNotPresent",
+		})
+	})
+
+	// pod_annotated.json is opted in with an annotation instead of a label: it is not converted, as the
+	// MutatingWebhookConfiguration only sends labelled objects
+	for _, fixture := range []string{"pod_not_opted_in.json", "pod_annotated.json", "pod_update.json"} {
+		fixture := fixture
+
+		t.Run(fixture, func(t *testing.T) {
+			t.Parallel()
+
+			_, response := review(t, server.URL, fixture)
+			assert.True(t, response.Allowed)
+			assert.Nil(t, response.Patch)
+			assert.Nil(t, response.PatchType)
+		})
+	}
+
+	t.Run("pod without command", func(t *testing.T) {
+		t.Parallel()
+
+		_, response := review(t, server.URL, "pod_without_command.json")
+		assert.False(t, response.Allowed)
+		assert.Nil(t, response.Patch)
+		require.NotNil(t, response.Result)
+		assert.Equal(t, int32(http.StatusUnprocessableEntity), response.Result.Code)
+		assert.Equal(t, "kueueleuleu: pod spec is invalid: "+
+			"container does not have a command, but we expect one (container say-nothing); "+
+			"container does not have a command, but we expect one (container say-goodbye). "+
+			"Set the command of these containers (it is required to run them sequentially), "+
+			"or remove the norbjd.github.io/kueueleuleu-inject label to run them at the same time",
+			response.Result.Message)
+	})
+}
+
+func Test_Handler_alreadyConverted(t *testing.T) {
+	t.Parallel()
+
+	// pods created by a converted job are already converted, and opted in as labels are copied from the template
+	body, err := os.ReadFile(filepath.Join("testdata", "pod_create.json"))
+	require.NoError(t, err)
+
+	var admissionReview admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(body, &admissionReview))
+
+	var pod corev1.Pod
+	require.NoError(t, json.Unmarshal(admissionReview.Request.Object.Raw, &pod))
+
+	converted, err := kueueleuleu.ConvertPod(pod)
+	require.NoError(t, err)
+
+	admissionReview.Request.Object.Raw, err = json.Marshal(converted)
+	require.NoError(t, err)
+
+	response := webhook.NewHandler().Review(admissionReview.Request)
+	assert.True(t, response.Allowed)
+	assert.Nil(t, response.Patch)
+}
+
+func Test_Handler_convertOptions(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(webhook.NewHandler(
+		webhook.WithConvertOptions(kueueleuleu.WithEntrypointImage("registry.example.com/entrypoint:v0.55.0")),
+	))
+	defer server.Close()
+
+	request, response := review(t, server.URL, "pod_create.json")
+	require.True(t, response.Allowed)
+
+	var patched corev1.Pod
+	applyPatch(t, request, response, &patched)
+
+	require.Len(t, patched.Spec.InitContainers, 1)
+	assert.Equal(t, "registry.example.com/entrypoint:v0.55.0", patched.Spec.InitContainers[0].Image)
+}
+
+func Test_Handler_invalidRequests(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(webhook.NewHandler())
+	defer server.Close()
+
+	httpResponse, err := http.Get(server.URL) //nolint:noctx
+	require.NoError(t, err)
+	httpResponse.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, httpResponse.StatusCode)
+
+	for _, body := range []string{"not json", `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1"}`} {
+		httpResponse, err := http.Post(server.URL, "application/json", bytes.NewBufferString(body)) //nolint:noctx
+		require.NoError(t, err)
+		httpResponse.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, httpResponse.StatusCode)
+	}
+}